@@ -1,16 +1,52 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/api"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	cfgredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config/redis"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+	dedupmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/dedup/memory"
+	dedupredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/dedup/redis"
+	digestmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/digest/memory"
+	digestredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/digest/redis"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/inbox"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/logging"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/sms"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/smtp"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/webhook"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+	idempotencymemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency/memory"
+	idempotencyredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency/redis"
+	overridesmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/overrides/memory"
+	overridesredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/overrides/redis"
+	queuememory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/queue/memory"
+	queueredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/queue/redis"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
 	rlredis "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/redis"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// limitsPollInterval is how often the limits file is checked for changes.
+	limitsPollInterval = 5 * time.Second
+	// deferredPollInterval is how often deferred notifications are checked
+	// for being due.
+	deferredPollInterval = time.Second
+	// idempotencyTTL is how long responses are replayed to retries carrying
+	// the same Idempotency-Key.
+	idempotencyTTL = 24 * time.Hour
+)
+
 func main() {
 	redisAddr := os.Getenv("REDIS_ADDR")
 	if redisAddr == "" {
@@ -23,16 +59,131 @@ func main() {
 
 	defer client.Close()
 
-	rateLimiter := rlredis.New(client)
+	// LIMITS_FILE, or -limits, points at a limits file to use instead of the
+	// embedded one.
+	limitsFile := flag.String("limits", os.Getenv("LIMITS_FILE"), "path of the rate-limit config file, .json, .yaml or .toml, defaults to the embedded one")
+	flag.Parse()
 
-	configs, err := config.LoadFromEmbedded()
+	var (
+		configs config.Limits
+		err     error
+	)
+	if *limitsFile != "" {
+		configs, err = config.LoadFromFile(*limitsFile)
+	} else {
+		configs, err = config.LoadFromEmbedded()
+	}
 	if err != nil {
 		panic(err)
 	}
-	cfgProvider := config.NewRLConfigProvider(configs)
-	ctrl := notification.NewController(rateLimiter, cfgProvider)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// LIMITS_STORE selects where limits are read from: "file" (default) uses
+	// the limits file, reloaded when it changes and on SIGHUP, "redis" shares
+	// versioned limits between every replica, falling back to the limits file
+	// until some are published.
+	var cfgProvider config.Provider
+	switch store := os.Getenv("LIMITS_STORE"); store {
+	case "", "file":
+		fileProvider := config.NewRLConfigProvider(configs)
+		if *limitsFile != "" {
+			reload := make(chan os.Signal, 1)
+			signal.Notify(reload, syscall.SIGHUP)
+			go fileProvider.WatchFile(ctx, *limitsFile, limitsPollInterval, reload)
+		}
+		cfgProvider = fileProvider
+	case "redis":
+		redisProvider, err := cfgredis.New(ctx, client, configs)
+		if err != nil {
+			panic(err)
+		}
+		go redisProvider.Watch(ctx)
+		cfgProvider = redisProvider
+	default:
+		panic(fmt.Sprintf("unknown LIMITS_STORE %q, expected file or redis", store))
+	}
+
 	defaultLogger := slog.Default()
-	api := api.New(defaultLogger, client, ctrl)
+
+	// SMTP_ADDR, when set, makes notifications be emailed through that SMTP
+	// server to <user-id>@SMTP_DOMAIN, else they are only logged. It also
+	// sends the ones without a channel.
+	var gateway notification.Gateway = logging.New(defaultLogger)
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		gateway = smtp.New(smtp.Options{
+			Addr:     smtpAddr,
+			From:     os.Getenv("SMTP_FROM"),
+			Domain:   os.Getenv("SMTP_DOMAIN"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		})
+	}
+
+	// WEBHOOK_URL, when set, enables the webhook channel, signed with
+	// WEBHOOK_SECRET when set.
+	var webhookGateway notification.Gateway
+	if webhookURL := os.Getenv("WEBHOOK_URL"); webhookURL != "" {
+		webhookGateway = webhook.New(webhook.Options{URL: webhookURL, Secret: os.Getenv("WEBHOOK_SECRET")})
+	}
+
+	// RATE_LIMITER_BACKEND selects where rate-limit state lives: "redis"
+	// (default) is shared by every replica, "memory" is local to this process.
+	// Idempotency keys follow it.
+	var (
+		ctrl             *notification.Controller
+		inboxGateway     *inbox.Inbox
+		idempotencyStore idempotency.Store
+	)
+	switch backend := os.Getenv("RATE_LIMITER_BACKEND"); backend {
+	case "", "redis":
+		ctrl = notification.NewController(rlredis.New(client), cfgProvider, gateway).
+			WithLimiter(config.AlgorithmSlidingLog, rlredis.NewSlidingLog(client)).
+			WithLimiter(config.AlgorithmSlidingCounter, rlredis.NewSlidingCounter(client)).
+			WithLimiter(config.AlgorithmGCRA, rlredis.NewGCRA(client)).
+			WithAtomicLimiter(rlredis.NewRules(client)).
+			WithOverrides(overridesredis.New(client)).
+			WithDeferQueue(queueredis.New(client)).
+			WithDigests(digestredis.New(client)).
+			WithDedup(dedupredis.New(client))
+		// The in-app inbox lives in Redis, so it is only available with it.
+		inboxGateway = inbox.New(client)
+		ctrl.WithChannel(model.ChannelInApp, inboxGateway)
+		idempotencyStore = idempotencyredis.New(client)
+	case "memory":
+		rateLimiter := memory.New(memory.Options{})
+		defer rateLimiter.Close()
+
+		ctrl = notification.NewController(rateLimiter, cfgProvider, gateway).
+			WithAtomicLimiter(rateLimiter).
+			WithOverrides(overridesmemory.New()).
+			WithDeferQueue(queuememory.New()).
+			WithDigests(digestmemory.New()).
+			WithDedup(dedupmemory.New())
+		idempotencyStore = idempotencymemory.New()
+		for _, algorithm := range config.Algorithms {
+			ctrl.WithLimiter(algorithm, rateLimiter)
+		}
+	default:
+		panic(fmt.Sprintf("unknown RATE_LIMITER_BACKEND %q, expected redis or memory", backend))
+	}
+	ctrl.WithChannel(model.ChannelEmail, gateway).WithChannel(model.ChannelSMS, sms.New(defaultLogger))
+	if webhookGateway != nil {
+		ctrl.WithChannel(model.ChannelWebhook, webhookGateway)
+	}
+	// Notifications of types that defer instead of rejecting, and digests,
+	// are sent from here once their quota frees up.
+	go ctrl.DrainDeferred(ctx, deferredPollInterval)
+
+	// ADMIN_TOKEN is the bearer token of the /admin routes, they are disabled
+	// without one.
+	api := api.New(defaultLogger, client, ctrl).
+		WithAdminToken(os.Getenv("ADMIN_TOKEN")).
+		WithIdempotency(idempotencyStore, idempotencyTTL)
+	if inboxGateway != nil {
+		api.WithInbox(inboxGateway)
+	}
 
 	defaultLogger.Info("Starting app")
 	panic(api.Start())
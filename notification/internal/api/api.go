@@ -1,12 +1,21 @@
 package api
 
 import (
+	"context"
+	"crypto/subtle"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/inbox"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -16,6 +25,32 @@ type Application struct {
 	Router      *chi.Mux
 	RedisClient *redis.Client
 	ctrl        *notification.Controller
+	adminToken  string
+	inbox       inboxReader
+
+	idempotency      idempotency.Store
+	idempotencyTTL   time.Duration
+	idempotencyLease time.Duration
+}
+
+type inboxReader interface {
+	// List returns up to limit notifications of the inbox of userID, the
+	// newest first.
+	List(ctx context.Context, userID uuid.UUID, limit int) ([]inbox.Item, error)
+}
+
+// WithAdminToken sets the bearer token the /admin routes require, they are
+// refused while it is empty. It returns the Application for chaining.
+func (api *Application) WithAdminToken(token string) *Application {
+	api.adminToken = token
+	return api
+}
+
+// WithInbox makes the in-app inbox of every recipient readable from
+// /notify/inbox and returns the Application for chaining.
+func (api *Application) WithInbox(inbox inboxReader) *Application {
+	api.inbox = inbox
+	return api
 }
 
 // New creates a HTTP Application for notification service
@@ -35,12 +70,66 @@ func (api *Application) bindRoutes() http.Handler {
 	// Network, therefore we are *NOT* dealing with authentication on this api.
 	// focusing on the rate-limiting when messaging.
 	api.Router.Route("/notify", func(r chi.Router) {
-		r.Post("/send", http.HandlerFunc(api.handleSendNotification))
+		r.Use(api.withTypeRegistry)
+		r.With(api.withIdempotency).Post("/send", http.HandlerFunc(api.handleSendNotification))
+		r.With(api.withIdempotency).Post("/send/batch", http.HandlerFunc(api.handleSendBatch))
+		r.Get("/inbox/{userId}", http.HandlerFunc(api.handleListInbox))
+		r.Get("/quota/{userId}", http.HandlerFunc(api.handleGetQuota))
+	})
+
+	// The admin routes change how every recipient is rate-limited, so unlike
+	// the notify ones they require the admin token.
+	api.Router.Route("/admin", func(r chi.Router) {
+		r.Use(api.requireAdminToken)
+
+		r.Route("/limits", func(r chi.Router) {
+			r.Get("/", http.HandlerFunc(api.handleListLimits))
+			r.Get("/history", http.HandlerFunc(api.handleListLimitsHistory))
+			r.Post("/rollback/{version}", http.HandlerFunc(api.handleRollbackLimits))
+			r.Get("/{notificationType}", http.HandlerFunc(api.handleGetLimit))
+			r.Post("/{notificationType}", http.HandlerFunc(api.handleCreateLimit))
+			r.Put("/{notificationType}", http.HandlerFunc(api.handleUpdateLimit))
+			r.Delete("/{notificationType}", http.HandlerFunc(api.handleDeleteLimit))
+		})
+
+		r.Route("/overrides/{userId}", func(r chi.Router) {
+			r.Get("/", http.HandlerFunc(api.handleListOverrides))
+			r.Put("/{notificationType}", http.HandlerFunc(api.handleSetOverride))
+			r.Delete("/{notificationType}", http.HandlerFunc(api.handleDeleteOverride))
+		})
 	})
 
 	return api.Router
 }
 
+// withTypeRegistry makes request validation accept the notification types
+// configured in the Controller instead of the builtin ones.
+func (api *Application) withTypeRegistry(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(model.WithTypeRegistry(r.Context(), api.ctrl)))
+	})
+}
+
+// requireAdminToken refuses requests without the admin bearer token.
+func (api *Application) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.adminToken == "" {
+			jsonvalidator.EncodeJson(w, r, http.StatusForbidden,
+				map[string]any{"message": "the admin api is disabled"})
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(api.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			jsonvalidator.EncodeJson(w, r, http.StatusUnauthorized,
+				map[string]any{"message": "a valid admin token is required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Start starts the Application on port 8080 and returns an error, if occurs
 func (api *Application) Start() error {
 	if err := http.ListenAndServe(":8080", api.bindRoutes()); err != nil {
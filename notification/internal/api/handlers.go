@@ -1,10 +1,16 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
@@ -18,27 +24,235 @@ func (api *Application) handleSendNotification(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = api.ctrl.Send(r.Context(), data.UserID, data.NotificationType, data.Message)
+	result, err := api.ctrl.Send(r.Context(), data)
+	setRateLimitHeaders(w, time.Now(), result.Quotas)
+	var rateLimitErr *ratelimit.LimitExceededError
+	if errors.As(err, &rateLimitErr) {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", rateLimitErr.RetryAfter.Seconds()))
+	}
+
+	status, body := api.sendResponse(data, result, err)
+	jsonvalidator.EncodeJson(w, r, status, body)
+}
+
+// sendResponse returns the status and the body answering the send of n, which
+// ended with result and err.
+func (api *Application) sendResponse(n model.Notification, result notification.Result, err error) (int, map[string]any) {
 	if err != nil {
 		var rateLimitErr *ratelimit.LimitExceededError
 		if errors.As(err, &rateLimitErr) {
-			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", rateLimitErr.RetryAfter.Seconds()))
-			jsonvalidator.EncodeJson(w, r, http.StatusTooManyRequests,
-				map[string]any{"message": "too many messages of that type sent"})
+			if errors.Is(err, notification.ErrQuietHours) {
+				return http.StatusTooManyRequests,
+					map[string]any{"message": "this notification type cannot be sent during the recipient's quiet hours"}
+			}
+			if errors.Is(err, notification.ErrRecipientCapExceeded) {
+				return http.StatusTooManyRequests,
+					map[string]any{"message": "too many messages sent to this recipient"}
+			}
+			return http.StatusTooManyRequests,
+				map[string]any{"message": "too many messages of that type sent"}
+		}
+		if errors.Is(err, notification.ErrUnsupportedChannel) {
+			return http.StatusBadRequest,
+				map[string]any{"channel": "this channel is not enabled"}
+		}
+		if errors.Is(err, notification.ErrDeliveryFailed) {
+			api.Logger.Error("failed to deliver message", "err", err, "user-id", n.UserID, "notification-type", n.NotificationType)
+			return http.StatusBadGateway,
+				map[string]any{"message": "failed to deliver message, try again later"}
+		}
+		if errors.Is(err, notification.ErrUnknowNotificationType) {
+			api.Logger.Error("unknown message sent", "body", n)
+			return http.StatusInternalServerError,
+				map[string]any{"message": "this notification type handler was not found"}
+		}
+		api.Logger.Error("unknown error", "err", err, "body", n)
+		return http.StatusInternalServerError,
+			map[string]any{"message": "failed to send message with unknown error, try again later"}
+	}
+
+	switch result.Status {
+	case notification.StatusDeferred:
+		return http.StatusAccepted,
+			map[string]any{"message": "Message Scheduled", "scheduledAt": result.ScheduledAt}
+	case notification.StatusDigested:
+		return http.StatusAccepted,
+			map[string]any{"message": "Message Added To Digest", "scheduledAt": result.ScheduledAt}
+	case notification.StatusDuplicate:
+		return http.StatusOK,
+			map[string]any{"message": "Duplicate Message Suppressed"}
+	}
+
+	return http.StatusCreated,
+		map[string]any{"message": "Message Sent"}
+}
+
+// maxBatchSize bounds how many notifications a single batch sends.
+const maxBatchSize = 1000
+
+// handleSendBatch sends a list of notifications at once. Each of them is
+// answered in the results, in order, with the status and the body
+// /notify/send would have answered it with: the problems of the invalid ones,
+// the retryAfter, in seconds, of the rate-limited ones.
+func (api *Application) handleSendBatch(w http.ResponseWriter, r *http.Request) {
+	items, err := jsonvalidator.DecodeJson[[]json.RawMessage](r)
+	if err != nil {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]any{"message": "the body must be a list of notifications"})
+		return
+	}
+	if len(items) == 0 || len(items) > maxBatchSize {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]any{"message": fmt.Sprintf("a batch must hold between 1 and %d notifications", maxBatchSize)})
+		return
+	}
+
+	results := make([]map[string]any, len(items))
+	var (
+		notifications []model.Notification
+		indexes       []int
+	)
+	for i, item := range items {
+		n, problems, err := jsonvalidator.DecodeValidJsonFromBytes[model.Notification](r.Context(), item)
+		if err != nil {
+			if problems == nil {
+				problems = map[string]string{"notification": "must be a valid notification object"}
+			}
+			results[i] = map[string]any{"status": http.StatusBadRequest, "problems": problems}
+			continue
+		}
+		notifications = append(notifications, n)
+		indexes = append(indexes, i)
+	}
+
+	sent, errs := api.ctrl.SendBatch(r.Context(), notifications)
+	for j, i := range indexes {
+		status, body := api.sendResponse(notifications[j], sent[j], errs[j])
+		if status == http.StatusBadRequest {
+			body = map[string]any{"problems": body}
+		}
+		body["status"] = status
+		var rateLimitErr *ratelimit.LimitExceededError
+		if errors.As(errs[j], &rateLimitErr) {
+			body["retryAfter"] = math.Ceil(rateLimitErr.RetryAfter.Seconds())
+		}
+		results[i] = body
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusMultiStatus,
+		map[string]any{"results": results})
+}
+
+// defaultInboxLimit and maxInboxLimit bound how many notifications of an
+// inbox are listed at once.
+const (
+	defaultInboxLimit = 20
+	maxInboxLimit     = 100
+)
+
+func (api *Application) handleListInbox(w http.ResponseWriter, r *http.Request) {
+	if api.inbox == nil {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotImplemented,
+			map[string]any{"message": "the in-app inbox is not enabled"})
+		return
+	}
+
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultInboxLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxInboxLimit {
+			jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+				map[string]string{"limit": fmt.Sprintf("must be between 1 and %d", maxInboxLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	items, err := api.inbox.List(r.Context(), userID, limit)
+	if err != nil {
+		api.Logger.Error("failed to list inbox", "err", err, "user-id", userID)
+		jsonvalidator.EncodeJson(w, r, http.StatusInternalServerError,
+			map[string]any{"message": "failed to list inbox with unknown error, try again later"})
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK,
+		map[string]any{"userId": userID, "notifications": items})
+}
+
+// ruleQuota is how much of a rule a recipient used.
+type ruleQuota struct {
+	Rule      config.RLConfig `json:"rule"`
+	Limit     int             `json:"limit"`
+	Used      int             `json:"used"`
+	Remaining int             `json:"remaining"`
+	ResetAt   time.Time       `json:"resetAt"`
+}
+
+// quota is how much of a set of rules a recipient used: every one of them,
+// along with the most restrictive one, i.e. the one with the fewest requests
+// remaining, when there are any.
+type quota struct {
+	Unlimited bool `json:"unlimited"`
+	*ruleQuota
+	Rules []ruleQuota `json:"rules"`
+}
+
+func newQuota(quotas []notification.Quota) quota {
+	q := quota{Unlimited: len(quotas) == 0, Rules: make([]ruleQuota, len(quotas))}
+	for i, rq := range quotas {
+		q.Rules[i] = ruleQuota{Rule: rq.Rule, Limit: rq.Limit, Used: rq.Used, Remaining: rq.Remaining, ResetAt: rq.ResetAt}
+	}
+	if restrictive := mostRestrictive(quotas); restrictive != -1 {
+		q.ruleQuota = &q.Rules[restrictive]
+	}
+	return q
+}
+
+func (api *Application) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	channel := model.Channel(r.URL.Query().Get("channel"))
+	if channel != "" && !slices.Contains(model.Channels, channel) {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]string{"channel": fmt.Sprintf("must be one of %v", model.Channels)})
+		return
+	}
+	var types []model.NotificationType
+	if notificationType := r.URL.Query().Get("type"); notificationType != "" {
+		types = append(types, model.NotificationType(notificationType))
+	}
+
+	usage, err := api.ctrl.Quotas(r.Context(), userID, channel, types...)
+	if err != nil {
+		if errors.Is(err, notification.ErrUnsupportedChannel) {
+			jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+				map[string]any{"channel": "this channel is not enabled"})
 			return
 		}
 		if errors.Is(err, notification.ErrUnknowNotificationType) {
-			api.Logger.Error("unknown message sent", "body", data)
-			jsonvalidator.EncodeJson(w, r, http.StatusInternalServerError,
-				map[string]any{"message": "this notification type handler was not found"})
+			jsonvalidator.EncodeJson(w, r, http.StatusNotFound,
+				map[string]any{"message": "this notification type was not found"})
 			return
 		}
-		api.Logger.Error("unknown error", "err", err, "body", data)
+		api.Logger.Error("failed to read quotas", "err", err, "user-id", userID)
 		jsonvalidator.EncodeJson(w, r, http.StatusInternalServerError,
-			map[string]any{"message": "failed to send message with unknown error, try again later"})
+			map[string]any{"message": "failed to read quotas with unknown error, try again later"})
 		return
 	}
 
-	jsonvalidator.EncodeJson(w, r, http.StatusCreated,
-		map[string]any{"message": "Message Sent"})
+	quotas := make(map[model.NotificationType]quota, len(usage.Types))
+	for notificationType, q := range usage.Types {
+		quotas[notificationType] = newQuota(q)
+	}
+	jsonvalidator.EncodeJson(w, r, http.StatusOK,
+		map[string]any{"userId": userID, "channel": channel, "quotas": quotas, "global": newQuota(usage.Global)})
 }
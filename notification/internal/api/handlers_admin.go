@@ -0,0 +1,230 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (api *Application) handleListOverrides(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	overrides, err := api.ctrl.ListOverrides(r.Context(), userID)
+	if err != nil {
+		api.handleOverrideError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK,
+		map[string]any{"userId": userID, "overrides": overrides})
+}
+
+func (api *Application) handleSetOverride(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	override, problems, err := jsonvalidator.DecodeValidJson[config.Override](r)
+	if err != nil {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+
+	notificationType := model.NotificationType(chi.URLParam(r, "notificationType"))
+	if err := api.ctrl.SetOverride(r.Context(), userID, notificationType, override); err != nil {
+		api.handleOverrideError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK, override)
+}
+
+func (api *Application) handleDeleteOverride(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	notificationType := model.NotificationType(chi.URLParam(r, "notificationType"))
+	if err := api.ctrl.DeleteOverride(r.Context(), userID, notificationType); err != nil {
+		api.handleOverrideError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *Application) handleOverrideError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, notification.ErrOverridesDisabled) {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotImplemented,
+			map[string]any{"message": "per-recipient overrides are not enabled"})
+		return
+	}
+	if errors.Is(err, notification.ErrUnknowNotificationType) {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotFound,
+			map[string]any{"message": "this notification type was not found"})
+		return
+	}
+	api.Logger.Error("unknown error", "err", err, "path", r.URL.Path)
+	jsonvalidator.EncodeJson(w, r, http.StatusInternalServerError,
+		map[string]any{"message": "failed to manage overrides with unknown error, try again later"})
+}
+
+// parseUserID reads the userId URL parameter, answering with a 400 when it is
+// not a valid uuid.
+func parseUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]string{"userId": "must be a valid uuid"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func (api *Application) handleListLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := api.ctrl.Limits()
+	if err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK, limits)
+}
+
+func (api *Application) handleGetLimit(w http.ResponseWriter, r *http.Request) {
+	limits, err := api.ctrl.Limits()
+	if err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	cfg, ok := limits.Types[model.NotificationType(chi.URLParam(r, "notificationType"))]
+	if !ok {
+		api.handleLimitError(w, r, notification.ErrUnknowNotificationType)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK, cfg)
+}
+
+func (api *Application) handleCreateLimit(w http.ResponseWriter, r *http.Request) {
+	cfg, problems, err := jsonvalidator.DecodeValidJson[config.TypeConfig](r)
+	if err != nil {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+
+	notificationType := model.NotificationType(chi.URLParam(r, "notificationType"))
+	if err := api.ctrl.CreateTypeConfig(r.Context(), notificationType, cfg); err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusCreated, cfg)
+}
+
+func (api *Application) handleUpdateLimit(w http.ResponseWriter, r *http.Request) {
+	cfg, problems, err := jsonvalidator.DecodeValidJson[config.TypeConfig](r)
+	if err != nil {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+
+	notificationType := model.NotificationType(chi.URLParam(r, "notificationType"))
+	if err := api.ctrl.UpdateTypeConfig(r.Context(), notificationType, cfg); err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK, cfg)
+}
+
+func (api *Application) handleDeleteLimit(w http.ResponseWriter, r *http.Request) {
+	notificationType := model.NotificationType(chi.URLParam(r, "notificationType"))
+	if err := api.ctrl.DeleteTypeConfig(r.Context(), notificationType); err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *Application) handleListLimitsHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := api.ctrl.LimitsHistory(r.Context())
+	if err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK, map[string]any{"versions": history})
+}
+
+func (api *Application) handleRollbackLimits(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil || version <= 0 {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]string{"version": "must be a positive integer"})
+		return
+	}
+
+	version, err = api.ctrl.RollbackLimits(r.Context(), version)
+	if err != nil {
+		api.handleLimitError(w, r, err)
+		return
+	}
+
+	jsonvalidator.EncodeJson(w, r, http.StatusOK, map[string]any{"version": version})
+}
+
+func (api *Application) handleLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *config.InvalidLimitsError
+	if errors.As(err, &invalid) {
+		jsonvalidator.EncodeJson(w, r, http.StatusBadRequest, invalid.Problems)
+		return
+	}
+	if errors.Is(err, notification.ErrConfigReadOnly) {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotImplemented,
+			map[string]any{"message": "the rate-limit config cannot be changed at runtime"})
+		return
+	}
+	if errors.Is(err, notification.ErrUnknowNotificationType) {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotFound,
+			map[string]any{"message": "this notification type was not found"})
+		return
+	}
+	if errors.Is(err, notification.ErrConfigUnversioned) {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotFound,
+			map[string]any{"message": "the rate-limit config keeps no previous versions"})
+		return
+	}
+	if errors.Is(err, config.ErrUnknownVersion) {
+		jsonvalidator.EncodeJson(w, r, http.StatusNotFound,
+			map[string]any{"message": "this version of the rate-limit config was not found"})
+		return
+	}
+	if errors.Is(err, notification.ErrNotificationTypeExists) {
+		jsonvalidator.EncodeJson(w, r, http.StatusConflict,
+			map[string]any{"message": "this notification type already exists"})
+		return
+	}
+	if errors.Is(err, config.ErrVersionConflict) {
+		jsonvalidator.EncodeJson(w, r, http.StatusConflict,
+			map[string]any{"message": "the rate-limit config was changed concurrently, try again"})
+		return
+	}
+	api.Logger.Error("unknown error", "err", err, "path", r.URL.Path)
+	jsonvalidator.EncodeJson(w, r, http.StatusInternalServerError,
+		map[string]any{"message": "failed to manage rate limits with unknown error, try again later"})
+}
@@ -0,0 +1,602 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/overrides/memory"
+	rlmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func newOverridesTestApp(t *testing.T) http.Handler {
+	t.Helper()
+
+	rateLimiter := rlmemory.New(rlmemory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	ctrl := notification.NewController(rateLimiter, newMockConfigProvider(), &mockGateway{}).
+		WithOverrides(memory.New())
+	return New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(testAdminToken).bindRoutes()
+}
+
+const testAdminToken = "test-admin-token"
+
+// doRequest serves a request through every route and middleware, as the admin.
+func doRequest(handler http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func sendTo(handler http.Handler, userID uuid.UUID, notificationType model.NotificationType) *httptest.ResponseRecorder {
+	return doRequest(handler, http.MethodPost, "/notify/send", model.Notification{
+		UserID:           userID,
+		NotificationType: notificationType,
+		Message:          "This is a valid test message that is long enough",
+	})
+}
+
+func TestAdminOverrides_CRUD(t *testing.T) {
+	app := newOverridesTestApp(t)
+	userID := uuid.New()
+	base := "/admin/overrides/" + userID.String()
+
+	w := doRequest(app, http.MethodPut, base+"/"+string(model.NotificationTypeStatus),
+		config.Override{Rules: config.Rules{{Limit: 5, WindowSize: 60}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = doRequest(app, http.MethodPut, base+"/"+string(model.NotificationTypeNews), config.Override{Unlimited: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, base, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var listed struct {
+		UserID    uuid.UUID                                  `json:"userId"`
+		Overrides map[model.NotificationType]config.Override `json:"overrides"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if listed.UserID != userID || len(listed.Overrides) != 2 {
+		t.Errorf("Expected 2 overrides for %s, got %+v", userID, listed)
+	}
+
+	w = doRequest(app, http.MethodDelete, base+"/"+string(model.NotificationTypeStatus), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, base, nil)
+	listed.Overrides = nil
+	json.NewDecoder(w.Body).Decode(&listed)
+	if _, ok := listed.Overrides[model.NotificationTypeStatus]; ok || len(listed.Overrides) != 1 {
+		t.Errorf("Expected only the news override to remain, got %+v", listed.Overrides)
+	}
+}
+
+func TestAdminOverrides_Errors(t *testing.T) {
+	app := newOverridesTestApp(t)
+	base := "/admin/overrides/" + uuid.NewString()
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           any
+		expectedStatus int
+	}{
+		{
+			name:           "Invalid user id",
+			method:         http.MethodGet,
+			path:           "/admin/overrides/not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown notification type",
+			method:         http.MethodPut,
+			path:           base + "/unknown-notification",
+			body:           config.Override{Unlimited: true},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid override",
+			method:         http.MethodPut,
+			path:           base + "/" + string(model.NotificationTypeStatus),
+			body:           config.Override{Rules: config.Rules{{Limit: 5}}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Empty override",
+			method:         http.MethodPut,
+			path:           base + "/" + string(model.NotificationTypeStatus),
+			body:           map[string]any{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doRequest(app, tc.method, tc.path, tc.body)
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminOverrides_Disabled(t *testing.T) {
+	ctrl := notification.NewController(&mockRateLimiter{}, newMockConfigProvider(), &mockGateway{})
+	app := New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(testAdminToken).bindRoutes()
+
+	w := doRequest(app, http.MethodGet, "/admin/overrides/"+uuid.NewString(), nil)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status code %d, got %d. Body: %s", http.StatusNotImplemented, w.Code, w.Body.String())
+	}
+}
+
+func TestHandleSendNotification_UsesRecipientOverride(t *testing.T) {
+	app := newOverridesTestApp(t)
+	vip, qa, regular := uuid.New(), uuid.New(), uuid.New()
+
+	// Status allows 2 per minute by default.
+	doRequest(app, http.MethodPut, "/admin/overrides/"+vip.String()+"/"+string(model.NotificationTypeStatus),
+		config.Override{Rules: config.Rules{{Limit: 4, WindowSize: 60}}})
+	doRequest(app, http.MethodPut, "/admin/overrides/"+qa.String()+"/"+string(model.NotificationTypeStatus),
+		config.Override{Unlimited: true})
+
+	count := func(userID uuid.UUID) int {
+		sent := 0
+		for range 10 {
+			if w := sendTo(app, userID, model.NotificationTypeStatus); w.Code == http.StatusCreated {
+				sent++
+			}
+		}
+		return sent
+	}
+
+	if sent := count(regular); sent != 2 {
+		t.Errorf("Expected the default rule to allow 2 sends, got %d", sent)
+	}
+	if sent := count(vip); sent != 4 {
+		t.Errorf("Expected the override to allow 4 sends, got %d", sent)
+	}
+	if sent := count(qa); sent != 10 {
+		t.Errorf("Expected an unlimited recipient to get every send, got %d", sent)
+	}
+
+	// Other types of an overridden recipient keep their configured rules.
+	sendTo(app, vip, model.NotificationTypeNews)
+	if w := sendTo(app, vip, model.NotificationTypeNews); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected news to keep its default rule, got %d", w.Code)
+	}
+
+	// Removing the override restores the default rule. Unlimited sends were
+	// not counted, so the recipient starts with a full quota.
+	doRequest(app, http.MethodDelete, "/admin/overrides/"+qa.String()+"/"+string(model.NotificationTypeStatus), nil)
+	if sent := count(qa); sent != 2 {
+		t.Errorf("Expected the default rule once the override is removed, got %d sends", sent)
+	}
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	ctrl := notification.NewController(&mockRateLimiter{}, newMockConfigProvider(), &mockGateway{})
+
+	testCases := []struct {
+		name           string
+		adminToken     string
+		authorization  string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing token",
+			adminToken:     testAdminToken,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong token",
+			adminToken:     testAdminToken,
+			authorization:  "Bearer not-the-admin-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Not a bearer token",
+			adminToken:     testAdminToken,
+			authorization:  testAdminToken,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Admin api disabled",
+			authorization:  "Bearer " + testAdminToken,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(tc.adminToken).bindRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/limits", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func newLimitsTestApp(t *testing.T) http.Handler {
+	t.Helper()
+
+	rateLimiter := rlmemory.New(rlmemory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Groups: map[string]config.Rules{"promotional": {{Limit: 3, WindowSize: 3600}}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews:      {Rules: config.Rules{{Limit: 1, WindowSize: 86400}}},
+			model.NotificationTypeMarketing: {Group: "promotional"},
+		},
+	})
+	ctrl := notification.NewController(rateLimiter, provider, &mockGateway{})
+	return New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(testAdminToken).bindRoutes()
+}
+
+func TestAdminLimits_CRUD(t *testing.T) {
+	app := newLimitsTestApp(t)
+	const alerts = model.NotificationType("alerts")
+
+	w := doRequest(app, http.MethodPost, "/admin/limits/"+string(alerts),
+		config.TypeConfig{Rules: config.Rules{{Limit: 2, WindowSize: 60}}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/admin/limits/"+string(alerts), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var got config.TypeConfig
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(got.Rules) != 1 || got.Rules[0].Limit != 2 {
+		t.Errorf("Expected the created rules, got %+v", got)
+	}
+
+	w = doRequest(app, http.MethodPut, "/admin/limits/"+string(alerts), config.TypeConfig{Group: "promotional"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/admin/limits", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var limits config.Limits
+	if err := json.NewDecoder(w.Body).Decode(&limits); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(limits.Types) != 3 || limits.Types[alerts].Group != "promotional" {
+		t.Errorf("Expected alerts to share the promotional quota, got %+v", limits.Types)
+	}
+
+	w = doRequest(app, http.MethodDelete, "/admin/limits/"+string(alerts), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/admin/limits/"+string(alerts), nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d. Body: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
+
+func TestAdminLimits_Errors(t *testing.T) {
+	app := newLimitsTestApp(t)
+	news := "/admin/limits/" + string(model.NotificationTypeNews)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           any
+		expectedStatus int
+	}{
+		{
+			name:           "Create an existing type",
+			method:         http.MethodPost,
+			path:           news,
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Update an unknown type",
+			method:         http.MethodPut,
+			path:           "/admin/limits/unknown-notification",
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Delete an unknown type",
+			method:         http.MethodDelete,
+			path:           "/admin/limits/unknown-notification",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid rules",
+			method:         http.MethodPut,
+			path:           news,
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1}}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "No rules",
+			method:         http.MethodPut,
+			path:           news,
+			body:           map[string]any{"rules": []any{}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown group",
+			method:         http.MethodPut,
+			path:           news,
+			body:           config.TypeConfig{Group: "unknown-group"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Type named like the global cap",
+			method:         http.MethodPost,
+			path:           "/admin/limits/global",
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Type name with a key separator",
+			method:         http.MethodPost,
+			path:           "/admin/limits/alerts:urgent",
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Type name with a line break",
+			method:         http.MethodPost,
+			path:           "/admin/limits/alerts%0D%0ABcc:someone@example.com",
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Uppercase type name",
+			method:         http.MethodPost,
+			path:           "/admin/limits/Alerts",
+			body:           config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doRequest(app, tc.method, tc.path, tc.body)
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := doRequest(app, http.MethodGet, news, nil)
+	var got config.TypeConfig
+	json.NewDecoder(w.Body).Decode(&got)
+	if len(got.Rules) != 1 || got.Rules[0].Limit != 1 || got.Rules[0].WindowSize != 86400 {
+		t.Errorf("Expected rejected changes to keep the news rules, got %+v", got)
+	}
+}
+
+func TestAdminLimits_ReadOnly(t *testing.T) {
+	ctrl := notification.NewController(&mockRateLimiter{}, newMockConfigProvider(), &mockGateway{})
+	app := New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(testAdminToken).bindRoutes()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		w := doRequest(app, method, "/admin/limits/"+string(model.NotificationTypeNews),
+			config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}})
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("%s: expected status code %d, got %d. Body: %s", method, http.StatusNotImplemented, w.Code, w.Body.String())
+		}
+	}
+}
+
+// racingProvider is a config.WritableProvider whose Limits are changed right
+// after every read, as by another replica publishing concurrently.
+type racingProvider struct {
+	*config.RLConfigProvider
+}
+
+func (p racingProvider) Limits() (config.Limits, int64) {
+	limits, version := p.RLConfigProvider.Limits()
+	p.Store(limits)
+	return limits, version
+}
+
+func TestAdminLimits_VersionConflict(t *testing.T) {
+	provider := racingProvider{config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 86400}}},
+		},
+	})}
+	ctrl := notification.NewController(&mockRateLimiter{}, provider, &mockGateway{})
+	app := New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(testAdminToken).bindRoutes()
+
+	w := doRequest(app, http.MethodPut, "/admin/limits/"+string(model.NotificationTypeNews),
+		config.TypeConfig{Rules: config.Rules{{Limit: 5, WindowSize: 60}}})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d. Body: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	if cfg, _ := provider.GetConfig(model.NotificationTypeNews); cfg.Rules[0].Limit != 1 {
+		t.Errorf("Expected the conflicting change to be dropped, got %+v", cfg)
+	}
+}
+
+// versionedProvider is a config.VersionedProvider keeping every version in
+// memory, as the redis one keeps the last ones.
+type versionedProvider struct {
+	*config.RLConfigProvider
+	history []config.Version
+}
+
+func (p *versionedProvider) Update(ctx context.Context, version int64, limits config.Limits) error {
+	if err := p.RLConfigProvider.Update(ctx, version, limits); err != nil {
+		return err
+	}
+	limits, version = p.RLConfigProvider.Limits()
+	p.history = append(p.history, config.Version{Version: version, Limits: limits})
+	return nil
+}
+
+func (p *versionedProvider) History(_ context.Context) ([]config.Version, error) {
+	history := slices.Clone(p.history)
+	slices.Reverse(history)
+	return history, nil
+}
+
+func (p *versionedProvider) Rollback(ctx context.Context, version int64) (int64, error) {
+	for _, v := range p.history {
+		if v.Version == version {
+			_, current := p.Limits()
+			return current + 1, p.Update(ctx, current, v.Limits)
+		}
+	}
+	return 0, config.ErrUnknownVersion
+}
+
+func TestAdminLimits_History(t *testing.T) {
+	provider := &versionedProvider{RLConfigProvider: config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 86400}}},
+		},
+	})}
+	ctrl := notification.NewController(&mockRateLimiter{}, provider, &mockGateway{})
+	app := New(slog.Default(), &redis.Client{}, ctrl).WithAdminToken(testAdminToken).bindRoutes()
+	const alerts = model.NotificationType("alerts")
+
+	w := doRequest(app, http.MethodPost, "/admin/limits/"+string(alerts),
+		config.TypeConfig{Rules: config.Rules{{Limit: 2, WindowSize: 60}}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	w = doRequest(app, http.MethodPut, "/admin/limits/"+string(alerts),
+		config.TypeConfig{Rules: config.Rules{{Limit: 5, WindowSize: 60}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/admin/limits/history", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var history struct {
+		Versions []config.Version `json:"versions"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(history.Versions) != 2 || history.Versions[0].Version != 2 || history.Versions[1].Version != 1 {
+		t.Fatalf("Expected versions 2 and 1, newest first, got %+v", history.Versions)
+	}
+
+	w = doRequest(app, http.MethodPost, "/admin/limits/rollback/1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var rolledBack struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&rolledBack); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rolledBack.Version != 3 {
+		t.Errorf("Expected the rollback to be published as version 3, got %d", rolledBack.Version)
+	}
+	if cfg, _ := provider.GetConfig(alerts); cfg.Rules[0].Limit != 2 {
+		t.Errorf("Expected the rules of version 1 to be served again, got %+v", cfg)
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Unknown version", path: "/admin/limits/rollback/7", expectedStatus: http.StatusNotFound},
+		{name: "Invalid version", path: "/admin/limits/rollback/latest", expectedStatus: http.StatusBadRequest},
+		{name: "Negative version", path: "/admin/limits/rollback/-1", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doRequest(app, http.MethodPost, tc.path, nil)
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminLimits_Unversioned(t *testing.T) {
+	app := newLimitsTestApp(t)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/admin/limits/history"},
+		{http.MethodPost, "/admin/limits/rollback/1"},
+	} {
+		w := doRequest(app, req.method, req.path, nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected status code %d, got %d. Body: %s", req.method, req.path, http.StatusNotFound, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandleSendNotification_UsesCreatedLimit(t *testing.T) {
+	app := newLimitsTestApp(t)
+	const alerts = model.NotificationType("alerts")
+	userID := uuid.New()
+
+	if w := sendTo(app, userID, alerts); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected an unconfigured type to be rejected, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	w := doRequest(app, http.MethodPost, "/admin/limits/"+string(alerts),
+		config.TypeConfig{Rules: config.Rules{{Limit: 1, WindowSize: 60}}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	if w := sendTo(app, userID, alerts); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the created type to be sendable, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if w := sendTo(app, userID, alerts); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the created limit to be enforced, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
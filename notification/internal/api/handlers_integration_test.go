@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
@@ -68,14 +70,22 @@ func setupRedisContainer(t *testing.T) (*redisclient.Client, func()) {
 
 type realConfigProviderMock struct{}
 
-func (r *realConfigProviderMock) GetConfig(nt model.NotificationType) (config.RLConfig, bool) {
-	configs := map[model.NotificationType]config.RLConfig{
-		model.NotificationTypeNews:      {Limit: 1, WindowSize: 86400}, // 1 per day
-		model.NotificationTypeStatus:    {Limit: 2, WindowSize: 60},    // 2 per minute
-		model.NotificationTypeMarketing: {Limit: 3, WindowSize: 3600},  // 3 per hour
+func (r *realConfigProviderMock) GetConfig(nt model.NotificationType) (config.TypeConfig, bool) {
+	configs := map[model.NotificationType]config.Rules{
+		model.NotificationTypeNews:      {{Limit: 1, WindowSize: 86400}}, // 1 per day
+		model.NotificationTypeStatus:    {{Limit: 2, WindowSize: 60}},    // 2 per minute
+		model.NotificationTypeMarketing: {{Limit: 3, WindowSize: 3600}},  // 3 per hour
 	}
 	cfg, ok := configs[nt]
-	return cfg, ok
+	return config.TypeConfig{Rules: cfg}, ok
+}
+
+func (r *realConfigProviderMock) GetGlobalConfig() config.Rules {
+	return nil
+}
+
+func (r *realConfigProviderMock) NotificationTypes() []model.NotificationType {
+	return []model.NotificationType{model.NotificationTypeMarketing, model.NotificationTypeNews, model.NotificationTypeStatus}
 }
 
 func TestIntegrationNewsNotificationRateLimit(t *testing.T) {
@@ -85,7 +95,7 @@ func TestIntegrationNewsNotificationRateLimit(t *testing.T) {
 	logger := slog.Default()
 	rateLimiter := redis.New(redisClient)
 	configProvider := &realConfigProviderMock{}
-	ctrl := notification.NewController(rateLimiter, configProvider)
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	userID := uuid.New()
@@ -130,7 +140,7 @@ func TestIntegrationStatusNotificationRateLimit(t *testing.T) {
 	logger := slog.Default()
 	rateLimiter := redis.New(redisClient)
 	configProvider := &realConfigProviderMock{}
-	ctrl := notification.NewController(rateLimiter, configProvider)
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	userID := uuid.New()
@@ -171,7 +181,7 @@ func TestIntegrationMarketingNotificationRateLimit(t *testing.T) {
 	logger := slog.Default()
 	rateLimiter := redis.New(redisClient)
 	configProvider := &realConfigProviderMock{}
-	ctrl := notification.NewController(rateLimiter, configProvider)
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	userID := uuid.New()
@@ -212,7 +222,7 @@ func TestIntegrationMultipleUsersIsolatedRateLimits(t *testing.T) {
 	logger := slog.Default()
 	rateLimiter := redis.New(redisClient)
 	configProvider := &realConfigProviderMock{}
-	ctrl := notification.NewController(rateLimiter, configProvider)
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	user1 := uuid.New()
@@ -257,7 +267,7 @@ func TestIntegrationMixedNotificationTypesIndependentLimits(t *testing.T) {
 	logger := slog.Default()
 	rateLimiter := redis.New(redisClient)
 	configProvider := &realConfigProviderMock{}
-	ctrl := notification.NewController(rateLimiter, configProvider)
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	userID := uuid.New()
@@ -325,12 +335,12 @@ func TestIntegrationRateLimitWindowExpiration(t *testing.T) {
 
 	// Override config provider
 	shortWindowConfig := &testConfigProvider{
-		configs: map[model.NotificationType]config.RLConfig{
-			model.NotificationTypeStatus: {Limit: 1, WindowSize: 2}, // 1 per 2 seconds
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeStatus: {{Limit: 1, WindowSize: 2}}, // 1 per 2 seconds
 		},
 	}
 
-	ctrl := notification.NewController(rateLimiter, shortWindowConfig)
+	ctrl := notification.NewController(rateLimiter, shortWindowConfig, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	userID := uuid.New()
@@ -379,10 +389,19 @@ func TestIntegrationRateLimitWindowExpiration(t *testing.T) {
 }
 
 type testConfigProvider struct {
-	configs map[model.NotificationType]config.RLConfig
+	configs map[model.NotificationType]config.Rules
+	global  config.Rules
 }
 
-func (t *testConfigProvider) GetConfig(nt model.NotificationType) (config.RLConfig, bool) {
+func (t *testConfigProvider) GetConfig(nt model.NotificationType) (config.TypeConfig, bool) {
 	cfg, ok := t.configs[nt]
-	return cfg, ok
+	return config.TypeConfig{Rules: cfg}, ok
+}
+
+func (t *testConfigProvider) GetGlobalConfig() config.Rules {
+	return t.global
+}
+
+func (t *testConfigProvider) NotificationTypes() []model.NotificationType {
+	return slices.Sorted(maps.Keys(t.configs))
 }
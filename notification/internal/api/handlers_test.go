@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
@@ -15,6 +17,11 @@ import (
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+	dedupmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/dedup/memory"
+	digestmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/digest/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/gateway/inbox"
+	queuememory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/queue/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
 	"github.com/google/uuid"
@@ -22,31 +29,82 @@ import (
 )
 
 type mockRateLimiter struct {
-	isAllowedFunc func(ctx context.Context, key string, limit, windowSize int) (bool, error)
+	isAllowedFunc func(ctx context.Context, key string, cfg config.RLConfig) (bool, error)
+	refundFunc    func(ctx context.Context, key string, cfg config.RLConfig) error
+	peekFunc      func(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error)
 }
 
-func (m *mockRateLimiter) IsAllowed(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+func (m *mockRateLimiter) Peek(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+	if m.peekFunc != nil {
+		return m.peekFunc(ctx, key, cfg)
+	}
+	return ratelimit.NewUsage(cfg.Limit, 0, 0), nil
+}
+
+func (m *mockRateLimiter) Refund(ctx context.Context, key string, cfg config.RLConfig) error {
+	if m.refundFunc != nil {
+		return m.refundFunc(ctx, key, cfg)
+	}
+	return nil
+}
+
+// IsAllowed reports every request it allows as the first one of a fresh
+// window.
+func (m *mockRateLimiter) IsAllowed(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error) {
+	allowed := true
 	if m.isAllowedFunc != nil {
-		return m.isAllowedFunc(ctx, key, limit, windowSize)
+		var err error
+		if allowed, err = m.isAllowedFunc(ctx, key, cfg); err != nil {
+			var exceeded *ratelimit.LimitExceededError
+			if errors.As(err, &exceeded) {
+				return ratelimit.Deny(cfg.Limit, exceeded.RetryAfter), err
+			}
+			return ratelimit.Decision{}, err
+		}
+	}
+	if !allowed {
+		return ratelimit.Deny(cfg.Limit, 0), nil
 	}
-	return true, nil
+	return ratelimit.Allow(ratelimit.NewUsage(cfg.Limit, 1, time.Duration(cfg.WindowSize)*time.Second)), nil
+}
+
+type mockGateway struct {
+	sendFunc func(ctx context.Context, n model.Notification) error
+}
+
+func (m *mockGateway) Send(ctx context.Context, n model.Notification) error {
+	if m.sendFunc != nil {
+		return m.sendFunc(ctx, n)
+	}
+	return nil
 }
 
 type mockConfigProvider struct {
-	configs map[model.NotificationType]config.RLConfig
+	configs    map[model.NotificationType]config.Rules
+	groups     map[model.NotificationType]string
+	quietHours map[model.NotificationType]*config.QuietHours
+	global     config.Rules
 }
 
-func (m *mockConfigProvider) GetConfig(nt model.NotificationType) (config.RLConfig, bool) {
+func (m *mockConfigProvider) GetConfig(nt model.NotificationType) (config.TypeConfig, bool) {
 	cfg, ok := m.configs[nt]
-	return cfg, ok
+	return config.TypeConfig{Group: m.groups[nt], Rules: cfg, QuietHours: m.quietHours[nt]}, ok
+}
+
+func (m *mockConfigProvider) GetGlobalConfig() config.Rules {
+	return m.global
+}
+
+func (m *mockConfigProvider) NotificationTypes() []model.NotificationType {
+	return slices.Sorted(maps.Keys(m.configs))
 }
 
 func newMockConfigProvider() *mockConfigProvider {
 	return &mockConfigProvider{
-		configs: map[model.NotificationType]config.RLConfig{
-			model.NotificationTypeNews:      {Limit: 1, WindowSize: 86400},
-			model.NotificationTypeStatus:    {Limit: 2, WindowSize: 60},
-			model.NotificationTypeMarketing: {Limit: 3, WindowSize: 3600},
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeNews:      {{Limit: 1, WindowSize: 86400}},
+			model.NotificationTypeStatus:    {{Limit: 2, WindowSize: 60}},
+			model.NotificationTypeMarketing: {{Limit: 3, WindowSize: 3600}},
 		},
 	}
 }
@@ -56,13 +114,13 @@ func TestHandleSendNotification_ValidRequest(t *testing.T) {
 	redisClient := &redis.Client{}
 
 	mockRL := &mockRateLimiter{
-		isAllowedFunc: func(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
 			return true, nil // Allow request
 		},
 	}
 
 	configProvider := newMockConfigProvider()
-	ctrl := notification.NewController(mockRL, configProvider)
+	ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	validID := uuid.New()
@@ -169,10 +227,10 @@ func TestHandleSendNotification_UnknownNotificationType(t *testing.T) {
 	mockRL := &mockRateLimiter{}
 
 	emptyConfigProvider := &mockConfigProvider{
-		configs: map[model.NotificationType]config.RLConfig{},
+		configs: map[model.NotificationType]config.Rules{},
 	}
 
-	ctrl := notification.NewController(mockRL, emptyConfigProvider)
+	ctrl := notification.NewController(mockRL, emptyConfigProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	// Create notification with unconfigured type
@@ -214,13 +272,13 @@ func TestHandleSendNotification_RateLimiterError(t *testing.T) {
 	redisClient := &redis.Client{}
 
 	mockRL := &mockRateLimiter{
-		isAllowedFunc: func(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
 			return false, errors.New("redis connection error")
 		},
 	}
 
 	configProvider := newMockConfigProvider()
-	ctrl := notification.NewController(mockRL, configProvider)
+	ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	validID := uuid.New()
@@ -247,6 +305,50 @@ func TestHandleSendNotification_RateLimiterError(t *testing.T) {
 	}
 }
 
+func TestHandleSendNotification_GatewayError(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	var refunded []string
+	mockRL := &mockRateLimiter{
+		refundFunc: func(ctx context.Context, key string, cfg config.RLConfig) error {
+			refunded = append(refunded, key)
+			return nil
+		},
+	}
+	gateway := &mockGateway{
+		sendFunc: func(ctx context.Context, n model.Notification) error {
+			return errors.New("smtp server unavailable")
+		},
+	}
+
+	configProvider := newMockConfigProvider()
+	ctrl := notification.NewController(mockRL, configProvider, gateway)
+	app := New(logger, redisClient, ctrl)
+
+	jsonPayload, err := json.Marshal(model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	app.handleSendNotification(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d. Body: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+	if len(refunded) != 1 {
+		t.Errorf("Expected the consumed rule to be refunded, got %v", refunded)
+	}
+}
+
 func TestHandleSendNotification_AllNotificationTypes(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -263,13 +365,13 @@ func TestHandleSendNotification_AllNotificationTypes(t *testing.T) {
 			redisClient := &redis.Client{}
 
 			mockRL := &mockRateLimiter{
-				isAllowedFunc: func(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+				isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
 					return true, nil
 				},
 			}
 
 			configProvider := newMockConfigProvider()
-			ctrl := notification.NewController(mockRL, configProvider)
+			ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
 			app := New(logger, redisClient, ctrl)
 
 			validID := uuid.New()
@@ -375,13 +477,13 @@ func TestHandleSendNotification_RateLimitExceededWithRetryAfter(t *testing.T) {
 
 	retryAfterDuration := 45 * time.Second
 	mockRL := &mockRateLimiter{
-		isAllowedFunc: func(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
 			return false, ratelimit.NewLimitExceededError(retryAfterDuration, "rate limit exceeded")
 		},
 	}
 
 	configProvider := newMockConfigProvider()
-	ctrl := notification.NewController(mockRL, configProvider)
+	ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	validID := uuid.New()
@@ -443,13 +545,13 @@ func TestHandleSendNotification_RateLimitVariousRetryAfterValues(t *testing.T) {
 			redisClient := &redis.Client{}
 
 			mockRL := &mockRateLimiter{
-				isAllowedFunc: func(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+				isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
 					return false, ratelimit.NewLimitExceededError(tc.retryAfter, "rate limit exceeded")
 				},
 			}
 
 			configProvider := newMockConfigProvider()
-			ctrl := notification.NewController(mockRL, configProvider)
+			ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
 			app := New(logger, redisClient, ctrl)
 
 			validID := uuid.New()
@@ -482,18 +584,1220 @@ func TestHandleSendNotification_RateLimitVariousRetryAfterValues(t *testing.T) {
 	}
 }
 
+func TestHandleSendNotification_SelectsLimiterByAlgorithm(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	fixedRL := &mockRateLimiter{
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
+			t.Error("fixed-window limiter must not be used for a sliding_log rule")
+			return true, nil
+		},
+	}
+	slidingCalls := 0
+	slidingRL := &mockRateLimiter{
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
+			slidingCalls++
+			return true, nil
+		},
+	}
+
+	configProvider := &mockConfigProvider{
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeStatus: {{Algorithm: config.AlgorithmSlidingLog, Limit: 2, WindowSize: 60}},
+		},
+	}
+
+	payload := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "This is a valid test message that is long enough",
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	t.Run("registered algorithm", func(t *testing.T) {
+		ctrl := notification.NewController(fixedRL, configProvider, &mockGateway{}).
+			WithLimiter(config.AlgorithmSlidingLog, slidingRL)
+		app := New(logger, redisClient, ctrl)
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("Expected status code %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		if slidingCalls != 1 {
+			t.Errorf("Expected sliding-log limiter to be called once, got %d", slidingCalls)
+		}
+	})
+
+	t.Run("unregistered algorithm", func(t *testing.T) {
+		ctrl := notification.NewController(fixedRL, configProvider, &mockGateway{})
+		app := New(logger, redisClient, ctrl)
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d. Body: %s", http.StatusInternalServerError, w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestHandleSendNotification_MemoryRateLimiter(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	rateLimiter := memory.New(memory.Options{})
+	defer rateLimiter.Close()
+
+	ctrl := notification.NewController(rateLimiter, newMockConfigProvider(), &mockGateway{})
+	app := New(logger, redisClient, ctrl)
+
+	payload := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "This is a valid test message that is long enough",
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	// Status allows 2 per minute.
+	expected := []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests}
+	for i, code := range expected {
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != code {
+			t.Errorf("Request %d: expected status code %d, got %d. Body: %s", i+1, code, w.Code, w.Body.String())
+		}
+		if code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("Expected Retry-After header on rate-limited response")
+		}
+	}
+}
+
+func TestHandleSendNotification_StackedRules(t *testing.T) {
+	minute := config.RLConfig{Limit: 2, WindowSize: 60}
+	day := config.RLConfig{Limit: 20, WindowSize: 86400}
+	hour := config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 5, WindowSize: 3600}
+
+	testCases := []struct {
+		name           string
+		results        map[int]error // by WindowSize, nil means allowed
+		expectedStatus int
+		expectedRetry  string
+		expectRefunded []int // WindowSize of the rules expected to be refunded
+	}{
+		{
+			name:           "every rule allows",
+			results:        map[int]error{60: nil, 3600: nil, 86400: nil},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "one rule denies",
+			results: map[int]error{
+				60:    nil,
+				3600:  ratelimit.NewLimitExceededError(30*time.Second, "rate limit exceeded"),
+				86400: nil,
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedRetry:  "30",
+			expectRefunded: []int{60, 86400},
+		},
+		{
+			name: "longest retry-after wins",
+			results: map[int]error{
+				60:    ratelimit.NewLimitExceededError(10*time.Second, "rate limit exceeded"),
+				3600:  nil,
+				86400: ratelimit.NewLimitExceededError(5*time.Hour, "rate limit exceeded"),
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedRetry:  "18000",
+			expectRefunded: []int{3600},
+		},
+		{
+			name: "limiter failure refunds what was consumed",
+			results: map[int]error{
+				60:    nil,
+				3600:  errors.New("redis connection error"),
+				86400: nil,
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectRefunded: []int{60},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := slog.Default()
+			redisClient := &redis.Client{}
+
+			var refunded []int
+			keys := map[string]bool{}
+			mockRL := &mockRateLimiter{
+				isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
+					keys[key] = true
+					err := tc.results[cfg.WindowSize]
+					return err == nil, err
+				},
+				refundFunc: func(ctx context.Context, key string, cfg config.RLConfig) error {
+					refunded = append(refunded, cfg.WindowSize)
+					return nil
+				},
+			}
+
+			configProvider := &mockConfigProvider{
+				configs: map[model.NotificationType]config.Rules{
+					model.NotificationTypeStatus: {minute, hour, day},
+				},
+			}
+			ctrl := notification.NewController(mockRL, configProvider, &mockGateway{}).
+				WithLimiter(config.AlgorithmSlidingLog, mockRL)
+			app := New(logger, redisClient, ctrl)
+
+			jsonPayload, err := json.Marshal(model.Notification{
+				UserID:           uuid.New(),
+				NotificationType: model.NotificationTypeStatus,
+				Message:          "This is a valid test message that is long enough",
+			})
+			if err != nil {
+				t.Fatalf("Failed to marshal notification: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+			w := httptest.NewRecorder()
+			app.handleSendNotification(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tc.expectedRetry {
+				t.Errorf("Expected Retry-After header '%s', got '%s'", tc.expectedRetry, retryAfter)
+			}
+			if !slices.Equal(refunded, tc.expectRefunded) {
+				t.Errorf("Expected refunded rules %v, got %v", tc.expectRefunded, refunded)
+			}
+			if tc.expectedStatus != http.StatusInternalServerError && len(keys) != 3 {
+				t.Errorf("Expected every rule to use its own key, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestHandleSendNotification_StackedRulesWithMemoryRateLimiter(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rateLimiter := memory.New(memory.Options{Clock: func() time.Time { return now }})
+	defer rateLimiter.Close()
+
+	// 2 per minute and 3 per hour.
+	configProvider := &mockConfigProvider{
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeStatus: {
+				{Limit: 2, WindowSize: 60},
+				{Limit: 3, WindowSize: 3600},
+			},
+		},
+	}
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
+	app := New(logger, redisClient, ctrl)
+
+	jsonPayload, err := json.Marshal(model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "This is a valid test message that is long enough",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	steps := []struct {
+		advance        time.Duration
+		expectedStatus int
+		expectedRetry  string
+	}{
+		{0, http.StatusCreated, ""},
+		{0, http.StatusCreated, ""},
+		{0, http.StatusTooManyRequests, "60"},
+		{time.Minute, http.StatusCreated, ""},
+		// Denied by the hourly rule: the minute rule must not be charged for it.
+		{0, http.StatusTooManyRequests, "3540"},
+		{0, http.StatusTooManyRequests, "3540"},
+		{time.Hour, http.StatusCreated, ""},
+		{0, http.StatusCreated, ""},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != step.expectedStatus {
+			t.Errorf("Step %d: expected status code %d, got %d. Body: %s", i, step.expectedStatus, w.Code, w.Body.String())
+		}
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != step.expectedRetry {
+			t.Errorf("Step %d: expected Retry-After header '%s', got '%s'", i, step.expectedRetry, retryAfter)
+		}
+	}
+}
+
+func TestHandleSendNotification_GlobalCap(t *testing.T) {
+	typeDenied := ratelimit.NewLimitExceededError(10*time.Second, "rate limit exceeded")
+	globalDenied := ratelimit.NewLimitExceededError(time.Hour, "rate limit exceeded")
+
+	testCases := []struct {
+		name            string
+		typeErr         error
+		globalErr       error
+		expectedStatus  int
+		expectedRetry   string
+		expectedMessage string
+	}{
+		{
+			name:            "both allow",
+			expectedStatus:  http.StatusCreated,
+			expectedMessage: "Message Sent",
+		},
+		{
+			name:            "type limit reached",
+			typeErr:         typeDenied,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedRetry:   "10",
+			expectedMessage: "too many messages of that type sent",
+		},
+		{
+			name:            "global cap reached",
+			globalErr:       globalDenied,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedRetry:   "3600",
+			expectedMessage: "too many messages sent to this recipient",
+		},
+		{
+			name:            "both reached - longest wait is reported",
+			typeErr:         typeDenied,
+			globalErr:       globalDenied,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedRetry:   "3600",
+			expectedMessage: "too many messages sent to this recipient",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := slog.Default()
+			redisClient := &redis.Client{}
+			userID := uuid.New()
+
+			var refunded []string
+			mockRL := &mockRateLimiter{
+				isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
+					err := tc.typeErr
+					if key == model.GenGlobalKey(userID.String()) {
+						err = tc.globalErr
+					}
+					return err == nil, err
+				},
+				refundFunc: func(ctx context.Context, key string, cfg config.RLConfig) error {
+					refunded = append(refunded, key)
+					return nil
+				},
+			}
+
+			configProvider := newMockConfigProvider()
+			configProvider.global = config.Rules{{Limit: 10, WindowSize: 3600}}
+			ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
+			app := New(logger, redisClient, ctrl)
+
+			jsonPayload, err := json.Marshal(model.Notification{
+				UserID:           userID,
+				NotificationType: model.NotificationTypeNews,
+				Message:          "This is a valid test message that is long enough",
+			})
+			if err != nil {
+				t.Fatalf("Failed to marshal notification: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+			w := httptest.NewRecorder()
+			app.handleSendNotification(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tc.expectedRetry {
+				t.Errorf("Expected Retry-After header '%s', got '%s'", tc.expectedRetry, retryAfter)
+			}
+
+			var response map[string]any
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response["message"] != tc.expectedMessage {
+				t.Errorf("Expected message '%s', got '%v'", tc.expectedMessage, response["message"])
+			}
+
+			// Only a single check denies in these cases, the other one is refunded.
+			if (tc.typeErr == nil) != (tc.globalErr == nil) && len(refunded) != 1 {
+				t.Errorf("Expected the allowing check to be refunded, got %v", refunded)
+			}
+		})
+	}
+}
+
+func TestHandleSendNotification_GlobalCapWithMemoryRateLimiter(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rateLimiter := memory.New(memory.Options{Clock: func() time.Time { return now }})
+	defer rateLimiter.Close()
+
+	// 3 of each type per day, but no more than 3 of any type per hour.
+	configProvider := &mockConfigProvider{
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeNews:      {{Limit: 3, WindowSize: 86400}},
+			model.NotificationTypeStatus:    {{Limit: 3, WindowSize: 86400}},
+			model.NotificationTypeMarketing: {{Limit: 3, WindowSize: 86400}},
+		},
+		global: config.Rules{{Limit: 3, WindowSize: 3600}},
+	}
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
+	app := New(logger, redisClient, ctrl)
+
+	send := func(userID uuid.UUID, notificationType model.NotificationType) *httptest.ResponseRecorder {
+		jsonPayload, err := json.Marshal(model.Notification{
+			UserID:           userID,
+			NotificationType: notificationType,
+			Message:          "This is a valid test message that is long enough",
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal notification: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+		return w
+	}
+
+	userID := uuid.New()
+	for _, notificationType := range []model.NotificationType{
+		model.NotificationTypeNews,
+		model.NotificationTypeStatus,
+		model.NotificationTypeMarketing,
+	} {
+		if w := send(userID, notificationType); w.Code != http.StatusCreated {
+			t.Fatalf("Expected %s to be sent, got %d. Body: %s", notificationType, w.Code, w.Body.String())
+		}
+	}
+
+	w := send(userID, model.NotificationTypeStatus)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the global cap to be reached, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "3600" {
+		t.Errorf("Expected Retry-After header '3600', got '%s'", retryAfter)
+	}
+	if !strings.Contains(w.Body.String(), "too many messages sent to this recipient") {
+		t.Errorf("Expected the global cap reason, got %s", w.Body.String())
+	}
+
+	if w := send(uuid.New(), model.NotificationTypeStatus); w.Code != http.StatusCreated {
+		t.Errorf("Expected another recipient not to be affected, got %d", w.Code)
+	}
+
+	// The denied send was not counted against the status rule: once the hour
+	// is over, status still has 2 of its 3 daily sends left.
+	now = now.Add(time.Hour)
+	for range 2 {
+		if w := send(userID, model.NotificationTypeStatus); w.Code != http.StatusCreated {
+			t.Fatalf("Expected status to be sent after the global window, got %d. Body: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := send(userID, model.NotificationTypeStatus); !strings.Contains(w.Body.String(), "too many messages of that type sent") {
+		t.Errorf("Expected the type limit to be reached first, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleSendNotification_GroupSharesQuota(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	rateLimiter := memory.New(memory.Options{})
+	defer rateLimiter.Close()
+
+	promotional := config.Rules{{Limit: 3, WindowSize: 3600}}
+	configProvider := &mockConfigProvider{
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeNews:      {{Limit: 1, WindowSize: 86400}},
+			model.NotificationTypeStatus:    promotional,
+			model.NotificationTypeMarketing: promotional,
+		},
+		groups: map[model.NotificationType]string{
+			model.NotificationTypeStatus:    "promotional",
+			model.NotificationTypeMarketing: "promotional",
+		},
+	}
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
+	app := New(logger, redisClient, ctrl)
+
+	userID := uuid.New()
+	steps := []struct {
+		notificationType model.NotificationType
+		expectedStatus   int
+	}{
+		{model.NotificationTypeMarketing, http.StatusCreated},
+		{model.NotificationTypeStatus, http.StatusCreated},
+		{model.NotificationTypeMarketing, http.StatusCreated},
+		// The promotional budget is spent, whichever type asks for it.
+		{model.NotificationTypeMarketing, http.StatusTooManyRequests},
+		{model.NotificationTypeStatus, http.StatusTooManyRequests},
+		// Types outside the group keep their own quota.
+		{model.NotificationTypeNews, http.StatusCreated},
+	}
+
+	for i, step := range steps {
+		jsonPayload, err := json.Marshal(model.Notification{
+			UserID:           userID,
+			NotificationType: step.notificationType,
+			Message:          "This is a valid test message that is long enough",
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal notification: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != step.expectedStatus {
+			t.Errorf("Step %d (%s): expected status code %d, got %d. Body: %s",
+				i, step.notificationType, step.expectedStatus, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandleSendNotification_TypesComeFromConfig(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	configProvider := &mockConfigProvider{
+		configs: map[model.NotificationType]config.Rules{
+			"security-notification":      {{Limit: 5, WindowSize: 60}},
+			model.NotificationTypeStatus: {{Limit: 2, WindowSize: 60}},
+		},
+	}
+	ctrl := notification.NewController(&mockRateLimiter{}, configProvider, &mockGateway{})
+	app := New(logger, redisClient, ctrl).bindRoutes()
+
+	testCases := []struct {
+		name             string
+		notificationType model.NotificationType
+		expectedStatus   int
+	}{
+		{"Configured type without a constant", "security-notification", http.StatusCreated},
+		{"Configured builtin type", model.NotificationTypeStatus, http.StatusCreated},
+		{"Builtin type missing from config", model.NotificationTypeNews, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := sendTo(app, uuid.New(), tc.notificationType)
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Body: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if tc.expectedStatus != http.StatusBadRequest {
+				return
+			}
+
+			var problems map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&problems); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			expected := "Must be a valid notificationType: [security-notification status-notification]"
+			if problems["notificationType"] != expected {
+				t.Errorf("Expected problem %q, got %q", expected, problems["notificationType"])
+			}
+		})
+	}
+}
+
+func TestHandleSendNotification_CalendarWindow(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	// 23:00 in UTC is already 08:00 of the next day in Tokyo.
+	now := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	defer rateLimiter.Close()
+
+	// 1 per calendar day.
+	configProvider := &mockConfigProvider{
+		configs: map[model.NotificationType]config.Rules{
+			model.NotificationTypeNews: {{Limit: 1, Reset: config.ResetDay}},
+		},
+	}
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{}).WithClock(clock)
+	app := New(logger, redisClient, ctrl)
+
+	steps := []struct {
+		name           string
+		advance        time.Duration
+		timeZone       string
+		expectedStatus int
+		expectedRetry  string
+	}{
+		{"first of the day", 0, "", http.StatusCreated, ""},
+		{"denied until midnight", 0, "", http.StatusTooManyRequests, "3600"},
+		{"next calendar day", time.Hour, "", http.StatusCreated, ""},
+		{"denied until the next midnight", 30 * time.Minute, "", http.StatusTooManyRequests, "84600"},
+		{"recipient day has not been charged", 0, "Asia/Tokyo", http.StatusCreated, ""},
+		{"denied until midnight in Tokyo", 0, "Asia/Tokyo", http.StatusTooManyRequests, "52200"},
+	}
+
+	userID := uuid.New()
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		jsonPayload, err := json.Marshal(model.Notification{
+			UserID:           userID,
+			NotificationType: model.NotificationTypeNews,
+			Message:          "This is a valid test message that is long enough",
+			TimeZone:         step.timeZone,
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal notification: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != step.expectedStatus {
+			t.Errorf("%s: expected status code %d, got %d. Body: %s", step.name, step.expectedStatus, w.Code, w.Body.String())
+		}
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != step.expectedRetry {
+			t.Errorf("%s: expected Retry-After header '%s', got '%s'", step.name, step.expectedRetry, retryAfter)
+		}
+	}
+}
+
+func TestHandleSendNotification_QuietHours(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	var calls int
+	rateLimiter := &mockRateLimiter{
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
+			calls++
+			return true, nil
+		},
+	}
+
+	configProvider := newMockConfigProvider()
+	configProvider.quietHours = map[model.NotificationType]*config.QuietHours{
+		model.NotificationTypeMarketing: {Start: "22:00", End: "08:00", TimeZone: "Europe/Lisbon"},
+	}
+
+	// Lisbon is on UTC in January.
+	now := time.Date(2025, 1, 10, 21, 59, 0, 0, time.UTC)
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{}).WithClock(func() time.Time { return now })
+	app := New(logger, redisClient, ctrl)
+
+	steps := []struct {
+		name             string
+		at               time.Time
+		notificationType model.NotificationType
+		timeZone         string
+		expectedStatus   int
+		expectedRetry    string
+	}{
+		{"before quiet hours", now, model.NotificationTypeMarketing, "", http.StatusCreated, ""},
+		{"quiet hours start", now.Add(time.Minute), model.NotificationTypeMarketing, "", http.StatusTooManyRequests, "36000"},
+		{"other types are not quiet", now.Add(time.Minute), model.NotificationTypeStatus, "", http.StatusCreated, ""},
+		{"recipient time zone", now.Add(time.Minute), model.NotificationTypeMarketing, "America/New_York", http.StatusCreated, ""},
+		{"past midnight", now.Add(10*time.Hour + 30*time.Second), model.NotificationTypeMarketing, "", http.StatusTooManyRequests, "30"},
+		{"quiet hours end", now.Add(10*time.Hour + time.Minute), model.NotificationTypeMarketing, "", http.StatusCreated, ""},
+	}
+
+	for _, step := range steps {
+		now = step.at
+		before := calls
+
+		jsonPayload, err := json.Marshal(model.Notification{
+			UserID:           uuid.New(),
+			NotificationType: step.notificationType,
+			Message:          "This is a valid test message that is long enough",
+			TimeZone:         step.timeZone,
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal notification: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != step.expectedStatus {
+			t.Errorf("%s: expected status code %d, got %d. Body: %s", step.name, step.expectedStatus, w.Code, w.Body.String())
+		}
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != step.expectedRetry {
+			t.Errorf("%s: expected Retry-After header '%s', got '%s'", step.name, step.expectedRetry, retryAfter)
+		}
+		if w.Code == http.StatusTooManyRequests && calls != before {
+			t.Errorf("%s: expected quiet hours to be checked before the rate limiter", step.name)
+		}
+	}
+}
+
+func TestHandleSendNotification_DeferPolicy(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	defer rateLimiter.Close()
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}, OnLimit: config.LimitPolicyDefer},
+		},
+	})
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{}).
+		WithClock(clock).
+		WithDeferQueue(queuememory.New())
+	app := New(logger, redisClient, ctrl)
+
+	jsonPayload, err := json.Marshal(model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "This is a valid test message that is long enough",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	for i, expectedStatus := range []int{http.StatusCreated, http.StatusAccepted} {
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != expectedStatus {
+			t.Fatalf("Step %d: expected status code %d, got %d. Body: %s", i, expectedStatus, w.Code, w.Body.String())
+		}
+		if expectedStatus != http.StatusAccepted {
+			continue
+		}
+
+		var response struct {
+			ScheduledAt time.Time `json:"scheduledAt"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if !response.ScheduledAt.Equal(now.Add(time.Minute)) {
+			t.Errorf("Expected the message to be scheduled at %v, got %v", now.Add(time.Minute), response.ScheduledAt)
+		}
+	}
+}
+
+func TestHandleSendNotification_DigestPolicy(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	defer rateLimiter.Close()
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}, OnLimit: config.LimitPolicyDigest},
+		},
+	})
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{}).
+		WithClock(clock).
+		WithDigests(digestmemory.New())
+	app := New(logger, redisClient, ctrl)
+
+	jsonPayload, err := json.Marshal(model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	for i, expectedStatus := range []int{http.StatusCreated, http.StatusAccepted, http.StatusAccepted} {
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != expectedStatus {
+			t.Fatalf("Step %d: expected status code %d, got %d. Body: %s", i, expectedStatus, w.Code, w.Body.String())
+		}
+		if expectedStatus != http.StatusAccepted {
+			continue
+		}
+
+		var response struct {
+			Message     string    `json:"message"`
+			ScheduledAt time.Time `json:"scheduledAt"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Message != "Message Added To Digest" {
+			t.Errorf("Expected the message to be added to the digest, got %q", response.Message)
+		}
+		if !response.ScheduledAt.Equal(now.Add(time.Minute)) {
+			t.Errorf("Expected the digest to be scheduled at %v, got %v", now.Add(time.Minute), response.ScheduledAt)
+		}
+	}
+}
+
+func TestHandleSendNotification_Dedup(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	rateLimiter := memory.New(memory.Options{})
+	defer rateLimiter.Close()
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {
+				Rules: config.Rules{{Limit: 1, WindowSize: 60}},
+				Dedup: &config.DedupConfig{WindowSize: 60},
+			},
+		},
+	})
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{}).
+		WithDedup(dedupmemory.New())
+	app := New(logger, redisClient, ctrl)
+
+	jsonPayload, err := json.Marshal(model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "This is a valid test message that is long enough",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	// Within the limit of 1, only because duplicates are not counted.
+	for i, expectedStatus := range []int{http.StatusCreated, http.StatusOK, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != expectedStatus {
+			t.Fatalf("Step %d: expected status code %d, got %d. Body: %s", i, expectedStatus, w.Code, w.Body.String())
+		}
+		if expectedStatus != http.StatusOK {
+			continue
+		}
+
+		var response map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response["message"] != "Duplicate Message Suppressed" {
+			t.Errorf("Expected the duplicate to be suppressed, got %q", response["message"])
+		}
+	}
+}
+
+func TestHandleSendNotification_Channels(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	rateLimiter := memory.New(memory.Options{})
+	defer rateLimiter.Close()
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {
+				Rules: config.Rules{{Limit: 1, WindowSize: 60}},
+				Channels: map[model.Channel]config.Override{
+					model.ChannelEmail: {Rules: config.Rules{{Limit: 2, WindowSize: 60}}},
+					model.ChannelInApp: {Unlimited: true},
+				},
+			},
+		},
+	})
+	var delivered []model.Channel
+	gateway := &mockGateway{
+		sendFunc: func(ctx context.Context, n model.Notification) error {
+			delivered = append(delivered, n.Channel)
+			return nil
+		},
+	}
+	ctrl := notification.NewController(rateLimiter, configProvider, gateway).
+		WithChannel(model.ChannelEmail, gateway).
+		WithChannel(model.ChannelInApp, gateway)
+	app := New(logger, redisClient, ctrl)
+
+	userID := uuid.New()
+	steps := []struct {
+		channel        model.Channel
+		expectedStatus int
+	}{
+		// Each channel has its own quota, sends without one are emails and
+		// share theirs.
+		{"", http.StatusCreated},
+		{model.ChannelEmail, http.StatusCreated},
+		{"", http.StatusTooManyRequests},
+		{model.ChannelEmail, http.StatusTooManyRequests},
+		{model.ChannelInApp, http.StatusCreated},
+		{model.ChannelInApp, http.StatusCreated},
+		{model.ChannelInApp, http.StatusCreated},
+		// Supported, but without a gateway.
+		{model.ChannelSMS, http.StatusBadRequest},
+		{"fax", http.StatusBadRequest},
+	}
+
+	for i, step := range steps {
+		jsonPayload, err := json.Marshal(model.Notification{
+			UserID:           userID,
+			NotificationType: model.NotificationTypeStatus,
+			Message:          "This is a valid test message that is long enough",
+			Channel:          step.channel,
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal notification: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != step.expectedStatus {
+			t.Fatalf("Step %d (%q): expected status code %d, got %d. Body: %s", i, step.channel, step.expectedStatus, w.Code, w.Body.String())
+		}
+	}
+
+	expected := []model.Channel{"", model.ChannelEmail, model.ChannelInApp, model.ChannelInApp, model.ChannelInApp}
+	if !slices.Equal(delivered, expected) {
+		t.Errorf("Expected deliveries over %v, got %v", expected, delivered)
+	}
+}
+
+func TestHandleSendNotification_RateLimitHeaders(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	rateLimiter := memory.New(memory.Options{})
+	defer rateLimiter.Close()
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Global: config.Rules{{Limit: 10, WindowSize: 3600}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {Rules: config.Rules{{Limit: 2, WindowSize: 60}}},
+		},
+	})
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
+	app := New(logger, redisClient, ctrl)
+
+	jsonPayload, err := json.Marshal(model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "This is a valid test message that is long enough",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal notification: %v", err)
+	}
+
+	steps := []struct {
+		status    int
+		remaining string
+	}{
+		{http.StatusCreated, "1"},
+		{http.StatusCreated, "0"},
+		{http.StatusTooManyRequests, "0"},
+	}
+	for i, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		w := httptest.NewRecorder()
+		app.handleSendNotification(w, req)
+
+		if w.Code != step.status {
+			t.Fatalf("Step %d: expected status code %d, got %d. Body: %s", i, step.status, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get(RateLimitLimitHeader); got != "2" {
+			t.Errorf("Step %d: expected %s 2, got %q", i, RateLimitLimitHeader, got)
+		}
+		if got := w.Header().Get(RateLimitRemainingHeader); got != step.remaining {
+			t.Errorf("Step %d: expected %s %s, got %q", i, RateLimitRemainingHeader, step.remaining, got)
+		}
+		if reset, err := strconv.Atoi(w.Header().Get(RateLimitResetHeader)); err != nil || reset < 1 || reset > 60 {
+			t.Errorf("Step %d: expected %s within the minute window, got %q", i, RateLimitResetHeader, w.Header().Get(RateLimitResetHeader))
+		}
+		if got := w.Header().Get(RateLimitPolicyHeader); got != "2;w=60, 10;w=3600" {
+			t.Errorf("Step %d: expected %s %q, got %q", i, RateLimitPolicyHeader, "2;w=60, 10;w=3600", got)
+		}
+	}
+}
+
+func TestHandleSendBatch(t *testing.T) {
+	logger := slog.Default()
+	redisClient := &redis.Client{}
+
+	rateLimiter := memory.New(memory.Options{})
+	defer rateLimiter.Close()
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 2, WindowSize: 60}}},
+		},
+	})
+	ctrl := notification.NewController(rateLimiter, configProvider, &mockGateway{})
+	app := New(logger, redisClient, ctrl)
+
+	news := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	}
+	invalid := news
+	invalid.Message = "short"
+	unsupported := news
+	unsupported.Channel = model.ChannelSMS
+	items := []any{news, news, news, invalid, map[string]any{"userId": "not-a-uuid"}, unsupported}
+
+	jsonPayload, err := json.Marshal(items)
+	if err != nil {
+		t.Fatalf("Failed to marshal notifications: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/notify/send/batch", bytes.NewBuffer(jsonPayload))
+	w := httptest.NewRecorder()
+	app.handleSendBatch(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusMultiStatus, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Results []struct {
+			Status     int               `json:"status"`
+			Message    string            `json:"message"`
+			RetryAfter float64           `json:"retryAfter"`
+			Problems   map[string]string `json:"problems"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Results) != len(items) {
+		t.Fatalf("Expected %d results, got %d", len(items), len(response.Results))
+	}
+
+	expected := []int{
+		http.StatusCreated,
+		http.StatusCreated,
+		http.StatusTooManyRequests,
+		http.StatusBadRequest,
+		http.StatusBadRequest,
+		http.StatusBadRequest,
+	}
+	for i, status := range expected {
+		if response.Results[i].Status != status {
+			t.Errorf("Item %d: expected status %d, got %d", i, status, response.Results[i].Status)
+		}
+	}
+	if retryAfter := response.Results[2].RetryAfter; retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("Expected the rate-limited item to retry within the minute window, got %v", retryAfter)
+	}
+	if _, ok := response.Results[3].Problems["message"]; !ok {
+		t.Errorf("Expected the invalid item to report its message, got %v", response.Results[3].Problems)
+	}
+	if len(response.Results[4].Problems) == 0 {
+		t.Error("Expected the malformed item to report problems")
+	}
+	if _, ok := response.Results[5].Problems["channel"]; !ok {
+		t.Errorf("Expected the item over a disabled channel to report it, got %v", response.Results[5].Problems)
+	}
+
+	for _, body := range []string{`{"userId": "not-a-list"}`, `[]`} {
+		req := httptest.NewRequest(http.MethodPost, "/notify/send/batch", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		app.handleSendBatch(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Body %s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+type mockInbox struct {
+	items []inbox.Item
+	err   error
+	limit int
+}
+
+func (m *mockInbox) List(ctx context.Context, userID uuid.UUID, limit int) ([]inbox.Item, error) {
+	m.limit = limit
+	return m.items, m.err
+}
+
+func TestHandleListInbox(t *testing.T) {
+	userID := uuid.New()
+	items := []inbox.Item{{ID: "1", NotificationType: model.NotificationTypeNews, Message: "news"}}
+
+	tests := []struct {
+		name           string
+		inbox          *mockInbox
+		path           string
+		expectedStatus int
+		expectedLimit  int
+	}{
+		{name: "Disabled", path: "/notify/inbox/" + userID.String(), expectedStatus: http.StatusNotImplemented},
+		{name: "Default limit", inbox: &mockInbox{items: items}, path: "/notify/inbox/" + userID.String(), expectedStatus: http.StatusOK, expectedLimit: 20},
+		{name: "Custom limit", inbox: &mockInbox{items: items}, path: "/notify/inbox/" + userID.String() + "?limit=5", expectedStatus: http.StatusOK, expectedLimit: 5},
+		{name: "Invalid limit", inbox: &mockInbox{}, path: "/notify/inbox/" + userID.String() + "?limit=500", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid user", inbox: &mockInbox{}, path: "/notify/inbox/not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Inbox error", inbox: &mockInbox{err: errors.New("connection dropped")}, path: "/notify/inbox/" + userID.String(), expectedStatus: http.StatusInternalServerError, expectedLimit: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := notification.NewController(&mockRateLimiter{}, newMockConfigProvider(), &mockGateway{})
+			app := New(slog.Default(), &redis.Client{}, ctrl)
+			if tt.inbox != nil {
+				app.WithInbox(tt.inbox)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			app.bindRoutes().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.inbox != nil && tt.inbox.limit != tt.expectedLimit {
+				t.Errorf("Expected a limit of %d, got %d", tt.expectedLimit, tt.inbox.limit)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Notifications []inbox.Item `json:"notifications"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Notifications) != 1 || response.Notifications[0].Message != "news" {
+				t.Errorf("Expected the inbox items, got %+v", response.Notifications)
+			}
+		})
+	}
+}
+
+func TestHandleGetQuota(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedTypes  []model.NotificationType
+	}{
+		{name: "Every type", path: "/notify/quota/" + userID.String(), expectedStatus: http.StatusOK, expectedTypes: []model.NotificationType{model.NotificationTypeMarketing, model.NotificationTypeNews, model.NotificationTypeStatus}},
+		{name: "Single type", path: "/notify/quota/" + userID.String() + "?type=status-notification", expectedStatus: http.StatusOK, expectedTypes: []model.NotificationType{model.NotificationTypeStatus}},
+		{name: "Unknown type", path: "/notify/quota/" + userID.String() + "?type=unknown-notification", expectedStatus: http.StatusNotFound},
+		{name: "Unknown channel", path: "/notify/quota/" + userID.String() + "?channel=fax", expectedStatus: http.StatusBadRequest},
+		{name: "Disabled channel", path: "/notify/quota/" + userID.String() + "?channel=sms", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid user", path: "/notify/quota/not-a-uuid", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRL := &mockRateLimiter{
+				peekFunc: func(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+					if strings.HasPrefix(key, string(model.NotificationTypeStatus)) {
+						return ratelimit.NewUsage(cfg.Limit, 2, 30*time.Second), nil
+					}
+					return ratelimit.NewUsage(cfg.Limit, 0, 0), nil
+				},
+			}
+			ctrl := notification.NewController(mockRL, newMockConfigProvider(), &mockGateway{})
+			app := New(slog.Default(), &redis.Client{}, ctrl)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			app.bindRoutes().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			type ruleQuota struct {
+				Limit     int       `json:"limit"`
+				Used      int       `json:"used"`
+				Remaining int       `json:"remaining"`
+				ResetAt   time.Time `json:"resetAt"`
+			}
+			var response struct {
+				Quotas map[model.NotificationType]struct {
+					ruleQuota
+					Unlimited bool        `json:"unlimited"`
+					Rules     []ruleQuota `json:"rules"`
+				} `json:"quotas"`
+				Global struct {
+					Unlimited bool `json:"unlimited"`
+				} `json:"global"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := slices.Sorted(maps.Keys(response.Quotas)); !slices.Equal(got, tt.expectedTypes) {
+				t.Errorf("Expected the quotas of %v, got %v", tt.expectedTypes, got)
+			}
+			status := response.Quotas[model.NotificationTypeStatus]
+			if status.Unlimited || status.Limit != 2 || status.Used != 2 || status.Remaining != 0 || len(status.Rules) != 1 {
+				t.Errorf("Expected the status quota to be used up, got %+v", status)
+			}
+			if wait := time.Until(status.ResetAt); wait <= 0 || wait > 30*time.Second {
+				t.Errorf("Expected the status quota to reset within 30s, got %v", status.ResetAt)
+			}
+			if !response.Global.Unlimited {
+				t.Error("Expected the recipient to have no global cap")
+			}
+		})
+	}
+}
+
 func BenchmarkHandleSendNotification(b *testing.B) {
 	logger := slog.Default()
 	redisClient := &redis.Client{}
 
 	mockRL := &mockRateLimiter{
-		isAllowedFunc: func(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+		isAllowedFunc: func(ctx context.Context, key string, cfg config.RLConfig) (bool, error) {
 			return true, nil
 		},
 	}
 
 	configProvider := newMockConfigProvider()
-	ctrl := notification.NewController(mockRL, configProvider)
+	ctrl := notification.NewController(mockRL, configProvider, &mockGateway{})
 	app := New(logger, redisClient, ctrl)
 
 	validID := uuid.New()
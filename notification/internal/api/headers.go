@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+)
+
+// Rate-limit headers, as defined by the IETF RateLimit header fields draft.
+const (
+	// RateLimitLimitHeader is the limit of the most restrictive rule a send
+	// was counted against.
+	RateLimitLimitHeader = "RateLimit-Limit"
+	// RateLimitRemainingHeader is how many sends the most restrictive rule
+	// has left.
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	// RateLimitResetHeader is in how many seconds the most restrictive rule
+	// is available again.
+	RateLimitResetHeader = "RateLimit-Reset"
+	// RateLimitPolicyHeader lists every rule a send was counted against, as
+	// its limit and window in seconds, e.g. "2;w=60, 20;w=86400".
+	RateLimitPolicyHeader = "RateLimit-Policy"
+)
+
+// mostRestrictive returns the index of the quota with the fewest requests
+// remaining, the one resetting last among them, or -1 when there is none.
+func mostRestrictive(quotas []notification.Quota) int {
+	restrictive := -1
+	for i, q := range quotas {
+		if restrictive == -1 || q.Remaining < quotas[restrictive].Remaining ||
+			(q.Remaining == quotas[restrictive].Remaining && q.ResetAt.After(quotas[restrictive].ResetAt)) {
+			restrictive = i
+		}
+	}
+	return restrictive
+}
+
+// setRateLimitHeaders describes quotas, as left by a send at now, with the
+// RateLimit headers. A send counted against no rule gets none of them.
+func setRateLimitHeaders(w http.ResponseWriter, now time.Time, quotas []notification.Quota) {
+	restrictive := mostRestrictive(quotas)
+	if restrictive == -1 {
+		return
+	}
+
+	q := quotas[restrictive]
+	reset := max(int(math.Ceil(q.ResetAt.Sub(now).Seconds())), 0)
+	w.Header().Set(RateLimitLimitHeader, strconv.Itoa(q.Limit))
+	w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(q.Remaining))
+	w.Header().Set(RateLimitResetHeader, strconv.Itoa(reset))
+
+	policies := make([]string, len(quotas))
+	for i, q := range quotas {
+		policies[i] = fmt.Sprintf("%d;w=%d", q.Limit, int(math.Ceil(q.Window.Seconds())))
+	}
+	w.Header().Set(RateLimitPolicyHeader, strings.Join(policies, ", "))
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
+)
+
+const (
+	// IdempotencyKeyHeader is the header clients set to make retries of a
+	// request safe.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds the keys clients may choose.
+	maxIdempotencyKeyLength = 255
+	// idempotencyLease is how long a key stays claimed by a request still
+	// being handled since the claim was last renewed. It is renewed every
+	// third of it, for as long as the request takes, e.g. a batch of slow
+	// deliveries, so it only bounds how long a replica dying meanwhile blocks
+	// the retries.
+	idempotencyLease = 2 * time.Minute
+)
+
+// WithIdempotency makes requests carrying an IdempotencyKeyHeader answered at
+// most once within ttl: their response is kept in store and replayed to
+// retries for ttl. It returns the Application for chaining.
+func (api *Application) WithIdempotency(store idempotency.Store, ttl time.Duration) *Application {
+	api.idempotency = store
+	api.idempotencyTTL = ttl
+	api.idempotencyLease = idempotencyLease
+	return api
+}
+
+// withIdempotency handles requests with an idempotency key once. Retries get
+// the stored response without reaching next, so they neither take quota nor
+// send the notification again. A retry arriving while the first request is
+// still handled is refused with a 409, one reusing the key for another
+// request with a 422.
+//
+// Server errors, panics included, and 429s are not kept, so they can be
+// retried: the Retry-After of a replayed 429 would be stale. A key is only
+// claimed for idempotencyLease at a time, renewed while its request is
+// handled, so a replica dying meanwhile does not block its retries for long.
+func (api *Application) withIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if api.idempotency == nil || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+				map[string]string{IdempotencyKeyHeader: "must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			jsonvalidator.EncodeJson(w, r, http.StatusBadRequest,
+				map[string]any{"message": "failed to read request body"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Kept even if the client goes away, so its retry finds it.
+		ctx := context.WithoutCancel(r.Context())
+		fingerprint := requestFingerprint(r, body)
+		rec, claimed, err := api.idempotency.Claim(ctx, key, idempotency.Record{Fingerprint: fingerprint}, api.idempotencyLease)
+		if err != nil {
+			api.Logger.Error("failed to claim idempotency key", "err", err, "key", key)
+			jsonvalidator.EncodeJson(w, r, http.StatusInternalServerError,
+				map[string]any{"message": "failed to check idempotency key, try again later"})
+			return
+		}
+
+		if !claimed {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				jsonvalidator.EncodeJson(w, r, http.StatusUnprocessableEntity,
+					map[string]any{"message": "this idempotency key was used for another request"})
+			case !rec.Done():
+				w.Header().Set("Retry-After", "1")
+				jsonvalidator.EncodeJson(w, r, http.StatusConflict,
+					map[string]any{"message": "a request with this idempotency key is still in progress"})
+			default:
+				for name, values := range rec.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(rec.Status)
+				w.Write(rec.Body)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		stopRenewing := api.renewIdempotencyKey(ctx, key)
+		keep := false
+		// Also run when next panics.
+		defer func() {
+			stopRenewing()
+			if keep {
+				return
+			}
+			if err := api.idempotency.Release(ctx, key); err != nil {
+				api.Logger.Error("failed to release idempotency key", "err", err, "key", key)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+		stopRenewing()
+
+		keep = recorder.status != 0 &&
+			recorder.status < http.StatusInternalServerError &&
+			recorder.status != http.StatusTooManyRequests
+		if !keep {
+			return
+		}
+		rec = idempotency.Record{
+			Fingerprint: fingerprint,
+			Status:      recorder.status,
+			Header:      recorder.header,
+			Body:        recorder.body.Bytes(),
+		}
+		if err := api.idempotency.Save(ctx, key, rec, api.idempotencyTTL); err != nil {
+			api.Logger.Error("failed to save idempotent response", "err", err, "key", key)
+		}
+	})
+}
+
+// renewIdempotencyKey renews the claim of key every third of the lease until
+// the returned function is called, which waits for a renewal in flight so
+// none cuts short how long the response saved after it is kept.
+func (api *Application) renewIdempotencyKey(ctx context.Context, key string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(api.idempotencyLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := api.idempotency.Renew(ctx, key, api.idempotencyLease); err != nil {
+					api.Logger.Error("failed to renew idempotency key", "err", err, "key", key)
+				}
+			}
+		}
+	}()
+	return sync.OnceFunc(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+// requestFingerprint identifies what a request asks for, so an idempotency key
+// cannot be reused for another one.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder copies the response written through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/controller/notification"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+	idempotencymemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newIdempotencyTestApp returns an Application allowing a single news
+// notification per recipient, whose gateway fails while fail is set, along
+// with its idempotency store and the notifications it delivered.
+func newIdempotencyTestApp(t *testing.T, fail *bool) (*Application, *idempotencymemory.Store, *[]model.Notification) {
+	t.Helper()
+
+	rateLimiter := memory.New(memory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+		},
+	})
+	var delivered []model.Notification
+	gateway := &mockGateway{
+		sendFunc: func(ctx context.Context, n model.Notification) error {
+			if *fail {
+				return errors.New("smtp server unavailable")
+			}
+			delivered = append(delivered, n)
+			return nil
+		},
+	}
+	store := idempotencymemory.New()
+	ctrl := notification.NewController(rateLimiter, configProvider, gateway)
+	app := New(slog.Default(), &redis.Client{}, ctrl).WithIdempotency(store, time.Hour)
+	return app, store, &delivered
+}
+
+func sendWithIdempotencyKey(app *Application, key string, n model.Notification) *httptest.ResponseRecorder {
+	jsonPayload, _ := json.Marshal(n)
+	req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency_ReplaysRetries(t *testing.T) {
+	var fail bool
+	app, _, delivered := newIdempotencyTestApp(t, &fail)
+	app.bindRoutes()
+
+	n := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	}
+
+	first := sendWithIdempotencyKey(app, "retry-key", n)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusCreated, first.Code, first.Body.String())
+	}
+
+	// Within the limit of 1, only because the retry is not counted.
+	retry := sendWithIdempotencyKey(app, "retry-key", n)
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("Expected the retry to get status code %d, got %d. Body: %s", http.StatusCreated, retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("Expected the retry to be marked as replayed")
+	}
+	if retry.Header().Get("Content-Type") != first.Header().Get("Content-Type") || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the first response to be replayed, got %v %s", retry.Header(), retry.Body.String())
+	}
+	if len(*delivered) != 1 {
+		t.Errorf("Expected a single delivery, got %d", len(*delivered))
+	}
+
+	// Rejections are not replayed, their Retry-After would be stale.
+	limited := sendWithIdempotencyKey(app, "other-key", n)
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusTooManyRequests, limited.Code, limited.Body.String())
+	}
+	retried := sendWithIdempotencyKey(app, "other-key", n)
+	if retried.Code != http.StatusTooManyRequests || retried.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("Expected the rejected request to be handled again, got %d %v", retried.Code, retried.Header())
+	}
+
+	// Requests without a key are handled every time.
+	if w := sendWithIdempotencyKey(app, "", n); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d without a key, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+// ttlStore is an idempotency.Store recording the ttl keys were last claimed
+// and saved for.
+type ttlStore struct {
+	idempotency.Store
+	claimed, saved time.Duration
+}
+
+func (s *ttlStore) Claim(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) (idempotency.Record, bool, error) {
+	s.claimed = ttl
+	return s.Store.Claim(ctx, key, rec, ttl)
+}
+
+func (s *ttlStore) Save(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	s.saved = ttl
+	return s.Store.Save(ctx, key, rec, ttl)
+}
+
+func TestIdempotency_ClaimsForALease(t *testing.T) {
+	var fail bool
+	app, store, _ := newIdempotencyTestApp(t, &fail)
+	ttls := &ttlStore{Store: store}
+	app.WithIdempotency(ttls, 24*time.Hour).bindRoutes()
+
+	n := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	}
+	if w := sendWithIdempotencyKey(app, "key", n); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// A replica dying mid-request only blocks retries until the lease ends.
+	if ttls.claimed != idempotencyLease {
+		t.Errorf("Expected the key to be claimed for %v, got %v", idempotencyLease, ttls.claimed)
+	}
+	if ttls.saved != 24*time.Hour {
+		t.Errorf("Expected the response to be kept for 24h, got %v", ttls.saved)
+	}
+}
+
+func TestIdempotency_RenewsTheClaimOfSlowRequests(t *testing.T) {
+	rateLimiter := memory.New(memory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	// Enough quota to send twice, were the retry handled again.
+	configProvider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 2, WindowSize: 60}}},
+		},
+	})
+	var delivered atomic.Int32
+	sending, release := make(chan struct{}), make(chan struct{})
+	gateway := &mockGateway{
+		sendFunc: func(ctx context.Context, n model.Notification) error {
+			if delivered.Add(1) == 1 {
+				close(sending)
+				<-release
+			}
+			return nil
+		},
+	}
+	ctrl := notification.NewController(rateLimiter, configProvider, gateway)
+	app := New(slog.Default(), &redis.Client{}, ctrl).WithIdempotency(idempotencymemory.New(), time.Hour)
+	app.idempotencyLease = 30 * time.Millisecond
+	app.bindRoutes()
+
+	n := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	}
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- sendWithIdempotencyKey(app, "slow-key", n) }()
+
+	// The first request is still delivering well past its lease.
+	<-sending
+	time.Sleep(5 * app.idempotencyLease)
+	retry := sendWithIdempotencyKey(app, "slow-key", n)
+	if retry.Code != http.StatusConflict {
+		t.Errorf("Expected the retry to get status code %d, got %d. Body: %s", http.StatusConflict, retry.Code, retry.Body.String())
+	}
+
+	close(release)
+	if w := <-first; w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := sendWithIdempotencyKey(app, "slow-key", n); w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("Expected the response to be replayed once handled, got %d %v", w.Code, w.Header())
+	}
+	if got := delivered.Load(); got != 1 {
+		t.Errorf("Expected a single delivery, got %d", got)
+	}
+}
+
+func TestIdempotency_Errors(t *testing.T) {
+	n := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "This is a valid test message that is long enough",
+	}
+
+	t.Run("Key reused for another request", func(t *testing.T) {
+		var fail bool
+		app, _, _ := newIdempotencyTestApp(t, &fail)
+		app.bindRoutes()
+
+		sendWithIdempotencyKey(app, "key", n)
+		other := n
+		other.Message = "This is another message that is long enough"
+		if w := sendWithIdempotencyKey(app, "key", other); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	})
+
+	t.Run("First request in progress", func(t *testing.T) {
+		var fail bool
+		app, store, delivered := newIdempotencyTestApp(t, &fail)
+		app.bindRoutes()
+
+		jsonPayload, _ := json.Marshal(n)
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		store.Claim(context.Background(), "key", idempotency.Record{Fingerprint: requestFingerprint(req, jsonPayload)}, time.Hour)
+
+		w := sendWithIdempotencyKey(app, "key", n)
+		if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected status code %d with a Retry-After, got %d %v", http.StatusConflict, w.Code, w.Header())
+		}
+		if len(*delivered) != 0 {
+			t.Errorf("Expected no delivery, got %d", len(*delivered))
+		}
+	})
+
+	t.Run("Server errors are retried", func(t *testing.T) {
+		fail := true
+		app, _, delivered := newIdempotencyTestApp(t, &fail)
+		app.bindRoutes()
+
+		if w := sendWithIdempotencyKey(app, "key", n); w.Code != http.StatusBadGateway {
+			t.Fatalf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+		}
+		fail = false
+		w := sendWithIdempotencyKey(app, "key", n)
+		if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+			t.Errorf("Expected the retry to be handled, got %d %v", w.Code, w.Header())
+		}
+		if len(*delivered) != 1 {
+			t.Errorf("Expected a single delivery, got %d", len(*delivered))
+		}
+	})
+
+	t.Run("Panics are retried", func(t *testing.T) {
+		var fail bool
+		app, store, _ := newIdempotencyTestApp(t, &fail)
+		handler := app.withIdempotency(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		}))
+
+		jsonPayload, _ := json.Marshal(n)
+		req := httptest.NewRequest(http.MethodPost, "/notify/send", bytes.NewBuffer(jsonPayload))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		func() {
+			defer func() { recover() }()
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		if _, claimed, _ := store.Claim(context.Background(), "key", idempotency.Record{}, time.Hour); !claimed {
+			t.Error("Expected the key to be released")
+		}
+	})
+
+	t.Run("Key too long", func(t *testing.T) {
+		var fail bool
+		app, _, _ := newIdempotencyTestApp(t, &fail)
+		app.bindRoutes()
+
+		if w := sendWithIdempotencyKey(app, strings.Repeat("k", 256), n); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"time"
+)
+
+// Reset defines the calendar boundary at which a calendar-aligned RLConfig
+// starts a new window.
+type Reset string
+
+// Supported calendar boundaries. Weeks start on Monday.
+const (
+	ResetHour  = Reset("hour")
+	ResetDay   = Reset("day")
+	ResetWeek  = Reset("week")
+	ResetMonth = Reset("month")
+)
+
+// Resets lists every supported calendar boundary.
+var Resets = []Reset{ResetHour, ResetDay, ResetWeek, ResetMonth}
+
+// Location returns the time zone calendar windows are aligned in: the
+// recipient's one when known, else the configured TimeZone, else UTC. Both
+// are expected to be valid IANA names, see Valid.
+func (c RLConfig) Location(recipient string) *time.Location {
+	return location(recipient, c.TimeZone)
+}
+
+// Period returns the calendar window of a calendar-aligned RLConfig holding
+// now, in loc: it starts at the last Reset boundary and ends at the next one.
+func (c RLConfig) Period(now time.Time, loc *time.Location) (start, end time.Time) {
+	now = now.In(loc)
+	year, month, day := now.Date()
+
+	switch c.Reset {
+	case ResetHour:
+		start = time.Date(year, month, day, now.Hour(), 0, 0, 0, loc)
+		end = start.Add(time.Hour)
+	case ResetWeek:
+		// time.Sunday is 0, go back to the last Monday.
+		start = time.Date(year, month, day-(int(now.Weekday())+6)%7, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 0, 7)
+	case ResetMonth:
+		start = time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(year, month, day, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 0, 1)
+	}
+	return start, end
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRLConfig_Period(t *testing.T) {
+	lisbon, err := time.LoadLocation("Europe/Lisbon")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A Sunday afternoon.
+	now := time.Date(2025, 3, 30, 15, 45, 10, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		reset       Reset
+		loc         *time.Location
+		expectStart time.Time
+		expectEnd   time.Time
+	}{
+		{
+			name:        "hour",
+			reset:       ResetHour,
+			loc:         time.UTC,
+			expectStart: time.Date(2025, 3, 30, 15, 0, 0, 0, time.UTC),
+			expectEnd:   time.Date(2025, 3, 30, 16, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "day",
+			reset:       ResetDay,
+			loc:         time.UTC,
+			expectStart: time.Date(2025, 3, 30, 0, 0, 0, 0, time.UTC),
+			expectEnd:   time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// Lisbon moved to summer time that morning: the day is 23h long.
+			name:        "day in a time zone",
+			reset:       ResetDay,
+			loc:         lisbon,
+			expectStart: time.Date(2025, 3, 30, 0, 0, 0, 0, time.UTC),
+			expectEnd:   time.Date(2025, 3, 30, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "week starts on monday",
+			reset:       ResetWeek,
+			loc:         time.UTC,
+			expectStart: time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC),
+			expectEnd:   time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "month",
+			reset:       ResetMonth,
+			loc:         time.UTC,
+			expectStart: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			expectEnd:   time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := RLConfig{Limit: 1, Reset: tt.reset}.Period(now, tt.loc)
+			if !start.Equal(tt.expectStart) || !end.Equal(tt.expectEnd) {
+				t.Errorf("expected [%v, %v), got [%v, %v)", tt.expectStart, tt.expectEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestRLConfig_Location(t *testing.T) {
+	cfg := RLConfig{Limit: 1, Reset: ResetDay, TimeZone: "Europe/Lisbon"}
+
+	if got := cfg.Location("").String(); got != "Europe/Lisbon" {
+		t.Errorf("expected the configured time zone, got %s", got)
+	}
+	if got := cfg.Location("Asia/Tokyo").String(); got != "Asia/Tokyo" {
+		t.Errorf("expected the recipient time zone, got %s", got)
+	}
+	if got := (RLConfig{Limit: 1, Reset: ResetDay}).Location(""); got != time.UTC {
+		t.Errorf("expected UTC, got %s", got)
+	}
+}
@@ -1,22 +1,460 @@
 package config
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/validator"
 )
 
+// Algorithm defines which rate-limiting algorithm enforces a RLConfig.
+type Algorithm string
+
+// Supported rate-limiting algorithms. An empty Algorithm means
+// AlgorithmFixedWindow.
+const (
+	AlgorithmFixedWindow    = Algorithm("fixed_window")
+	AlgorithmSlidingLog     = Algorithm("sliding_log")
+	AlgorithmSlidingCounter = Algorithm("sliding_window_counter")
+	AlgorithmGCRA           = Algorithm("gcra")
+)
+
+// Algorithms lists every supported rate-limiting algorithm.
+var Algorithms = []Algorithm{AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingCounter, AlgorithmGCRA}
+
 // RLConfig defines a rate-limiter config.
-// WindowSize must be in seconds.
+// WindowSize must be in seconds. Limits files may set it as a human-friendly
+// "window" instead, see ParseWindow.
+//
+// Window based algorithms allow Limit requests per WindowSize. AlgorithmGCRA
+// ignores Limit and instead allows Burst requests at once, replenishing Rate
+// of them every WindowSize, e.g. a burst of 5 and then one every 30 seconds is
+// {Burst: 5, Rate: 1, WindowSize: 30}.
+//
+// Fixed windows can instead be aligned on the calendar with Reset, e.g. 1 per
+// calendar day is {Limit: 1, Reset: ResetDay}, in TimeZone or, when known, the
+// recipient's one. See Period.
 type RLConfig struct {
-	Limit      int `json:"limit"`
-	WindowSize int `json:"window_size"`
+	Algorithm  Algorithm `json:"algorithm,omitempty"`
+	Limit      int       `json:"limit,omitempty"`
+	WindowSize int       `json:"window_size,omitempty"`
+	Burst      int       `json:"burst,omitempty"`
+	Rate       int       `json:"rate,omitempty"`
+	Reset      Reset     `json:"reset,omitempty"`
+	TimeZone   string    `json:"time_zone,omitempty"`
+}
+
+// UnmarshalJSON accepts the window size either as "window_size" seconds or as
+// a "window" duration, e.g. {"limit": 1, "window": "1h"}.
+func (c *RLConfig) UnmarshalJSON(data []byte) error {
+	type rlConfig RLConfig // drops this method to avoid recursing
+	aux := struct {
+		*rlConfig
+		Window string `json:"window"`
+	}{rlConfig: (*rlConfig)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Window == "" {
+		return nil
+	}
+
+	if c.WindowSize != 0 {
+		return errors.New("window and window_size cannot both be set")
+	}
+	seconds, err := ParseWindow(aux.Window)
+	if err != nil {
+		return err
+	}
+	c.WindowSize = seconds
+	return nil
+}
+
+// GetAlgorithm returns the configured algorithm, defaulting to
+// AlgorithmFixedWindow when none is set.
+func (c RLConfig) GetAlgorithm() Algorithm {
+	if c.Algorithm == "" {
+		return AlgorithmFixedWindow
+	}
+	return c.Algorithm
+}
+
+// EmissionInterval returns how often AlgorithmGCRA replenishes one request,
+// i.e. WindowSize divided by Rate.
+func (c RLConfig) EmissionInterval() time.Duration {
+	return time.Duration(c.WindowSize) * time.Second / time.Duration(c.Rate)
+}
+
+// Rules defines every RLConfig a notification type must satisfy. A send is
+// only allowed when all of them allow it, e.g. 2 per minute and 20 per day.
+//
+// In JSON it is either a list of RLConfig or, for a single rule, the RLConfig
+// object itself.
+type Rules []RLConfig
+
+// UnmarshalJSON accepts either a single RLConfig object or a list of them.
+func (r *Rules) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var cfg RLConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		*r = Rules{cfg}
+		return nil
+	}
+
+	var rules []RLConfig
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
+
+// Key returns the rate-limit key of the i-th rule derived from base. A single
+// rule keeps base untouched, stacked rules get their index appended so each
+// one is counted separately.
+func (r Rules) Key(base string, i int) string {
+	if len(r) == 1 {
+		return base
+	}
+	return base + ":" + strconv.Itoa(i)
+}
+
+// Valid checks there is at least one rule and that each of them is valid,
+// prefixing problems with the rule index.
+func (r Rules) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(len(r) > 0, "rules", "at least one rule is required")
+
+	for i, cfg := range r {
+		prefixed := jsonvalidator.PrefixEvaluator(cfg.Valid(ctx), strconv.Itoa(i))
+		for field, msg := range prefixed {
+			eval.AddFieldError(field, msg)
+		}
+	}
+
+	return eval
+}
+
+// LimitPolicy defines what happens to a send of a notification type its rules
+// deny.
+type LimitPolicy string
+
+// Supported limit policies. An empty LimitPolicy means LimitPolicyReject.
+const (
+	// LimitPolicyReject drops the notification.
+	LimitPolicyReject = LimitPolicy("reject")
+	// LimitPolicyDefer queues the notification until its Retry-After, to be
+	// sent as soon as the quota frees up.
+	LimitPolicyDefer = LimitPolicy("defer")
+	// LimitPolicyDigest buffers the notification with the other ones denied to
+	// the same recipient, to be sent combined into a single one once the
+	// quota frees up. See DigestConfig.
+	LimitPolicyDigest = LimitPolicy("digest")
+)
+
+// LimitPolicies lists every supported limit policy.
+var LimitPolicies = []LimitPolicy{LimitPolicyReject, LimitPolicyDefer, LimitPolicyDigest}
+
+// DefaultDigestTemplate is the body of digests configured without a template.
+const DefaultDigestTemplate = "You have {{.Count}} updates"
+
+// DefaultDigestMaxItems is how many messages digests configured without a
+// maximum keep.
+const DefaultDigestMaxItems = 10
+
+// DigestConfig defines how the notifications a LimitPolicyDigest type denies
+// are combined.
+//
+// Template is a text/template of the digest message, executed with the
+// model.Digest, e.g. "You have {{.Count}} updates:{{range .Messages}}
+// {{.}};{{end}}". Only the first MaxItems messages are kept, Count still
+// tells how many there were.
+type DigestConfig struct {
+	MaxItems int    `json:"max_items,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+// GetMaxItems returns the configured maximum of messages, defaulting to
+// DefaultDigestMaxItems when none is set.
+func (d *DigestConfig) GetMaxItems() int {
+	if d == nil || d.MaxItems == 0 {
+		return DefaultDigestMaxItems
+	}
+	return d.MaxItems
+}
+
+// GetTemplate returns the configured template, defaulting to
+// DefaultDigestTemplate when none is set.
+func (d *DigestConfig) GetTemplate() string {
+	if d == nil || d.Template == "" {
+		return DefaultDigestTemplate
+	}
+	return d.Template
+}
+
+// Render executes the configured template with digest.
+func (d *DigestConfig) Render(digest model.Digest) (string, error) {
+	tmpl, err := template.New("digest").Parse(d.GetTemplate())
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, digest); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Valid checks MaxItems is not negative and Template is a valid
+// text/template.
+func (d DigestConfig) Valid(_ context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	// Field: MaxItems
+	eval.CheckField(d.MaxItems >= 0, "max_items", "must not be negative")
+
+	// Field: Template
+	_, err := template.New("digest").Parse(d.GetTemplate())
+	eval.CheckField(err == nil, "template", fmt.Sprintf("must be a valid text/template: %v", err))
+
+	return eval
+}
+
+// DedupConfig defines the window during which a notification type ignores
+// the duplicates of a notification: sends of the same message to the same
+// recipient are acknowledged without being counted nor sent again.
+// WindowSize must be in seconds. Limits files may set it as a human-friendly
+// "window" instead, see ParseWindow.
+type DedupConfig struct {
+	WindowSize int `json:"window_size,omitempty"`
+}
+
+// UnmarshalJSON accepts the window size either as "window_size" seconds or as
+// a "window" duration, e.g. {"window": "10m"}.
+func (d *DedupConfig) UnmarshalJSON(data []byte) error {
+	type dedupConfig DedupConfig // drops this method to avoid recursing
+	aux := struct {
+		*dedupConfig
+		Window string `json:"window"`
+	}{dedupConfig: (*dedupConfig)(d)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Window == "" {
+		return nil
+	}
+
+	if d.WindowSize != 0 {
+		return errors.New("window and window_size cannot both be set")
+	}
+	seconds, err := ParseWindow(aux.Window)
+	if err != nil {
+		return err
+	}
+	d.WindowSize = seconds
+	return nil
+}
+
+// Window returns WindowSize as a time.Duration.
+func (d DedupConfig) Window() time.Duration {
+	return time.Duration(d.WindowSize) * time.Second
+}
+
+// Valid checks WindowSize is set.
+func (d DedupConfig) Valid(_ context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	// Field: WindowSize
+	eval.CheckField(d.WindowSize > 0, "window_size", "this field cannot be blank nor 0")
+
+	return eval
+}
+
+// TypeConfig defines how a notification type is rate-limited: either by its
+// own Rules or by the Rules of the Group it shares a quota with. Either way it
+// is not sent at all during its QuietHours, if any. OnLimit defines what
+// happens to the sends either of them refuses.
+//
+// Each delivery channel is counted separately, by the same rules unless
+// Channels overrides them for that channel, e.g. to leave the in-app inbox
+// unlimited. Duplicates sent within the Dedup window, if any, are ignored
+// before any of them is checked.
+//
+// In JSON it is either {"group": name}, {"rules": rules}, each optionally with
+// "quiet_hours", "on_limit", "digest", "channels" and "dedup", or, as a
+// shorthand for {"rules": rules}, the rules themselves.
+type TypeConfig struct {
+	Group      string                     `json:"group,omitempty"`
+	Rules      Rules                      `json:"rules,omitempty"`
+	QuietHours *QuietHours                `json:"quiet_hours,omitempty"`
+	OnLimit    LimitPolicy                `json:"on_limit,omitempty"`
+	Digest     *DigestConfig              `json:"digest,omitempty"`
+	Channels   map[model.Channel]Override `json:"channels,omitempty"`
+	Dedup      *DedupConfig               `json:"dedup,omitempty"`
+}
+
+// UnmarshalJSON accepts either the TypeConfig object or its Rules alone.
+func (t *TypeConfig) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err == nil {
+		for _, key := range []string{"group", "rules", "quiet_hours", "on_limit", "digest", "channels", "dedup"} {
+			if _, ok := fields[key]; ok {
+				type typeConfig TypeConfig // drops this method to avoid recursing
+				return json.Unmarshal(data, (*typeConfig)(t))
+			}
+		}
+	}
+
+	*t = TypeConfig{}
+	return json.Unmarshal(data, &t.Rules)
+}
+
+// GetOnLimit returns the configured limit policy, defaulting to
+// LimitPolicyReject when none is set.
+func (t TypeConfig) GetOnLimit() LimitPolicy {
+	if t.OnLimit == "" {
+		return LimitPolicyReject
+	}
+	return t.OnLimit
+}
+
+// ChannelRules returns the rules sends over channel are counted by: the
+// override of the channel when there is one, else Rules. An unlimited
+// override resolves to no rules at all.
+func (t TypeConfig) ChannelRules(channel model.Channel) Rules {
+	override, ok := t.Channels[channel]
+	if !ok {
+		return t.Rules
+	}
+	if override.Unlimited {
+		return nil
+	}
+	return override.Rules
+}
+
+// Valid checks a TypeConfig either references a group or has valid Rules of
+// its own, and that its QuietHours, Digest and Dedup, if any, OnLimit and the
+// overrides of its Channels are valid. Whether the group exists is checked by
+// Limits.Valid.
+func (t TypeConfig) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	if t.Group != "" {
+		eval.CheckField(len(t.Rules) == 0, "rules", "a type sharing a group cannot have its own rules")
+	} else {
+		for field, msg := range t.Rules.Valid(ctx) {
+			eval.AddFieldError(field, msg)
+		}
+	}
+
+	if t.QuietHours != nil {
+		for field, msg := range jsonvalidator.PrefixEvaluator(t.QuietHours.Valid(ctx), "quiet_hours") {
+			eval.AddFieldError(field, msg)
+		}
+	}
+
+	// Field: OnLimit
+	eval.CheckField(
+		slices.Contains(LimitPolicies, t.GetOnLimit()),
+		"on_limit",
+		fmt.Sprintf("must be one of %v", LimitPolicies),
+	)
+
+	// Field: Digest
+	if t.Digest != nil {
+		eval.CheckField(t.GetOnLimit() == LimitPolicyDigest, "digest", "only used by the digest on_limit policy")
+		for field, msg := range jsonvalidator.PrefixEvaluator(t.Digest.Valid(ctx), "digest") {
+			eval.AddFieldError(field, msg)
+		}
+	}
+
+	// Field: Channels
+	for channel, override := range t.Channels {
+		field := "channels." + string(channel)
+		eval.CheckField(slices.Contains(model.Channels, channel), field, fmt.Sprintf("must be one of %v", model.Channels))
+		for f, msg := range jsonvalidator.PrefixEvaluator(override.Valid(ctx), field) {
+			eval.AddFieldError(f, msg)
+		}
+	}
+
+	// Field: Dedup
+	if t.Dedup != nil {
+		for field, msg := range jsonvalidator.PrefixEvaluator(t.Dedup.Valid(ctx), "dedup") {
+			eval.AddFieldError(field, msg)
+		}
+	}
+
+	return eval
 }
 
 // Provider defines a rate-limiter config provider
 type Provider interface {
-	GetConfig(model.NotificationType) (RLConfig, bool)
+	// GetConfig returns the config of a notification type, with the Rules of
+	// its group already resolved when it belongs to one.
+	GetConfig(model.NotificationType) (TypeConfig, bool)
+	GetGlobalConfig() Rules
+	// NotificationTypes returns every configured notification type, sorted.
+	NotificationTypes() []model.NotificationType
+}
+
+// ErrVersionConflict is returned by WritableProvider.Update when the Limits
+// were changed since the version the update was based on.
+var ErrVersionConflict = errors.New("rate-limit config was changed concurrently")
+
+// WritableProvider defines a Provider whose Limits can be changed at runtime.
+type WritableProvider interface {
+	Provider
+	// Limits returns the Limits currently served and their version.
+	Limits() (Limits, int64)
+	// Update validates limits and makes them the ones served, returning an
+	// *InvalidLimitsError when they are not valid. version is the one of the
+	// Limits the update was based on: when they changed since, nothing is
+	// updated and ErrVersionConflict is returned.
+	Update(ctx context.Context, version int64, limits Limits) error
+}
+
+// ErrUnknownVersion is returned by VersionedProvider.Rollback for a version
+// that is not kept, or never was.
+var ErrUnknownVersion = errors.New("unknown rate-limit config version")
+
+// Version defines Limits as served under a version.
+type Version struct {
+	Version int64  `json:"version"`
+	Limits  Limits `json:"limits"`
+}
+
+// VersionedProvider defines a WritableProvider keeping its previous versions
+// for rollbacks.
+type VersionedProvider interface {
+	WritableProvider
+	// History returns the versions still kept, newest first.
+	History(ctx context.Context) ([]Version, error)
+	// Rollback serves again the Limits of a previous version, returning the
+	// new version they get, or ErrUnknownVersion when it is not kept.
+	Rollback(ctx context.Context, version int64) (int64, error)
+}
+
+// InvalidLimitsError reports the problems of Limits a WritableProvider
+// rejected.
+type InvalidLimitsError struct {
+	Problems validator.Evaluator
+}
+
+func (e *InvalidLimitsError) Error() string {
+	return fmt.Sprintf("invalid rate-limit config: %d problems", len(e.Problems))
 }
 
 // Valid check each field from a given config returning a validator.Evaluator.
@@ -24,11 +462,58 @@ type Provider interface {
 func (c RLConfig) Valid(_ context.Context) validator.Evaluator {
 	var eval validator.Evaluator
 
-	// Field: Limit
-	eval.CheckField(c.Limit > 0, "limit", "this field cannot be blank nor 0")
+	// Field: Algorithm
+	eval.CheckField(
+		slices.Contains(Algorithms, c.GetAlgorithm()),
+		"algorithm",
+		fmt.Sprintf("must be one of %v", Algorithms),
+	)
+
+	if c.GetAlgorithm() == AlgorithmGCRA {
+		// Field: Burst
+		eval.CheckField(c.Burst > 0, "burst", "this field cannot be blank nor 0")
+
+		// Field: Rate
+		eval.CheckField(c.Rate > 0, "rate", "this field cannot be blank nor 0")
+		eval.CheckField(
+			c.Rate <= 0 || c.WindowSize <= 0 || c.EmissionInterval() >= time.Millisecond,
+			"rate",
+			"cannot replenish more than one request per millisecond",
+		)
+
+		// Field: Limit
+		eval.CheckField(c.Limit == 0, "limit", "not used by gcra, use burst and rate instead")
+	} else {
+		// Field: Limit
+		eval.CheckField(c.Limit > 0, "limit", "this field cannot be blank nor 0")
+
+		// Field: Burst
+		eval.CheckField(c.Burst == 0, "burst", "only used by gcra")
+
+		// Field: Rate
+		eval.CheckField(c.Rate == 0, "rate", "only used by gcra")
+	}
+
+	if c.Reset != "" {
+		// Field: Reset
+		eval.CheckField(slices.Contains(Resets, c.Reset), "reset", fmt.Sprintf("must be one of %v", Resets))
+		eval.CheckField(c.GetAlgorithm() == AlgorithmFixedWindow, "reset", "only used by fixed_window")
+
+		// Field: WindowSize
+		eval.CheckField(c.WindowSize == 0, "window_size", "calendar windows are sized by reset")
+
+		// Field: TimeZone
+		_, err := time.LoadLocation(c.TimeZone)
+		eval.CheckField(err == nil, "time_zone", "must be an IANA time zone, e.g. Europe/Lisbon")
+
+		return eval
+	}
 
 	// Field: WindowSize
 	eval.CheckField(c.WindowSize > 0, "window_size", "this field cannot be blank nor 0")
 
+	// Field: TimeZone
+	eval.CheckField(c.TimeZone == "", "time_zone", "only used with reset")
+
 	return eval
 }
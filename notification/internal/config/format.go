@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format defines the encoding of a limits file.
+type Format string
+
+// Supported limits file formats.
+const (
+	FormatJSON = Format("json")
+	FormatYAML = Format("yaml")
+	FormatTOML = Format("toml")
+)
+
+var ErrUnknownFormat = errors.New("unknown rate-limit config format")
+
+// FormatOf picks the Format of a limits file from its extension: .json, .yaml,
+// .yml or .toml.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("%w: %q, expected a .json, .yaml, .yml or .toml file", ErrUnknownFormat, path)
+}
+
+// toJSON re-encodes a limits file as JSON, so every format is decoded and
+// validated by the very same code, shorthands included.
+func toJSON(data []byte, format Format) ([]byte, error) {
+	var doc map[string]any
+	switch format {
+	case FormatJSON:
+		return data, nil
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("decode yaml: %w", err)
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("decode toml: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s as json: %w", format, err)
+	}
+	return data, nil
+}
+
+// ParseWindow parses a human-friendly window size into seconds, e.g. "90s",
+// "1h30m" or "1d". It accepts any time.ParseDuration duration, optionally
+// preceded by a number of days, as long as it is a whole number of seconds.
+func ParseWindow(s string) (int, error) {
+	var window time.Duration
+
+	rest := s
+	if days, after, found := strings.Cut(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid window %q: days must be a whole number", s)
+		}
+		window, rest = time.Duration(n)*24*time.Hour, after
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q: %w", s, err)
+		}
+		window += d
+	}
+
+	if window%time.Second != 0 {
+		return 0, fmt.Errorf("invalid window %q: must be a whole number of seconds", s)
+	}
+	return int(window / time.Second), nil
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// jsonLimits sets a global cap, a group and stacked rules, so every format is
+// checked to decode all of them the same way.
+const jsonLimits = `{
+  "$schema": "./limits.schema.json",
+  "global": {"limit": 10, "window_size": 3600},
+  "groups": {
+    "promotional": {"algorithm": "sliding_window_counter", "limit": 3, "window_size": 3600}
+  },
+  "types": {
+    "news-notification": {"limit": 1, "window_size": 86400},
+    "status-notification": [
+      {"algorithm": "sliding_log", "limit": 2, "window_size": 60},
+      {"limit": 20, "window_size": 86400}
+    ],
+    "marketing-notification": {"group": "promotional"},
+    "promotions-notification": {"group": "promotional"},
+    "product-tips-notification": {"group": "promotional"}
+  }
+}`
+
+const yamlLimits = `# Same limits as jsonLimits.
+global:
+  limit: 10
+  window: 1h
+
+groups:
+  promotional:
+    algorithm: sliding_window_counter
+    limit: 3
+    window: 1h
+
+types:
+  news-notification:
+    limit: 1
+    window: 1d
+  status-notification:
+    - algorithm: sliding_log # no bursts across minutes
+      limit: 2
+      window: 1m
+    - limit: 20
+      window_size: 86400
+  marketing-notification:
+    group: promotional
+  promotions-notification:
+    group: promotional
+  product-tips-notification:
+    group: promotional
+`
+
+const tomlLimits = `# Same limits as jsonLimits.
+global = { limit = 10, window = "1h" }
+
+[groups.promotional]
+algorithm = "sliding_window_counter"
+limit = 3
+window = "1h"
+
+[types.news-notification]
+limit = 1
+window = "1d"
+
+[[types.status-notification]]
+algorithm = "sliding_log" # no bursts across minutes
+limit = 2
+window = "1m"
+
+[[types.status-notification]]
+limit = 20
+window_size = 86400
+
+[types.marketing-notification]
+group = "promotional"
+
+[types.promotions-notification]
+group = "promotional"
+
+[types.product-tips-notification]
+group = "promotional"
+`
+
+func TestLoadFromFile_Formats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	writeLimits(t, path, jsonLimits)
+	expected, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, body := range map[string]string{
+		"limits.yaml": yamlLimits,
+		"limits.yml":  yamlLimits,
+		"limits.toml": tomlLimits,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			writeLimits(t, path, body)
+
+			limits, err := LoadFromFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(limits, expected) {
+				t.Errorf("expected %+v, got %+v", expected, limits)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "limits.yaml", body: "types: [news-notification"},
+		{name: "limits.toml", body: "[types.news-notification\nlimit = 1"},
+		{name: "invalid.yaml", body: "types:\n  news-notification:\n    limit: 1\n"},
+		{name: "invalid.toml", body: "[types.news-notification]\nlimit = 1\nwindow = \"1.5s\"\n"},
+		{name: "limits.ini", body: "[types]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			writeLimits(t, path, tt.body)
+
+			if _, err := LoadFromFile(path); err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+		})
+	}
+
+	if _, err := LoadFromFile("limits.ini"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		window    string
+		expected  int
+		expectErr bool
+	}{
+		{window: "90s", expected: 90},
+		{window: "1m", expected: 60},
+		{window: "1h30m", expected: 5400},
+		{window: "1d", expected: 86400},
+		{window: "7d", expected: 7 * 86400},
+		{window: "1d12h", expected: 129600},
+		{window: "1500ms", expectErr: true},
+		{window: "1.5d", expectErr: true},
+		{window: "d", expectErr: true},
+		{window: "an hour", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			got, err := ParseWindow(tt.window)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %d seconds, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLimitsSchema_ListsEveryEnumValue(t *testing.T) {
+	data, err := os.ReadFile("limits.schema.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var schema struct {
+		Properties struct {
+			Types struct {
+				PropertyNames struct {
+					Not struct {
+						Enum []model.NotificationType `json:"enum"`
+					} `json:"not"`
+				} `json:"propertyNames"`
+			} `json:"types"`
+		} `json:"properties"`
+		Defs struct {
+			Name struct {
+				Pattern string `json:"pattern"`
+			} `json:"name"`
+			Channels struct {
+				PropertyNames struct {
+					Enum []model.Channel `json:"enum"`
+				} `json:"propertyNames"`
+			} `json:"channels"`
+			OnLimit struct {
+				Enum []LimitPolicy `json:"enum"`
+			} `json:"onLimit"`
+			Rule struct {
+				Properties struct {
+					Algorithm struct {
+						Enum []Algorithm `json:"enum"`
+					} `json:"algorithm"`
+					Reset struct {
+						Enum []Reset `json:"enum"`
+					} `json:"reset"`
+				} `json:"properties"`
+			} `json:"rule"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+
+	if got := schema.Defs.Rule.Properties.Algorithm.Enum; !slices.Equal(got, Algorithms) {
+		t.Errorf("expected the schema to list %v, got %v", Algorithms, got)
+	}
+	if got := schema.Defs.Rule.Properties.Reset.Enum; !slices.Equal(got, Resets) {
+		t.Errorf("expected the schema to list %v, got %v", Resets, got)
+	}
+	if got := schema.Defs.OnLimit.Enum; !slices.Equal(got, LimitPolicies) {
+		t.Errorf("expected the schema to list %v, got %v", LimitPolicies, got)
+	}
+	if got := schema.Defs.Channels.PropertyNames.Enum; !slices.Equal(got, model.Channels) {
+		t.Errorf("expected the schema to list %v, got %v", model.Channels, got)
+	}
+	if got := schema.Defs.Name.Pattern; got != namePattern.String() {
+		t.Errorf("expected the schema to match names with %s, got %s", namePattern, got)
+	}
+	if got := schema.Properties.Types.PropertyNames.Not.Enum; !slices.Equal(got, reservedTypes) {
+		t.Errorf("expected the schema to reserve %v, got %v", reservedTypes, got)
+	}
+}
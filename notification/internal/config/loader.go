@@ -3,8 +3,14 @@ package config
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"sync/atomic"
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
@@ -14,60 +20,209 @@ import (
 //go:embed limits.json
 var embeddedLimitsJSON []byte
 
-// RLConfigProvider defines a configuration provider
+// RLConfigProvider defines a configuration provider. Its Limits can be
+// swapped at runtime, see Store and WatchFile.
 type RLConfigProvider struct {
-	limits rlConfigMap
+	limits atomic.Pointer[versionedLimits]
 }
 
-type rlConfigMap map[model.NotificationType]RLConfig
+// versionedLimits defines Limits and the version they are served at.
+type versionedLimits struct {
+	Limits
+	version int64
+}
 
-// Valid checks for each valid RLConfig within the rlConfigMap
-// LoadFromEmbedded reads configs from the embedded limits.json file and returns a
-// map[model.NotificationType]RLConfig that must be used with a provider.
-func LoadFromEmbedded() (map[model.NotificationType]RLConfig, error) {
-	configMap, problems, err := jsonvalidator.DecodeValidJsonFromBytes[rlConfigMap](context.Background(), embeddedLimitsJSON)
-	if err != nil {
-		slog.Error("failed to unmarshall configurations from embedded file", "problems", problems, "original-error", err)
-		return nil, err
+// Limits defines every rate-limit rule read from a limits file.
+//
+// In JSON it is {"global": rules, "groups": {name: rules}, "types": {type:
+// TypeConfig}}. A plain {type: rules} map, without a global cap nor groups, is
+// also accepted. A "$schema" key, pointing editors at limits.schema.json, is
+// ignored.
+type Limits struct {
+	// Global rules are enforced on every send to a recipient, whatever its
+	// notification type. No rules means no cross-type cap.
+	Global Rules `json:"global,omitempty"`
+	// Groups holds the rules of quotas shared by several notification types.
+	Groups map[string]Rules `json:"groups,omitempty"`
+	// Types holds the config of each notification type.
+	Types map[model.NotificationType]TypeConfig `json:"types"`
+}
+
+// UnmarshalJSON accepts both the {"global", "groups", "types"} layout and a
+// plain map of notification types to rules.
+func (l *Limits) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
 	}
-	return configMap, nil
+
+	if _, ok := fields["types"]; !ok {
+		// The "$schema" editors read is the only key that is not a type.
+		delete(fields, "$schema")
+		l.Global, l.Groups, l.Types = nil, nil, make(map[model.NotificationType]TypeConfig, len(fields))
+		for t, raw := range fields {
+			var cfg TypeConfig
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return err
+			}
+			l.Types[model.NotificationType(t)] = cfg
+		}
+		return nil
+	}
+
+	type limits Limits // drops this method to avoid recursing
+	return json.Unmarshal(data, (*limits)(l))
 }
 
-func (m rlConfigMap) Valid(ctx context.Context) validator.Evaluator {
+// namePattern is what notification type and group names must match: they are
+// part of the rate-limit keys, whose segments are separated by ':', and of
+// the subject of emails.
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// namePatternMessage explains namePattern to whoever configured a name
+// failing it.
+const namePatternMessage = "must only hold lowercase letters, digits, '-' and '_', starting with a letter or a digit"
+
+// reservedTypes are the notification type names the keys of other quotas
+// start with, see model.GenGlobalKey and model.NotificationType.GenKey.
+var reservedTypes = []model.NotificationType{"global", "group"}
+
+// Valid checks the global rules, when set, every group rules and every
+// notification type config, including that the groups they reference exist,
+// and the names of both.
+func (l Limits) Valid(ctx context.Context) validator.Evaluator {
 	var eval validator.Evaluator
 
-	for key, cfg := range m {
-		prefixed := jsonvalidator.PrefixEvaluator(cfg.Valid(ctx), string(key))
-		for field, msg := range prefixed {
+	if len(l.Global) > 0 {
+		for field, msg := range jsonvalidator.PrefixEvaluator(l.Global.Valid(ctx), "global") {
 			eval.AddFieldError(field, msg)
 		}
 	}
 
+	for name, rules := range l.Groups {
+		eval.CheckField(namePattern.MatchString(name), "groups."+name, namePatternMessage)
+		for field, msg := range jsonvalidator.PrefixEvaluator(rules.Valid(ctx), "groups."+name) {
+			eval.AddFieldError(field, msg)
+		}
+	}
+
+	for key, cfg := range l.Types {
+		prefix := "types." + string(key)
+		eval.CheckField(namePattern.MatchString(string(key)), prefix, namePatternMessage)
+		eval.CheckField(!slices.Contains(reservedTypes, key), prefix, fmt.Sprintf("%q is reserved", key))
+		for field, msg := range jsonvalidator.PrefixEvaluator(cfg.Valid(ctx), prefix) {
+			eval.AddFieldError(field, msg)
+		}
+		if cfg.Group != "" {
+			_, ok := l.Groups[cfg.Group]
+			eval.CheckField(ok, prefix+".group", fmt.Sprintf("unknown group %q", cfg.Group))
+		}
+	}
+
 	return eval
 }
 
-// New creates a RLConfigProvider and returns it.
-func NewRLConfigProvider(limits rlConfigMap) *RLConfigProvider {
-	return &RLConfigProvider{limits}
+// LoadFromEmbedded reads configs from the embedded limits.json file and returns
+// the Limits that must be used with a provider.
+func LoadFromEmbedded() (Limits, error) {
+	limits, problems, err := jsonvalidator.DecodeValidJsonFromBytes[Limits](context.Background(), embeddedLimitsJSON)
+	if err != nil {
+		slog.Error("failed to unmarshall configurations from embedded file", "problems", problems, "original-error", err)
+		return Limits{}, err
+	}
+	return limits, nil
 }
 
-// GetConfig Gets a config from the map
-func (rlc *RLConfigProvider) GetConfig(t model.NotificationType) (RLConfig, bool) {
-	cfg, ok := rlc.limits[t]
+// New creates a RLConfigProvider serving limits at version 0 and returns it.
+func NewRLConfigProvider(limits Limits) *RLConfigProvider {
+	rlc := &RLConfigProvider{}
+	rlc.StoreVersion(limits, 0)
+	return rlc
+}
+
+// Store atomically replaces the Limits of the provider, bumping their
+// version. Callers are expected to have validated them.
+func (rlc *RLConfigProvider) Store(limits Limits) {
+	for {
+		current := rlc.limits.Load()
+		if rlc.limits.CompareAndSwap(current, &versionedLimits{limits, current.version + 1}) {
+			return
+		}
+	}
+}
+
+// StoreVersion atomically replaces the Limits of the provider, served at
+// version from now on. Callers are expected to have validated them.
+func (rlc *RLConfigProvider) StoreVersion(limits Limits, version int64) {
+	rlc.limits.Store(&versionedLimits{limits, version})
+}
+
+// Limits gets the Limits currently served and their version
+func (rlc *RLConfigProvider) Limits() (Limits, int64) {
+	current := rlc.limits.Load()
+	return current.Limits, current.version
+}
+
+// Update validates limits and swaps them in, unless the Limits served are not
+// at version anymore. They only live in memory: a reload of the limits file
+// replaces them.
+func (rlc *RLConfigProvider) Update(ctx context.Context, version int64, limits Limits) error {
+	if problems := limits.Valid(ctx); len(problems) > 0 {
+		return &InvalidLimitsError{problems}
+	}
+	current := rlc.limits.Load()
+	if current.version != version || !rlc.limits.CompareAndSwap(current, &versionedLimits{limits, version + 1}) {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// GetConfig Gets a config from the map, resolving the rules of its group
+func (rlc *RLConfigProvider) GetConfig(t model.NotificationType) (TypeConfig, bool) {
+	limits := rlc.limits.Load()
+	cfg, ok := limits.Types[t]
+	if ok && cfg.Group != "" {
+		cfg.Rules = limits.Groups[cfg.Group]
+	}
 	return cfg, ok
 }
 
-// LoadFromJsonFile read configs from a json file and returns a
-// map[model.NotificationType]RLConfig that must be used with a provider.
-func LoadFromJsonFile(path string) (map[model.NotificationType]RLConfig, error) {
+// NotificationTypes gets every configured notification type, sorted
+func (rlc *RLConfigProvider) NotificationTypes() []model.NotificationType {
+	return slices.Sorted(maps.Keys(rlc.limits.Load().Types))
+}
+
+// GetGlobalConfig gets the rules shared by every notification type sent to a
+// recipient, nil when there is no global cap.
+func (rlc *RLConfigProvider) GetGlobalConfig() Rules {
+	return rlc.limits.Load().Global
+}
+
+// LoadFromFile reads configs from a JSON, YAML or TOML file, picked by its
+// extension, and returns the Limits that must be used with a provider.
+func LoadFromFile(path string) (Limits, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return Limits{}, err
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return Limits{}, err
 	}
-	configMap, problems, err := jsonvalidator.DecodeValidJsonFromBytes[rlConfigMap](context.Background(), data)
+	limits, problems, err := DecodeLimits(context.Background(), data, format)
 	if err != nil {
 		slog.Error("failed to unmarshall configurations from file", "filepath", path, "problems", problems, "original-error", err)
-		return nil, err
+		return Limits{}, err
+	}
+	return limits, nil
+}
+
+// DecodeLimits decodes and validates Limits encoded in format, returning the
+// validation problems, if any, with the error.
+func DecodeLimits(ctx context.Context, data []byte, format Format) (Limits, map[string]string, error) {
+	data, err := toJSON(data, format)
+	if err != nil {
+		return Limits{}, nil, err
 	}
-	return configMap, nil
+	return jsonvalidator.DecodeValidJsonFromBytes[Limits](ctx, data)
 }
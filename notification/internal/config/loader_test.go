@@ -0,0 +1,424 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
+)
+
+func TestLimits_Decode(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectErr    bool
+		expectGlobal int
+		expectTypes  int
+	}{
+		{
+			name:        "plain map of types",
+			body:        `{"news-notification": {"limit": 1, "window_size": 86400}}`,
+			expectTypes: 1,
+		},
+		{
+			name: "global cap and types",
+			body: `{
+				"global": {"limit": 10, "window_size": 3600},
+				"types": {
+					"news-notification": {"limit": 1, "window_size": 86400},
+					"status-notification": [{"limit": 2, "window_size": 60}, {"limit": 20, "window_size": 86400}]
+				}
+			}`,
+			expectGlobal: 1,
+			expectTypes:  2,
+		},
+		{
+			name:        "types without a global cap",
+			body:        `{"types": {"news-notification": {"limit": 1, "window_size": 86400}}}`,
+			expectTypes: 1,
+		},
+		{
+			name: "types sharing a group",
+			body: `{
+				"groups": {"promotional": {"limit": 3, "window_size": 3600}},
+				"types": {
+					"marketing-notification": {"group": "promotional"},
+					"promotions-notification": {"group": "promotional"},
+					"news-notification": {"rules": {"limit": 1, "window_size": 86400}}
+				}
+			}`,
+			expectTypes: 3,
+		},
+		{
+			name:      "unknown group",
+			body:      `{"types": {"marketing-notification": {"group": "promotional"}}}`,
+			expectErr: true,
+		},
+		{
+			name: "group and own rules",
+			body: `{
+				"groups": {"promotional": {"limit": 3, "window_size": 3600}},
+				"types": {"marketing-notification": {"group": "promotional", "rules": {"limit": 1, "window_size": 60}}}
+			}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid group rule",
+			body:      `{"groups": {"promotional": {"limit": 3}}, "types": {}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid global cap",
+			body:      `{"global": {"limit": 0, "window_size": 3600}, "types": {}}`,
+			expectErr: true,
+		},
+		{
+			name: "human-friendly windows",
+			body: `{
+				"global": {"limit": 10, "window": "1h"},
+				"types": {"news-notification": {"limit": 1, "window": "1d"}}
+			}`,
+			expectGlobal: 1,
+			expectTypes:  1,
+		},
+		{
+			name:      "window and window_size",
+			body:      `{"types": {"news-notification": {"limit": 1, "window": "1h", "window_size": 3600}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid window",
+			body:      `{"types": {"news-notification": {"limit": 1, "window": "one hour"}}}`,
+			expectErr: true,
+		},
+		{
+			name:        "plain map of types with a schema",
+			body:        `{"$schema": "./limits.schema.json", "news-notification": {"limit": 1, "window_size": 86400}}`,
+			expectTypes: 1,
+		},
+		{
+			name:        "gcra replenishing once per millisecond",
+			body:        `{"types": {"status-notification": {"algorithm": "gcra", "burst": 5, "rate": 1000, "window_size": 1}}}`,
+			expectTypes: 1,
+		},
+		{
+			name:      "gcra replenishing more than once per millisecond",
+			body:      `{"types": {"status-notification": {"algorithm": "gcra", "burst": 5, "rate": 5000, "window_size": 1}}}`,
+			expectErr: true,
+		},
+		{
+			name:        "calendar window",
+			body:        `{"types": {"news-notification": {"limit": 1, "reset": "day", "time_zone": "Europe/Lisbon"}}}`,
+			expectTypes: 1,
+		},
+		{
+			name:      "calendar window with a window size",
+			body:      `{"types": {"news-notification": {"limit": 1, "reset": "day", "window_size": 86400}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "calendar window with another algorithm",
+			body:      `{"types": {"news-notification": {"algorithm": "sliding_log", "limit": 1, "reset": "day"}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "unknown calendar boundary",
+			body:      `{"types": {"news-notification": {"limit": 1, "reset": "fortnight"}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "unknown time zone",
+			body:      `{"types": {"news-notification": {"limit": 1, "reset": "day", "time_zone": "Mars/Olympus"}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "time zone without a calendar window",
+			body:      `{"types": {"news-notification": {"limit": 1, "window_size": 86400, "time_zone": "Europe/Lisbon"}}}`,
+			expectErr: true,
+		},
+		{
+			name: "quiet hours",
+			body: `{
+				"groups": {"promotional": {"limit": 3, "window_size": 3600}},
+				"types": {
+					"marketing-notification": {"group": "promotional", "quiet_hours": {"start": "22:00", "end": "08:00"}},
+					"news-notification": {"rules": {"limit": 1, "window_size": 86400}, "quiet_hours": {"start": "22:00", "end": "08:00", "time_zone": "Europe/Lisbon"}}
+				}
+			}`,
+			expectTypes: 2,
+		},
+		{
+			name:      "quiet hours without rules",
+			body:      `{"types": {"news-notification": {"quiet_hours": {"start": "22:00", "end": "08:00"}}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid quiet hours",
+			body:      `{"types": {"news-notification": {"rules": {"limit": 1, "window_size": 86400}, "quiet_hours": {"start": "22:00"}}}}`,
+			expectErr: true,
+		},
+		{
+			name:        "defer policy",
+			body:        `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "on_limit": "defer"}}}`,
+			expectTypes: 1,
+		},
+		{
+			name:      "unknown limit policy",
+			body:      `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "on_limit": "retry"}}}`,
+			expectErr: true,
+		},
+		{
+			name:        "digest policy",
+			body:        `{"types": {"news-notification": {"rules": {"limit": 1, "window_size": 60}, "on_limit": "digest", "digest": {"max_items": 5, "template": "{{.Count}} news"}}}}`,
+			expectTypes: 1,
+		},
+		{
+			name:      "digest without the digest policy",
+			body:      `{"types": {"news-notification": {"rules": {"limit": 1, "window_size": 60}, "on_limit": "defer", "digest": {"max_items": 5}}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid digest template",
+			body:      `{"types": {"news-notification": {"rules": {"limit": 1, "window_size": 60}, "on_limit": "digest", "digest": {"template": "{{.Count"}}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "negative digest max items",
+			body:      `{"types": {"news-notification": {"rules": {"limit": 1, "window_size": 60}, "on_limit": "digest", "digest": {"max_items": -1}}}}`,
+			expectErr: true,
+		},
+		{
+			name:        "channel overrides",
+			body:        `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "channels": {"email": {"rules": {"limit": 2, "window": "1m"}}, "in-app": {"unlimited": true}}}}}`,
+			expectTypes: 1,
+		},
+		{
+			name:      "unknown channel",
+			body:      `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "channels": {"fax": {"unlimited": true}}}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid channel override",
+			body:      `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "channels": {"email": {"rules": {"limit": 2}}}}}}`,
+			expectErr: true,
+		},
+		{
+			name:        "dedup window",
+			body:        `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "dedup": {"window": "10m"}}}}`,
+			expectTypes: 1,
+		},
+		{
+			name:      "dedup without a window",
+			body:      `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "dedup": {}}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "dedup with both window and window_size",
+			body:      `{"types": {"status-notification": {"rules": {"limit": 1, "window_size": 60}, "dedup": {"window": "1m", "window_size": 60}}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid type rule",
+			body:      `{"types": {"news-notification": {"limit": 1}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "type named like the global cap",
+			body:      `{"types": {"global": {"limit": 1, "window_size": 60}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "type named like a group",
+			body:      `{"types": {"group": {"limit": 1, "window_size": 60}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "type name with a key separator",
+			body:      `{"types": {"news:notification": {"limit": 1, "window_size": 60}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "type name with a line break",
+			body:      `{"news-notification\r\nBcc: someone@example.com": {"limit": 1, "window_size": 60}}`,
+			expectErr: true,
+		},
+		{
+			name:      "group name with a key separator",
+			body:      `{"groups": {"promo:tional": {"limit": 3, "window_size": 3600}}, "types": {}}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits, problems, err := jsonvalidator.DecodeValidJsonFromBytes[Limits](context.Background(), []byte(tt.body))
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v (problems: %v)", err, problems)
+			}
+			if len(limits.Global) != tt.expectGlobal {
+				t.Errorf("expected %d global rules, got %d", tt.expectGlobal, len(limits.Global))
+			}
+			if len(limits.Types) != tt.expectTypes {
+				t.Errorf("expected %d types, got %d", tt.expectTypes, len(limits.Types))
+			}
+		})
+	}
+}
+
+func TestLoadFromEmbedded(t *testing.T) {
+	limits, err := LoadFromEmbedded()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	provider := NewRLConfigProvider(limits)
+	for _, nt := range []model.NotificationType{
+		model.NotificationTypeNews,
+		model.NotificationTypeStatus,
+		model.NotificationTypeMarketing,
+	} {
+		cfg, ok := provider.GetConfig(nt)
+		if !ok || len(cfg.Rules) == 0 {
+			t.Errorf("expected rules for %s, got %+v", nt, cfg)
+		}
+	}
+}
+
+func TestRLConfigProvider_GetConfigResolvesGroups(t *testing.T) {
+	provider := NewRLConfigProvider(Limits{
+		Groups: map[string]Rules{"promotional": {{Limit: 3, WindowSize: 3600}}},
+		Types: map[model.NotificationType]TypeConfig{
+			model.NotificationTypeStatus:    {Group: "promotional"},
+			model.NotificationTypeMarketing: {Group: "promotional"},
+			model.NotificationTypeNews:      {Rules: Rules{{Limit: 1, WindowSize: 86400}}},
+		},
+	})
+
+	marketing, _ := provider.GetConfig(model.NotificationTypeMarketing)
+	status, _ := provider.GetConfig(model.NotificationTypeStatus)
+	if marketing.Group != "promotional" || status.Group != "promotional" {
+		t.Errorf("expected both types in the promotional group, got %q and %q", marketing.Group, status.Group)
+	}
+	if len(marketing.Rules) != 1 || marketing.Rules[0].Limit != 3 {
+		t.Errorf("expected the group rules, got %+v", marketing.Rules)
+	}
+
+	news, _ := provider.GetConfig(model.NotificationTypeNews)
+	if news.Group != "" || len(news.Rules) != 1 || news.Rules[0].Limit != 1 {
+		t.Errorf("expected the type own rules, got %+v", news)
+	}
+}
+
+func TestRLConfigProvider_NotificationTypes(t *testing.T) {
+	provider := NewRLConfigProvider(Limits{
+		Types: map[model.NotificationType]TypeConfig{
+			model.NotificationTypeStatus: {Rules: Rules{{Limit: 2, WindowSize: 60}}},
+			"security-notification":      {Rules: Rules{{Limit: 5, WindowSize: 60}}},
+			model.NotificationTypeNews:   {Rules: Rules{{Limit: 1, WindowSize: 86400}}},
+		},
+	})
+
+	expected := []model.NotificationType{"news-notification", "security-notification", "status-notification"}
+	if got := provider.NotificationTypes(); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRLConfigProvider_Update(t *testing.T) {
+	ctx := context.Background()
+	news := func(limit int) Limits {
+		return Limits{Types: map[model.NotificationType]TypeConfig{
+			model.NotificationTypeNews: {Rules: Rules{{Limit: limit, WindowSize: 86400}}},
+		}}
+	}
+	provider := NewRLConfigProvider(news(1))
+
+	_, version := provider.Limits()
+	if err := provider.Update(ctx, version, news(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Both edits were based on the same version, the second one lost the race.
+	if err := provider.Update(ctx, version, news(3)); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict, got %v", err)
+	}
+	// A reload of the limits file is a change of its own.
+	limits, version := provider.Limits()
+	provider.Store(limits)
+	if err := provider.Update(ctx, version, news(3)); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict after a reload, got %v", err)
+	}
+	if cfg, _ := provider.GetConfig(model.NotificationTypeNews); cfg.Rules[0].Limit != 2 {
+		t.Errorf("expected the first edit to be kept, got %+v", cfg)
+	}
+
+	var invalid *InvalidLimitsError
+	_, version = provider.Limits()
+	if err := provider.Update(ctx, version, news(0)); !errors.As(err, &invalid) {
+		t.Errorf("expected InvalidLimitsError, got %v", err)
+	}
+}
+
+func TestDigestConfig_Render(t *testing.T) {
+	digest := model.Digest{Messages: []string{"first", "second"}, Count: 3}
+
+	tests := []struct {
+		name     string
+		config   *DigestConfig
+		expected string
+	}{
+		{name: "default template", expected: "You have 3 updates"},
+		{name: "empty config", config: &DigestConfig{}, expected: "You have 3 updates"},
+		{
+			name:     "custom template",
+			config:   &DigestConfig{Template: "{{.Count}} news:{{range .Messages}} {{.}};{{end}}"},
+			expected: "3 news: first; second;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Render(digest)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTypeConfig_ChannelRules(t *testing.T) {
+	rules := Rules{{Limit: 1, WindowSize: 60}}
+	email := Rules{{Limit: 2, WindowSize: 60}}
+	cfg := TypeConfig{
+		Rules: rules,
+		Channels: map[model.Channel]Override{
+			model.ChannelEmail: {Rules: email},
+			model.ChannelInApp: {Unlimited: true},
+		},
+	}
+
+	if got := cfg.ChannelRules(""); !slices.Equal(got, rules) {
+		t.Errorf("expected the type rules without a channel, got %v", got)
+	}
+	if got := cfg.ChannelRules(model.ChannelSMS); !slices.Equal(got, rules) {
+		t.Errorf("expected the type rules for a channel without override, got %v", got)
+	}
+	if got := cfg.ChannelRules(model.ChannelEmail); !slices.Equal(got, email) {
+		t.Errorf("expected the email override, got %v", got)
+	}
+	if got := cfg.ChannelRules(model.ChannelInApp); got != nil {
+		t.Errorf("expected no rules for an unlimited channel, got %v", got)
+	}
+}
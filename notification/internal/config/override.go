@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/jsonvalidator"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/validator"
+)
+
+// Override defines limits taking precedence over the rules of a notification
+// type: those of a single recipient or of a delivery channel, see
+// TypeConfig.Channels. Unlimited recipients, e.g. internal QA accounts, or
+// channels are not rate-limited for that type at all.
+type Override struct {
+	Rules     Rules `json:"rules,omitempty"`
+	Unlimited bool  `json:"unlimited,omitempty"`
+}
+
+// Valid checks an Override either is Unlimited or has valid Rules.
+func (o Override) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	if o.Unlimited {
+		eval.CheckField(len(o.Rules) == 0, "rules", "an unlimited override cannot have rules")
+		return eval
+	}
+
+	for field, msg := range jsonvalidator.PrefixEvaluator(o.Rules.Valid(ctx), "rules") {
+		eval.AddFieldError(field, msg)
+	}
+	return eval
+}
+
+// OverrideStore defines where per-recipient overrides are kept.
+type OverrideStore interface {
+	// GetOverride returns the override of userID for a notification type and
+	// whether there is one.
+	GetOverride(ctx context.Context, userID string, t model.NotificationType) (Override, bool, error)
+	// ListOverrides returns every override of userID by notification type.
+	ListOverrides(ctx context.Context, userID string) (map[model.NotificationType]Override, error)
+	SetOverride(ctx context.Context, userID string, t model.NotificationType, o Override) error
+	DeleteOverride(ctx context.Context, userID string, t model.NotificationType) error
+}
+
+// UserProvider defines a Provider able to resolve the config of a notification
+// type for a single recipient.
+type UserProvider interface {
+	Provider
+	// GetUserConfig returns the config of a notification type for userID. It
+	// reports false when the type is unknown, like GetConfig.
+	GetUserConfig(ctx context.Context, t model.NotificationType, userID string) (TypeConfig, bool, error)
+}
+
+// OverrideProvider defines a UserProvider giving the overrides kept in an
+// OverrideStore precedence over the rules of the Provider it wraps.
+type OverrideProvider struct {
+	Provider
+	store OverrideStore
+}
+
+// NewOverrideProvider creates an OverrideProvider and returns it.
+func NewOverrideProvider(p Provider, store OverrideStore) *OverrideProvider {
+	return &OverrideProvider{p, store}
+}
+
+// GetUserConfig gets the config of a notification type, replacing its rules
+// with the recipient override if there is one, on every channel. The type
+// group is kept, so the override still counts against the group quota. An
+// unlimited override resolves to no rules at all.
+func (p *OverrideProvider) GetUserConfig(ctx context.Context, t model.NotificationType, userID string) (TypeConfig, bool, error) {
+	cfg, ok := p.GetConfig(t)
+	if !ok {
+		return cfg, false, nil
+	}
+
+	override, found, err := p.store.GetOverride(ctx, userID, t)
+	if err != nil {
+		return cfg, true, fmt.Errorf("failed to get override: %w", err)
+	}
+	if found {
+		cfg.Rules = override.Rules
+		cfg.Channels = nil
+		if override.Unlimited {
+			cfg.Rules = nil
+		}
+	}
+	return cfg, true, nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+type stubOverrideStore struct {
+	overrides map[string]Override
+	err       error
+}
+
+func (s *stubOverrideStore) GetOverride(_ context.Context, userID string, t model.NotificationType) (Override, bool, error) {
+	o, ok := s.overrides[userID+":"+string(t)]
+	return o, ok, s.err
+}
+
+func (s *stubOverrideStore) ListOverrides(context.Context, string) (map[model.NotificationType]Override, error) {
+	return nil, nil
+}
+
+func (s *stubOverrideStore) SetOverride(context.Context, string, model.NotificationType, Override) error {
+	return nil
+}
+
+func (s *stubOverrideStore) DeleteOverride(context.Context, string, model.NotificationType) error {
+	return nil
+}
+
+func TestOverrideProvider_GetUserConfig(t *testing.T) {
+	ctx := context.Background()
+	base := NewRLConfigProvider(Limits{
+		Groups: map[string]Rules{"promotional": {{Limit: 3, WindowSize: 3600}}},
+		Types: map[model.NotificationType]TypeConfig{
+			model.NotificationTypeStatus:    {Rules: Rules{{Limit: 2, WindowSize: 60}}},
+			model.NotificationTypeMarketing: {Group: "promotional"},
+		},
+	})
+	store := &stubOverrideStore{overrides: map[string]Override{
+		"vip:" + string(model.NotificationTypeStatus):    {Rules: Rules{{Limit: 10, WindowSize: 60}}},
+		"vip:" + string(model.NotificationTypeMarketing): {Rules: Rules{{Limit: 5, WindowSize: 3600}}},
+		"qa:" + string(model.NotificationTypeStatus):     {Unlimited: true},
+	}}
+	provider := NewOverrideProvider(base, store)
+
+	tests := []struct {
+		name        string
+		userID      string
+		t           model.NotificationType
+		expectOK    bool
+		expectGroup string
+		expectRules int
+		expectLimit int
+	}{
+		{"no override", "someone", model.NotificationTypeStatus, true, "", 1, 2},
+		{"override replaces rules", "vip", model.NotificationTypeStatus, true, "", 1, 10},
+		{"override keeps the group", "vip", model.NotificationTypeMarketing, true, "promotional", 1, 5},
+		{"unlimited override", "qa", model.NotificationTypeStatus, true, "", 0, 0},
+		{"unknown type", "vip", model.NotificationTypeNews, false, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, ok, err := provider.GetUserConfig(ctx, tt.t, tt.userID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.expectOK {
+				t.Fatalf("expected ok = %v, got %v", tt.expectOK, ok)
+			}
+			if cfg.Group != tt.expectGroup {
+				t.Errorf("expected group %q, got %q", tt.expectGroup, cfg.Group)
+			}
+			if len(cfg.Rules) != tt.expectRules {
+				t.Fatalf("expected %d rules, got %+v", tt.expectRules, cfg.Rules)
+			}
+			if tt.expectRules > 0 && cfg.Rules[0].Limit != tt.expectLimit {
+				t.Errorf("expected limit %d, got %d", tt.expectLimit, cfg.Rules[0].Limit)
+			}
+		})
+	}
+
+	t.Run("store error", func(t *testing.T) {
+		failing := NewOverrideProvider(base, &stubOverrideStore{err: errors.New("connection dropped")})
+		if _, _, err := failing.GetUserConfig(ctx, model.NotificationTypeStatus, "vip"); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
+
+func TestOverride_Valid(t *testing.T) {
+	tests := []struct {
+		name     string
+		override Override
+		valid    bool
+	}{
+		{"rules", Override{Rules: Rules{{Limit: 10, WindowSize: 60}}}, true},
+		{"unlimited", Override{Unlimited: true}, true},
+		{"empty", Override{}, false},
+		{"invalid rule", Override{Rules: Rules{{Limit: 10}}}, false},
+		{"unlimited with rules", Override{Unlimited: true, Rules: Rules{{Limit: 10, WindowSize: 60}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.override.Valid(context.Background())
+			if (len(problems) == 0) != tt.valid {
+				t.Errorf("expected valid = %v, got problems %v", tt.valid, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/validator"
+)
+
+// clockLayout is the layout of the time of day quiet hours start and end at.
+const clockLayout = "15:04"
+
+// QuietHours defines a daily time-of-day window during which a notification
+// type must not be sent at all, e.g. {Start: "22:00", End: "08:00"}. A window
+// ending before it starts spans midnight.
+//
+// It follows the recipient's time zone when known, else TimeZone, else UTC.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// Valid checks Start and End are distinct times of day, as "15:04", and that
+// TimeZone, when set, is an IANA time zone.
+func (q QuietHours) Valid(_ context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	// Field: Start
+	_, err := time.Parse(clockLayout, q.Start)
+	eval.CheckField(err == nil, "start", "must be a time of day, e.g. 22:00")
+
+	// Field: End
+	_, err = time.Parse(clockLayout, q.End)
+	eval.CheckField(err == nil, "end", "must be a time of day, e.g. 08:00")
+	eval.CheckField(q.End != q.Start, "end", "must not be the same as start")
+
+	// Field: TimeZone
+	_, err = time.LoadLocation(q.TimeZone)
+	eval.CheckField(err == nil, "time_zone", "must be an IANA time zone, e.g. Europe/Lisbon")
+
+	return eval
+}
+
+// Location returns the time zone the quiet hours follow: the recipient's one
+// when known, else TimeZone, else UTC.
+func (q QuietHours) Location(recipient string) *time.Location {
+	return location(recipient, q.TimeZone)
+}
+
+// Until reports whether now falls within the quiet hours, in loc, and how long
+// is left until they end.
+func (q QuietHours) Until(now time.Time, loc *time.Location) (time.Duration, bool) {
+	start, err := time.Parse(clockLayout, q.Start)
+	if err != nil {
+		return 0, false
+	}
+	end, err := time.Parse(clockLayout, q.End)
+	if err != nil {
+		return 0, false
+	}
+
+	now = now.In(loc)
+	year, month, day := now.Date()
+	startToday := time.Date(year, month, day, start.Hour(), start.Minute(), 0, 0, loc)
+	endToday := time.Date(year, month, day, end.Hour(), end.Minute(), 0, 0, loc)
+
+	switch {
+	case !startToday.After(endToday):
+		// Within a single day, e.g. 12:00 to 14:00.
+		if now.Before(startToday) || !now.Before(endToday) {
+			return 0, false
+		}
+		return endToday.Sub(now), true
+	case !now.Before(startToday):
+		// Spanning midnight, started today.
+		return time.Date(year, month, day+1, end.Hour(), end.Minute(), 0, 0, loc).Sub(now), true
+	case now.Before(endToday):
+		// Spanning midnight, started yesterday.
+		return endToday.Sub(now), true
+	}
+	return 0, false
+}
+
+// location loads the time zone of a recipient, falling back to configured and
+// then to UTC.
+func location(recipient, configured string) *time.Location {
+	name := configured
+	if recipient != "" {
+		name = recipient
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuietHours_Until(t *testing.T) {
+	overnight := QuietHours{Start: "22:00", End: "08:00"}
+	lunch := QuietHours{Start: "12:00", End: "14:00"}
+	day := func(hour, minute int) time.Time { return time.Date(2025, 1, 10, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name        string
+		quietHours  QuietHours
+		now         time.Time
+		expectQuiet bool
+		expectUntil time.Duration
+	}{
+		{name: "before overnight", quietHours: overnight, now: day(21, 59)},
+		{name: "overnight start", quietHours: overnight, now: day(22, 0), expectQuiet: true, expectUntil: 10 * time.Hour},
+		{name: "overnight after midnight", quietHours: overnight, now: day(7, 30), expectQuiet: true, expectUntil: 30 * time.Minute},
+		{name: "overnight end", quietHours: overnight, now: day(8, 0)},
+		{name: "before lunch", quietHours: lunch, now: day(11, 59)},
+		{name: "lunch", quietHours: lunch, now: day(13, 0), expectQuiet: true, expectUntil: time.Hour},
+		{name: "after lunch", quietHours: lunch, now: day(14, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.quietHours.Until(tt.now, time.UTC)
+			if quiet != tt.expectQuiet || until != tt.expectUntil {
+				t.Errorf("expected (%v, %v), got (%v, %v)", tt.expectUntil, tt.expectQuiet, until, quiet)
+			}
+		})
+	}
+}
+
+func TestQuietHours_UntilAcrossDST(t *testing.T) {
+	lisbon, err := time.LoadLocation("Europe/Lisbon")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Lisbon moves to summer time at 01:00 UTC on 2025-03-30, the night is an
+	// hour shorter.
+	now := time.Date(2025, 3, 29, 22, 0, 0, 0, lisbon)
+	until, quiet := QuietHours{Start: "22:00", End: "08:00"}.Until(now, lisbon)
+	if !quiet || until != 9*time.Hour {
+		t.Errorf("expected 9h of quiet hours left, got (%v, %v)", until, quiet)
+	}
+}
+
+func TestQuietHours_Valid(t *testing.T) {
+	tests := []struct {
+		name        string
+		quietHours  QuietHours
+		expectValid bool
+	}{
+		{name: "valid", quietHours: QuietHours{Start: "22:00", End: "08:00", TimeZone: "Europe/Lisbon"}, expectValid: true},
+		{name: "no time zone", quietHours: QuietHours{Start: "22:00", End: "08:00"}, expectValid: true},
+		{name: "missing start", quietHours: QuietHours{End: "08:00"}},
+		{name: "not a time of day", quietHours: QuietHours{Start: "10pm", End: "08:00"}},
+		{name: "empty window", quietHours: QuietHours{Start: "08:00", End: "08:00"}},
+		{name: "unknown time zone", quietHours: QuietHours{Start: "22:00", End: "08:00", TimeZone: "Mars/Olympus"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.quietHours.Valid(context.Background())
+			if valid := len(problems) == 0; valid != tt.expectValid {
+				t.Errorf("expected valid %v, got problems %v", tt.expectValid, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// configKey is the hash holding the current config: its "version", the
+	// "global" rules, and one "group:<name>" and "type:<name>" field per
+	// group and notification type, each JSON encoded.
+	configKey = "rate_limit:config"
+	// historyKey is the hash holding a JSON encoded config.Limits snapshot
+	// per version, for rollbacks.
+	historyKey = "rate_limit:config:history"
+	// channel is where the version of every published config is announced.
+	channel = "rate_limit:config:updates"
+
+	// historySize is how many versions are kept in historyKey.
+	historySize = 20
+)
+
+// publishLua replaces the current config, bumps its version, records it in
+// the history, dropping versions older than the history size, and announces
+// it to every replica. Nothing is published when the current config is not
+// at the version the new one was based on anymore.
+//
+// KEYS[1] - config hash
+// KEYS[2] - history hash
+// ARGV[1] - history size
+// ARGV[2] - pub/sub channel
+// ARGV[3] - version the config was based on, any when negative
+// ARGV[4] - config.Limits snapshot
+// ARGV[5..] - config hash field/value pairs
+//
+// Returns the new version, or a CONFLICT error.
+const publishLua = `
+local current = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+local base = tonumber(ARGV[3])
+if base >= 0 and base ~= current then
+	return redis.error_reply('CONFLICT rate-limit config is at version ' .. current)
+end
+local version = current + 1
+
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'version', version)
+for i = 5, #ARGV, 2 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+
+redis.call('HSET', KEYS[2], version, ARGV[4])
+redis.call('HDEL', KEYS[2], version - tonumber(ARGV[1]))
+
+redis.call('PUBLISH', ARGV[2], version)
+return version
+`
+
+var publishScript = redis.NewScript(publishLua)
+
+var (
+	ErrInvalidConfig   = errors.New("invalid rate-limit config")
+	errNoConfigInRedis = errors.New("no rate-limit config in redis")
+)
+
+// Provider defines a config.Provider whose Limits live in redis, so every
+// replica shares them. They are cached in memory and refreshed by Watch
+// whenever a new version is published.
+type Provider struct {
+	*config.RLConfigProvider
+	client *redis.Client
+
+	mu sync.Mutex // serializes the cache updates of Load
+}
+
+// New creates a redis-based config provider loaded with the current config in
+// redis, or with fallback, usually the embedded limits.json, when nothing was
+// published yet. Watch must be called to pick up later versions.
+func New(ctx context.Context, client *redis.Client, fallback config.Limits) (*Provider, error) {
+	p := &Provider{
+		RLConfigProvider: config.NewRLConfigProvider(fallback),
+		client:           client,
+	}
+	if err := p.Load(ctx); err != nil && !errors.Is(err, errNoConfigInRedis) {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Version returns the version of the cached config, 0 when it is the fallback.
+func (p *Provider) Version() int64 {
+	_, version := p.Limits()
+	return version
+}
+
+// Load reads the current config from redis and caches it when it is newer
+// than the cached one. Invalid configs are rejected, keeping the cached one.
+func (p *Provider) Load(ctx context.Context) error {
+	fields, err := p.client.HGetAll(ctx, configKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get rate-limit config: %w", err)
+	}
+	if len(fields) == 0 {
+		return errNoConfigInRedis
+	}
+
+	version, limits, err := decodeConfig(fields)
+	if err != nil {
+		return err
+	}
+	if problems := limits.Valid(ctx); len(problems) > 0 {
+		slog.Error("rejected invalid rate-limit config from redis", "version", version, "problems", problems)
+		return fmt.Errorf("%w: version %d has %d problems", ErrInvalidConfig, version, len(problems))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if version <= p.Version() {
+		return nil
+	}
+	p.StoreVersion(limits, version)
+	return nil
+}
+
+// Publish validates limits and makes them the current config of every
+// replica, returning their version. Invalid limits are rejected with a
+// *config.InvalidLimitsError.
+//
+// version is the one of the config limits were based on: when another one was
+// published since, e.g. by another replica, nothing is published and
+// config.ErrVersionConflict is returned, once the newer config is loaded. A
+// negative version publishes limits whatever the current one is.
+func (p *Provider) Publish(ctx context.Context, version int64, limits config.Limits) (int64, error) {
+	if problems := limits.Valid(ctx); len(problems) > 0 {
+		return 0, &config.InvalidLimitsError{Problems: problems}
+	}
+
+	snapshot, err := json.Marshal(limits)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode rate-limit config: %w", err)
+	}
+	fields, err := encodeConfig(limits)
+	if err != nil {
+		return 0, err
+	}
+
+	args := append([]any{historySize, channel, version, snapshot}, fields...)
+	version, err = publishScript.Run(ctx, p.client, []string{configKey, historyKey}, args...).Int64()
+	if redis.HasErrorPrefix(err, "CONFLICT") {
+		if err := p.Load(ctx); err != nil {
+			slog.Error("failed to load concurrently published rate-limit config", "err", err)
+		}
+		return 0, config.ErrVersionConflict
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish rate-limit config: %w", err)
+	}
+
+	// Don't wait for the pub/sub round trip to serve the new config here.
+	if err := p.Load(ctx); err != nil {
+		slog.Error("failed to load published rate-limit config", "version", version, "err", err)
+	}
+	return version, nil
+}
+
+// Update publishes limits based on version, see Publish.
+func (p *Provider) Update(ctx context.Context, version int64, limits config.Limits) error {
+	_, err := p.Publish(ctx, version, limits)
+	return err
+}
+
+// History returns the versions still kept for rollbacks, the last
+// historySize, newest first.
+func (p *Provider) History(ctx context.Context) ([]config.Version, error) {
+	snapshots, err := p.client.HGetAll(ctx, historyKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rate-limit config history: %w", err)
+	}
+
+	history := make([]config.Version, 0, len(snapshots))
+	for field, snapshot := range snapshots {
+		version, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate-limit config version %q: %w", field, err)
+		}
+		var limits config.Limits
+		if err := json.Unmarshal([]byte(snapshot), &limits); err != nil {
+			return nil, fmt.Errorf("failed to decode rate-limit config version %d: %w", version, err)
+		}
+		history = append(history, config.Version{Version: version, Limits: limits})
+	}
+
+	slices.SortFunc(history, func(a, b config.Version) int { return int(b.Version - a.Version) })
+	return history, nil
+}
+
+// Rollback publishes again the config of a previous version, whatever the
+// current one is, returning the new version it gets.
+func (p *Provider) Rollback(ctx context.Context, version int64) (int64, error) {
+	snapshot, err := p.client.HGet(ctx, historyKey, strconv.FormatInt(version, 10)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("%w: %d", config.ErrUnknownVersion, version)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rate-limit config version %d: %w", version, err)
+	}
+
+	var limits config.Limits
+	if err := json.Unmarshal(snapshot, &limits); err != nil {
+		return 0, fmt.Errorf("failed to decode rate-limit config version %d: %w", version, err)
+	}
+	return p.Publish(ctx, -1, limits)
+}
+
+// Watch reloads the config whenever a new version is announced, until ctx is
+// done. It also reloads once subscribed, catching up with versions published
+// before.
+func (p *Provider) Watch(ctx context.Context) {
+	pubsub := p.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		slog.Error("failed to subscribe to rate-limit config updates", "err", err)
+	}
+	p.reload(ctx)
+
+	updates := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-updates:
+			if !ok {
+				return
+			}
+			if version, err := strconv.ParseInt(msg.Payload, 10, 64); err == nil && version <= p.Version() {
+				continue
+			}
+			p.reload(ctx)
+		}
+	}
+}
+
+func (p *Provider) reload(ctx context.Context) {
+	err := p.Load(ctx)
+	if err != nil && !errors.Is(err, errNoConfigInRedis) {
+		slog.Error("failed to reload rate-limit config, keeping the current one", "version", p.Version(), "err", err)
+		return
+	}
+	slog.Info("rate-limit config up to date", "version", p.Version())
+}
+
+// encodeConfig flattens limits into the field/value pairs of the config hash,
+// sorted by field.
+func encodeConfig(limits config.Limits) ([]any, error) {
+	values := map[string]any{}
+	if len(limits.Global) > 0 {
+		values["global"] = limits.Global
+	}
+	for name, rules := range limits.Groups {
+		values["group:"+name] = rules
+	}
+	for t, cfg := range limits.Types {
+		values["type:"+string(t)] = cfg
+	}
+
+	fields := make([]any, 0, 2*len(values))
+	for _, field := range slices.Sorted(maps.Keys(values)) {
+		data, err := json.Marshal(values[field])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode rate-limit config %s: %w", field, err)
+		}
+		fields = append(fields, field, string(data))
+	}
+	return fields, nil
+}
+
+// decodeConfig rebuilds the version and config.Limits kept in the config hash.
+func decodeConfig(fields map[string]string) (int64, config.Limits, error) {
+	version, err := strconv.ParseInt(fields["version"], 10, 64)
+	if err != nil {
+		return 0, config.Limits{}, fmt.Errorf("invalid rate-limit config version %q: %w", fields["version"], err)
+	}
+
+	limits := config.Limits{
+		Groups: map[string]config.Rules{},
+		Types:  map[model.NotificationType]config.TypeConfig{},
+	}
+	for field, value := range fields {
+		var err error
+		switch kind, name, _ := strings.Cut(field, ":"); kind {
+		case "version":
+			continue
+		case "global":
+			err = json.Unmarshal([]byte(value), &limits.Global)
+		case "group":
+			var rules config.Rules
+			err = json.Unmarshal([]byte(value), &rules)
+			limits.Groups[name] = rules
+		case "type":
+			var cfg config.TypeConfig
+			err = json.Unmarshal([]byte(value), &cfg)
+			limits.Types[model.NotificationType(name)] = cfg
+		default:
+			slog.Warn("ignoring unknown rate-limit config field", "field", field)
+		}
+		if err != nil {
+			return 0, config.Limits{}, fmt.Errorf("failed to decode rate-limit config %s: %w", field, err)
+		}
+	}
+	return version, limits, nil
+}
@@ -0,0 +1,168 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/redis/go-redis/v9"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func setupRedisContainer(t *testing.T) *redis.Client {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "redis:7-alpine",
+		ExposedPorts: []string{"6379/tcp"},
+		WaitingFor:   wait.ForLog("Ready to accept connections"),
+	}
+
+	redisContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start Redis container: %v", err)
+	}
+
+	host, err := redisContainer.Host(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get container host: %v", err)
+	}
+
+	port, err := redisContainer.MappedPort(ctx, "6379")
+	if err != nil {
+		t.Fatalf("Failed to get container port: %v", err)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("%s:%s", host, port.Port()),
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("Failed to connect to Redis: %v", err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		redisContainer.Terminate(ctx)
+	})
+
+	return client
+}
+
+func waitForNewsLimit(t *testing.T, p *Provider, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for newsLimit(p) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected news limit %d, got %d", expected, newsLimit(p))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIntegrationProvider_SharesVersionsBetweenReplicas(t *testing.T) {
+	client := setupRedisContainer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Nothing published yet: both replicas serve the fallback.
+	first, err := New(ctx, client, newsLimits(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := New(ctx, client, newsLimits(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Version() != 0 || newsLimit(first) != 1 {
+		t.Fatalf("expected the fallback config, got version %d and limit %d", first.Version(), newsLimit(first))
+	}
+	go first.Watch(ctx)
+	go second.Watch(ctx)
+
+	v1, err := first.Publish(ctx, first.Version(), newsLimits(5))
+	if err != nil {
+		t.Fatalf("unexpected publish error: %v", err)
+	}
+	if v1 != 1 || newsLimit(first) != 5 {
+		t.Errorf("expected version 1 to be served right away, got version %d and limit %d", v1, newsLimit(first))
+	}
+	waitForNewsLimit(t, second, 5)
+
+	v2, err := second.Publish(ctx, second.Version(), newsLimits(10))
+	if err != nil || v2 != 2 {
+		t.Fatalf("expected version 2, got %d (err: %v)", v2, err)
+	}
+	waitForNewsLimit(t, first, 10)
+
+	if _, err := first.Publish(ctx, 1, newsLimits(20)); !errors.Is(err, config.ErrVersionConflict) {
+		t.Errorf("expected a config based on an outdated version to conflict, got %v", err)
+	}
+	if _, err := first.Publish(ctx, first.Version(), newsLimits(0)); err == nil {
+		t.Error("expected an invalid config to be rejected")
+	}
+
+	history, err := first.History(ctx)
+	if err != nil {
+		t.Fatalf("unexpected history error: %v", err)
+	}
+	if len(history) != 2 || history[0].Version != 2 || history[1].Version != 1 {
+		t.Fatalf("expected versions [2 1], got %+v", history)
+	}
+
+	v3, err := first.Rollback(ctx, 1)
+	if err != nil || v3 != 3 {
+		t.Fatalf("expected the rollback to publish version 3, got %d (err: %v)", v3, err)
+	}
+	waitForNewsLimit(t, second, 5)
+
+	// A replica started later picks up the published config.
+	third, err := New(ctx, client, newsLimits(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if third.Version() != 3 || newsLimit(third) != 5 {
+		t.Errorf("expected version 3, got version %d and limit %d", third.Version(), newsLimit(third))
+	}
+}
+
+func TestIntegrationProvider_KeepsBoundedHistory(t *testing.T) {
+	client := setupRedisContainer(t)
+	ctx := context.Background()
+
+	p, err := New(ctx, client, newsLimits(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range historySize + 5 {
+		if _, err := p.Publish(ctx, p.Version(), newsLimits(i+1)); err != nil {
+			t.Fatalf("unexpected publish error: %v", err)
+		}
+	}
+
+	history, err := p.History(ctx)
+	if err != nil {
+		t.Fatalf("unexpected history error: %v", err)
+	}
+	if len(history) != historySize || history[0].Version != historySize+5 {
+		t.Errorf("expected the last %d versions, got %d starting at %d", historySize, len(history), history[0].Version)
+	}
+	if _, err := p.Rollback(ctx, 1); err == nil {
+		t.Error("expected rolling back to a dropped version to fail")
+	}
+
+	cfg, _ := p.GetConfig(model.NotificationTypeNews)
+	if cfg.Rules[0].Limit != historySize+5 {
+		t.Errorf("expected the last published limit, got %+v", cfg)
+	}
+}
@@ -0,0 +1,246 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/go-redis/redismock/v9"
+)
+
+func newsLimits(limit int) config.Limits {
+	return config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: limit, WindowSize: 86400}}},
+		},
+	}
+}
+
+func newsLimit(p *Provider) int {
+	cfg, ok := p.GetConfig(model.NotificationTypeNews)
+	if !ok {
+		return 0
+	}
+	return cfg.Rules[0].Limit
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		fields        map[string]string
+		redisErr      error
+		expectErr     bool
+		expectVersion int64
+		expectLimit   int
+	}{
+		{
+			name: "Published config",
+			fields: map[string]string{
+				"version":                     "3",
+				"global":                      `[{"limit":10,"window_size":3600}]`,
+				"group:promotional":           `[{"limit":3,"window_size":3600}]`,
+				"type:news-notification":      `{"rules":[{"limit":5,"window_size":86400}]}`,
+				"type:marketing-notification": `{"group":"promotional"}`,
+			},
+			expectVersion: 3,
+			expectLimit:   5,
+		},
+		{
+			name:          "Nothing published - keeps the fallback",
+			fields:        map[string]string{},
+			expectErr:     true,
+			expectVersion: 0,
+			expectLimit:   1,
+		},
+		{
+			name: "Invalid config - keeps the fallback",
+			fields: map[string]string{
+				"version":                "3",
+				"type:news-notification": `{"rules":[{"limit":0,"window_size":86400}]}`,
+			},
+			expectErr:     true,
+			expectVersion: 0,
+			expectLimit:   1,
+		},
+		{
+			name: "Corrupted config - keeps the fallback",
+			fields: map[string]string{
+				"version":                "3",
+				"type:news-notification": `{"rules":`,
+			},
+			expectErr:     true,
+			expectVersion: 0,
+			expectLimit:   1,
+		},
+		{
+			name:          "Redis returns unexpected error",
+			redisErr:      errors.New("connection dropped"),
+			expectErr:     true,
+			expectVersion: 0,
+			expectLimit:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			p := &Provider{RLConfigProvider: config.NewRLConfigProvider(newsLimits(1)), client: client}
+
+			if tt.redisErr != nil {
+				mock.ExpectHGetAll(configKey).SetErr(tt.redisErr)
+			} else {
+				mock.ExpectHGetAll(configKey).SetVal(tt.fields)
+			}
+
+			err := p.Load(ctx)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error = %v, got %v", tt.expectErr, err)
+			}
+			if p.Version() != tt.expectVersion {
+				t.Errorf("expected version %d, got %d", tt.expectVersion, p.Version())
+			}
+			if got := newsLimit(p); got != tt.expectLimit {
+				t.Errorf("expected news limit %d, got %d", tt.expectLimit, got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestLoad_IgnoresOlderVersions(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	p := &Provider{RLConfigProvider: config.NewRLConfigProvider(newsLimits(1)), client: client}
+	p.StoreVersion(newsLimits(1), 5)
+
+	mock.ExpectHGetAll(configKey).SetVal(map[string]string{
+		"version":                "4",
+		"type:news-notification": `{"rules":[{"limit":5,"window_size":86400}]}`,
+	})
+
+	if err := p.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Version() != 5 || newsLimit(p) != 1 {
+		t.Errorf("expected the cached version 5 to be kept, got version %d and limit %d", p.Version(), newsLimit(p))
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	client, mock := redismock.NewClientMock()
+	p := &Provider{RLConfigProvider: config.NewRLConfigProvider(newsLimits(1)), client: client}
+
+	limits := newsLimits(5)
+	limits.Global = config.Rules{{Limit: 10, WindowSize: 3600}}
+	snapshot, _ := json.Marshal(limits)
+
+	mock.ExpectEvalSha(publishScript.Hash(), []string{configKey, historyKey},
+		historySize, channel, int64(0), snapshot,
+		"global", `[{"limit":10,"window_size":3600}]`,
+		"type:news-notification", `{"rules":[{"limit":5,"window_size":86400}]}`,
+	).SetVal(int64(1))
+	mock.ExpectHGetAll(configKey).SetVal(map[string]string{
+		"version":                "1",
+		"global":                 `[{"limit":10,"window_size":3600}]`,
+		"type:news-notification": `{"rules":[{"limit":5,"window_size":86400}]}`,
+	})
+
+	version, err := p.Publish(ctx, 0, limits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 1 || p.Version() != 1 || newsLimit(p) != 5 {
+		t.Errorf("expected version 1 to be served, got version %d/%d and limit %d", version, p.Version(), newsLimit(p))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	var invalid *config.InvalidLimitsError
+	if _, err := p.Publish(ctx, 1, newsLimits(0)); !errors.As(err, &invalid) {
+		t.Errorf("expected InvalidLimitsError, got %v", err)
+	}
+}
+
+// conflictError is the error Redis replies when publishLua finds a newer
+// config.
+type conflictError struct{}
+
+func (conflictError) Error() string { return "CONFLICT rate-limit config is at version 2" }
+
+func (conflictError) RedisError() {}
+
+func TestPublish_VersionConflict(t *testing.T) {
+	ctx := context.Background()
+	client, mock := redismock.NewClientMock()
+	p := &Provider{RLConfigProvider: config.NewRLConfigProvider(newsLimits(1)), client: client}
+	p.StoreVersion(newsLimits(1), 1)
+
+	limits := newsLimits(5)
+	snapshot, _ := json.Marshal(limits)
+	mock.ExpectEvalSha(publishScript.Hash(), []string{configKey, historyKey},
+		historySize, channel, int64(1), snapshot,
+		"type:news-notification", `{"rules":[{"limit":5,"window_size":86400}]}`,
+	).SetErr(conflictError{})
+	// The newer config is loaded, so a retry is based on it.
+	mock.ExpectHGetAll(configKey).SetVal(map[string]string{
+		"version":                "2",
+		"type:news-notification": `{"rules":[{"limit":3,"window_size":86400}]}`,
+	})
+
+	if _, err := p.Publish(ctx, 1, limits); !errors.Is(err, config.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	if p.Version() != 2 || newsLimit(p) != 3 {
+		t.Errorf("expected version 2 to be served, got version %d and limit %d", p.Version(), newsLimit(p))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	p := &Provider{RLConfigProvider: config.NewRLConfigProvider(newsLimits(1)), client: client}
+
+	snapshot := func(limit int) string {
+		data, _ := json.Marshal(newsLimits(limit))
+		return string(data)
+	}
+	mock.ExpectHGetAll(historyKey).SetVal(map[string]string{
+		"9":  snapshot(9),
+		"10": snapshot(10),
+		"8":  snapshot(8),
+	})
+
+	history, err := p.History(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, expected := range []int64{10, 9, 8} {
+		if history[i].Version != expected {
+			t.Fatalf("expected versions [10 9 8], got %+v", history)
+		}
+		if limit := history[i].Limits.Types[model.NotificationTypeNews].Rules[0].Limit; limit != int(expected) {
+			t.Errorf("expected version %d to have limit %d, got %d", expected, expected, limit)
+		}
+	}
+}
+
+func TestRollback_UnknownVersion(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	p := &Provider{RLConfigProvider: config.NewRLConfigProvider(newsLimits(1)), client: client}
+
+	mock.ExpectHGet(historyKey, "7").RedisNil()
+
+	if _, err := p.Rollback(context.Background(), 7); !errors.Is(err, config.ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+}
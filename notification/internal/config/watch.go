@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Reload loads the limits file at path and, only when it is valid, swaps it
+// into the provider. On error the current Limits are kept.
+func (rlc *RLConfigProvider) Reload(path string) error {
+	limits, err := LoadFromFile(path)
+	if err != nil {
+		return err
+	}
+	rlc.Store(limits)
+	return nil
+}
+
+// WatchFile reloads the limits file at path whenever its modification time or
+// size changes, checked every interval, and whenever reload receives a value,
+// e.g. a SIGHUP. It blocks until ctx is done. Files that fail to load are
+// logged and the current Limits kept.
+func (rlc *RLConfigProvider) WatchFile(ctx context.Context, path string, interval time.Duration, reload <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := os.Stat(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-reload:
+			slog.Info("reloading rate-limit config", "filepath", path, "signal", sig)
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				slog.Error("failed to stat rate-limit config", "filepath", path, "err", err)
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			slog.Info("rate-limit config changed, reloading", "filepath", path)
+		}
+
+		if err := rlc.Reload(path); err != nil {
+			slog.Error("failed to reload rate-limit config, keeping the current one", "filepath", path, "err", err)
+			continue
+		}
+		slog.Info("reloaded rate-limit config", "filepath", path)
+	}
+}
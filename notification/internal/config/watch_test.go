@@ -0,0 +1,132 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+func writeLimits(t *testing.T, path string, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatalf("failed to write limits file: %v", err)
+	}
+}
+
+func newsLimit(rlc *RLConfigProvider) int {
+	cfg, ok := rlc.GetConfig(model.NotificationTypeNews)
+	if !ok {
+		return 0
+	}
+	return cfg.Rules[0].Limit
+}
+
+func waitForNewsLimit(t *testing.T, rlc *RLConfigProvider, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for newsLimit(rlc) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected news limit %d, got %d", expected, newsLimit(rlc))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReload_KeepsCurrentLimitsOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	writeLimits(t, path, `{"types": {"news-notification": {"limit": 1, "window_size": 86400}}}`)
+
+	limits, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rlc := NewRLConfigProvider(limits)
+
+	writeLimits(t, path, `{"types": {"news-notification": {"limit": 2, "window_size": 86400}}}`)
+	if err := rlc.Reload(path); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if got := newsLimit(rlc); got != 2 {
+		t.Errorf("expected the reloaded limit 2, got %d", got)
+	}
+
+	for _, body := range []string{
+		`{"types": {"news-notification": {"limit": 0, "window_size": 86400}}}`,
+		`{"types": `,
+	} {
+		writeLimits(t, path, body)
+		if err := rlc.Reload(path); err == nil {
+			t.Errorf("expected an error reloading %s", body)
+		}
+		if got := newsLimit(rlc); got != 2 {
+			t.Errorf("expected the current limit 2 to be kept, got %d", got)
+		}
+	}
+
+	if err := rlc.Reload(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error reloading a missing file")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	writeLimits(t, path, `{"types": {"news-notification": {"limit": 1, "window_size": 86400}}}`)
+
+	limits, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rlc := NewRLConfigProvider(limits)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		rlc.WatchFile(ctx, path, 10*time.Millisecond, reload)
+		close(done)
+	}()
+
+	// Let the watcher take its first look at the file.
+	time.Sleep(50 * time.Millisecond)
+
+	// A changed file is picked up.
+	writeLimits(t, path, `{"types": {"news-notification": {"limit": 2, "window_size": 86400}}}`)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	waitForNewsLimit(t, rlc, 2)
+
+	// An invalid file is ignored.
+	writeLimits(t, path, `{"types": {"news-notification": {"limit": 0, "window_size": 86400}}}`)
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if got := newsLimit(rlc); got != 2 {
+		t.Fatalf("expected the current limit 2 to be kept, got %d", got)
+	}
+
+	// A change the poller cannot see is picked up on SIGHUP.
+	// The new file is swapped in atomically, so the poller never sees it
+	// with another modification time.
+	info, _ := os.Stat(path)
+	writeLimits(t, path+".tmp", `{"types": {"news-notification": {"limit": 3, "window_size": 86400}}}`)
+	os.Chtimes(path+".tmp", info.ModTime(), info.ModTime())
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := newsLimit(rlc); got != 2 {
+		t.Fatalf("expected the poller to miss the change, got limit %d", got)
+	}
+	reload <- syscall.SIGHUP
+	waitForNewsLimit(t, rlc, 3)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected WatchFile to return once ctx is done")
+	}
+}
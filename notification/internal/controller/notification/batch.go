@@ -0,0 +1,265 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+)
+
+// batchRateLimiter is a rateLimiter checking many keys at once, e.g. in a
+// single round trip.
+type batchRateLimiter interface {
+	// IsAllowedBatch is IsAllowed for each of keys, against the rule of the
+	// same index, counting them in order.
+	IsAllowedBatch(ctx context.Context, keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error)
+}
+
+// atomicRateLimiter counts the rules of many sends, of any algorithm, at once.
+type atomicRateLimiter interface {
+	// IsAllowedAll checks the rules of each send, keys[i][j] against
+	// cfgs[i][j], counting the sends in order. A send consumes one request
+	// from all of its rules when every one of them allows it, else from none.
+	IsAllowedAll(ctx context.Context, keys [][]string, cfgs [][]config.RLConfig) ([][]ratelimit.Decision, [][]error)
+}
+
+// batchSend is a send of SendBatch about to be counted against its checks.
+type batchSend struct {
+	index      int
+	n          model.Notification
+	typeConfig config.TypeConfig
+	// dedupKey is the key n was remembered under, if it was.
+	dedupKey string
+	checks   []check
+}
+
+// SendBatch sends each of ns as Send would, returning the Result and the error
+// of each of them, in order.
+//
+// Their rate limits are consumed at once: every check is handed over to the
+// atomicRateLimiter, when there is one, else the checks counted by the same
+// rateLimiter are handed over together to the ones supporting it. The Redis
+// ones check them all in a single round trip.
+//
+// Only the atomicRateLimiter counts the sends against each other in order, as
+// if made one after the other. Without it, every send is counted by a
+// rateLimiter before the next one counts any, and the rules a denied send
+// consumed are only refunded once all of them did, so a send can be denied by
+// one after it, or by one denied itself.
+func (c *Controller) SendBatch(ctx context.Context, ns []model.Notification) ([]Result, []error) {
+	results := make([]Result, len(ns))
+	errs := make([]error, len(ns))
+	now := c.now()
+
+	var sends []batchSend
+	for i, n := range ns {
+		s, result, counted, err := c.resolve(ctx, now, n)
+		if !counted {
+			results[i], errs[i] = result, err
+			c.forget(ctx, s, err)
+			continue
+		}
+		s.index = i
+		sends = append(sends, s)
+	}
+
+	checks := make([][]check, len(sends))
+	for j, s := range sends {
+		checks[j] = s.checks
+	}
+	quotas, consumeErrs := c.consumeBatch(ctx, now, checks)
+	for j, s := range sends {
+		results[s.index], errs[s.index] = c.finish(ctx, now, s.n, s.typeConfig, s.checks, quotas[j], consumeErrs[j])
+		c.forget(ctx, s, errs[s.index])
+	}
+	return results, errs
+}
+
+// resolve checks what Send checks of n before counting it at now: its channel,
+// its notification type, whether it duplicates a previous one and its quiet
+// hours. It reports whether n is to be counted against its checks, else the
+// Result or the error it ends with.
+func (c *Controller) resolve(ctx context.Context, now time.Time, n model.Notification) (s batchSend, result Result, counted bool, err error) {
+	s.n = n
+	if _, ok := c.gateways[n.Channel]; !ok {
+		return s, Result{}, false, ErrUnsupportedChannel
+	}
+
+	typeConfig, ok, err := c.typeConfig(ctx, n.UserID, n.NotificationType)
+	if err != nil {
+		return s, Result{}, false, err
+	}
+	if !ok {
+		return s, Result{}, false, ErrUnknowNotificationType
+	}
+	s.typeConfig = typeConfig
+
+	if typeConfig.Dedup != nil && c.dedup != nil {
+		key := dedupKey(n)
+		first, err := c.dedup.Remember(ctx, key, typeConfig.Dedup.Window())
+		if err != nil {
+			return s, Result{}, false, fmt.Errorf("failed to check for duplicates: %w", err)
+		}
+		if !first {
+			slog.Info("Duplicate Suppressed", "user-id", n.UserID, "notification-type", n.NotificationType, "channel", n.Channel)
+			return s, Result{Status: StatusDuplicate}, false, nil
+		}
+		s.dedupKey = key
+	}
+
+	if err := quietHours(now, n, typeConfig); err != nil {
+		return s, Result{}, false, err
+	}
+	s.checks = c.sendChecks(now, n, typeConfig)
+	return s, Result{}, true, nil
+}
+
+// forget forgets the notification of s when err tells it was not sent,
+// deferred nor digested, so it can be retried.
+func (c *Controller) forget(ctx context.Context, s batchSend, err error) {
+	if err == nil || s.dedupKey == "" {
+		return
+	}
+	if err := c.dedup.Forget(ctx, s.dedupKey); err != nil {
+		slog.Error("failed to forget notification", "user-id", s.n.UserID, "notification-type", s.n.NotificationType, "err", err)
+	}
+}
+
+// consumeBatch consumes the checks of many sends at once, each of them as
+// described by consume, returning the quotas and the error of each send.
+//
+// The checks are handed over to their rateLimiter in order, all together when
+// it is a batchRateLimiter. The checks of a send a rateLimiter failed are not
+// handed over anymore.
+func (c *Controller) consumeBatch(ctx context.Context, now time.Time, batches [][]check) ([][]Quota, []error) {
+	if c.atomic != nil {
+		return c.consumeAtomic(ctx, now, batches)
+	}
+
+	quotas := make([][]Quota, len(batches))
+	errs := make([]error, len(batches))
+	decisions := make([][]ratelimit.Decision, len(batches))
+	allowErrs := make([][]error, len(batches))
+
+	// ref points at the i-th check of the b-th send.
+	type ref struct{ b, i int }
+	var limiters []rateLimiter
+	refs := make(map[rateLimiter][]ref)
+	for b, checks := range batches {
+		batchLimiters := make([]rateLimiter, len(checks))
+		for i, chk := range checks {
+			rl, ok := c.limiters[chk.rule.GetAlgorithm()]
+			if !ok {
+				errs[b] = ErrUnsupportedAlgorithm
+				break
+			}
+			batchLimiters[i] = rl
+		}
+		if errs[b] != nil {
+			continue
+		}
+
+		decisions[b] = make([]ratelimit.Decision, len(checks))
+		allowErrs[b] = make([]error, len(checks))
+		for i, rl := range batchLimiters {
+			if _, ok := refs[rl]; !ok {
+				limiters = append(limiters, rl)
+			}
+			refs[rl] = append(refs[rl], ref{b, i})
+		}
+	}
+
+	// Once a rateLimiter fails, the remaining checks of the send are skipped.
+	failed := make([]bool, len(batches))
+	allow := func(r ref, decision ratelimit.Decision, err error) {
+		decisions[r.b][r.i], allowErrs[r.b][r.i] = decision, err
+		var exceeded *ratelimit.LimitExceededError
+		if err != nil && !errors.As(err, &exceeded) {
+			failed[r.b] = true
+		}
+	}
+	for _, rl := range limiters {
+		var rs []ref
+		for _, r := range refs[rl] {
+			if !failed[r.b] {
+				rs = append(rs, r)
+			}
+		}
+
+		batch, ok := rl.(batchRateLimiter)
+		if !ok {
+			for _, r := range rs {
+				if !failed[r.b] {
+					chk := batches[r.b][r.i]
+					decision, err := rl.IsAllowed(ctx, chk.key, chk.rule)
+					allow(r, decision, err)
+				}
+			}
+			continue
+		}
+		if len(rs) == 0 {
+			continue
+		}
+		keys := make([]string, len(rs))
+		cfgs := make([]config.RLConfig, len(rs))
+		for j, r := range rs {
+			keys[j], cfgs[j] = batches[r.b][r.i].key, batches[r.b][r.i].rule
+		}
+		ds, es := batch.IsAllowedBatch(ctx, keys, cfgs)
+		for j, r := range rs {
+			allow(r, ds[j], es[j])
+		}
+	}
+
+	for b, checks := range batches {
+		if errs[b] != nil {
+			continue
+		}
+		quotas[b], errs[b] = c.tally(ctx, now, checks, decisions[b], allowErrs[b], true)
+	}
+	return quotas, errs
+}
+
+// consumeAtomic is consumeBatch for a Controller with an atomicRateLimiter,
+// which checks the checks of every send at once. Nothing has to be refunded:
+// a send any check denies consumed none of them.
+func (c *Controller) consumeAtomic(ctx context.Context, now time.Time, batches [][]check) ([][]Quota, []error) {
+	quotas := make([][]Quota, len(batches))
+	errs := make([]error, len(batches))
+
+	var (
+		counted []int
+		keys    [][]string
+		cfgs    [][]config.RLConfig
+	)
+	for b, checks := range batches {
+		ks := make([]string, len(checks))
+		rules := make([]config.RLConfig, len(checks))
+		for i, chk := range checks {
+			// The rateLimiter of the algorithm still refunds and peeks what
+			// the send consumed.
+			if _, ok := c.limiters[chk.rule.GetAlgorithm()]; !ok {
+				errs[b] = ErrUnsupportedAlgorithm
+				break
+			}
+			ks[i], rules[i] = chk.key, chk.rule
+		}
+		if errs[b] != nil {
+			continue
+		}
+		counted = append(counted, b)
+		keys = append(keys, ks)
+		cfgs = append(cfgs, rules)
+	}
+
+	decisions, allowErrs := c.atomic.IsAllowedAll(ctx, keys, cfgs)
+	for j, b := range counted {
+		quotas[b], errs[b] = c.tally(ctx, now, batches[b], decisions[j], allowErrs[j], false)
+	}
+	return quotas, errs
+}
@@ -0,0 +1,88 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/google/uuid"
+)
+
+// batchLimiter is a batchRateLimiter counting the batches it is handed.
+type batchLimiter struct {
+	*memory.RateLimiter
+	batches int
+}
+
+func (b *batchLimiter) IsAllowedBatch(ctx context.Context, keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error) {
+	b.batches++
+	decisions := make([]ratelimit.Decision, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		decisions[i], errs[i] = b.IsAllowed(ctx, key, cfgs[i])
+	}
+	return decisions, errs
+}
+
+func TestSendBatch(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rateLimiter := &batchLimiter{RateLimiter: memory.New(memory.Options{Clock: clock})}
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Global: config.Rules{{Limit: 10, WindowSize: 3600}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {Rules: config.Rules{{Algorithm: config.AlgorithmSlidingLog, Limit: 2, WindowSize: 60}}},
+		},
+	})
+	ctrl := NewController(rateLimiter, provider, accept).WithClock(clock)
+	for _, algorithm := range config.Algorithms {
+		ctrl.WithLimiter(algorithm, rateLimiter)
+	}
+
+	first, second := uuid.New(), uuid.New()
+	status := model.Notification{UserID: first, NotificationType: model.NotificationTypeStatus, Message: "status"}
+	other := status
+	other.UserID = second
+	unsupported := status
+	unsupported.Channel = model.ChannelSMS
+
+	results, errs := ctrl.SendBatch(ctx, []model.Notification{status, status, status, other, unsupported})
+
+	// The sends count against each other in order.
+	for i, expected := range []Status{StatusSent, StatusSent, "", StatusSent, ""} {
+		if results[i].Status != expected {
+			t.Errorf("send %d: expected status %q, got %q (%v)", i, expected, results[i].Status, errs[i])
+		}
+	}
+	var exceeded *ratelimit.LimitExceededError
+	if !errors.As(errs[2], &exceeded) || exceeded.RetryAfter != time.Minute {
+		t.Errorf("expected the third send to be denied for a minute, got %v", errs[2])
+	}
+	if got := results[2].Quotas; len(got) != 2 || got[0].Remaining != 0 || got[1].Used != 2 {
+		t.Errorf("expected the denied send to report the quotas the first two left, got %+v", got)
+	}
+	if !errors.Is(errs[4], ErrUnsupportedChannel) {
+		t.Errorf("expected ErrUnsupportedChannel, got %v", errs[4])
+	}
+	if rateLimiter.batches != 1 {
+		t.Errorf("expected every check to be handed over in a single batch, got %d", rateLimiter.batches)
+	}
+
+	// Refunds of the denied send are not counted against the global cap.
+	usage, err := ctrl.Quotas(ctx, first, "", model.NotificationTypeStatus)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := usage.Global; len(got) != 1 || got[0].Used != 2 {
+		t.Errorf("expected the global cap to count the two sends, got %+v", got)
+	}
+}
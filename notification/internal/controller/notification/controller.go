@@ -3,7 +3,13 @@ package notification
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"math"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
@@ -13,49 +19,554 @@ import (
 
 var (
 	ErrUnknowNotificationType = errors.New("unknown notification type")
+	ErrUnsupportedAlgorithm   = errors.New("no rate-limiter registered for algorithm")
+	ErrUnsupportedChannel     = errors.New("no gateway registered for channel")
 	ErrTooManyMessages        = errors.New("too many messages sent to given user")
+	ErrRecipientCapExceeded   = errors.New("too many messages of any type sent to given user")
+	ErrOverridesDisabled      = errors.New("per-recipient overrides are not enabled")
+	ErrConfigReadOnly         = errors.New("rate-limit config cannot be changed at runtime")
+	ErrConfigUnversioned      = errors.New("rate-limit config keeps no previous versions")
+	ErrNotificationTypeExists = errors.New("notification type already exists")
+	ErrQuietHours             = errors.New("notification type is in its quiet hours for given user")
+	ErrDeliveryFailed         = errors.New("failed to hand notification over to the gateway")
 )
 
 type Controller struct {
-	rl      rateLimiter
-	configs config.Provider
+	limiters  map[config.Algorithm]rateLimiter
+	atomic    atomicRateLimiter
+	gateways  map[model.Channel]Gateway
+	configs   config.Provider
+	writable  config.WritableProvider
+	versioned config.VersionedProvider
+	overrides config.OverrideStore
+	queue     deferQueue
+	digests   digestBuffer
+	dedup     dedupStore
+
+	mu  sync.Mutex // serializes changes to the writable config
+	now func() time.Time
 }
 
-func NewController(rateLimiter rateLimiter, configs config.Provider) *Controller {
+// NewController creates a Controller sending notifications without a channel
+// through gw, whose rateLimiter enforces fixed-window rules. Other channels
+// must be registered with WithChannel, other algorithms with WithLimiter.
+//
+// Notifications without a channel are emails: they are counted along with the
+// ones sent over model.ChannelEmail, by its rules.
+//
+// When configs is a config.UserProvider, rules are resolved per recipient.
+//
+// When configs is a config.WritableProvider, notification types can be
+// managed through the Controller, and rolled back to a previous version when
+// it is a config.VersionedProvider.
+func NewController(rl rateLimiter, configs config.Provider, gw Gateway) *Controller {
+	writable, _ := configs.(config.WritableProvider)
+	versioned, _ := configs.(config.VersionedProvider)
 	return &Controller{
-		rateLimiter,
-		configs,
+		limiters:  map[config.Algorithm]rateLimiter{config.AlgorithmFixedWindow: rl},
+		gateways:  map[model.Channel]Gateway{"": gw},
+		configs:   configs,
+		writable:  writable,
+		versioned: versioned,
+		now:       time.Now,
 	}
 }
 
+// WithClock makes the Controller read the time from now, which calendar
+// windows are aligned on, and returns it for chaining. It defaults to
+// time.Now.
+func (c *Controller) WithClock(now func() time.Time) *Controller {
+	c.now = now
+	return c
+}
+
+// WithLimiter registers the rateLimiter used by rules configured with the
+// given algorithm and returns the Controller for chaining.
+func (c *Controller) WithLimiter(algorithm config.Algorithm, rl rateLimiter) *Controller {
+	c.limiters[algorithm] = rl
+	return c
+}
+
+// WithAtomicLimiter makes the rules of a send be counted by rl, all of them
+// or none at once, instead of being consumed one by one and refunded, see
+// consume. It returns the Controller for chaining.
+//
+// The rateLimiter of each algorithm is still used to refund and peek what rl
+// consumed, so rl must count under the same keys as them.
+func (c *Controller) WithAtomicLimiter(rl atomicRateLimiter) *Controller {
+	c.atomic = rl
+	return c
+}
+
+// WithChannel registers the Gateway delivering the notifications sent over
+// channel and returns the Controller for chaining.
+func (c *Controller) WithChannel(channel model.Channel, gw Gateway) *Controller {
+	c.gateways[channel] = gw
+	return c
+}
+
+// WithOverrides makes per-recipient overrides kept in store take precedence
+// over the configured rules, and lets them be managed through the Controller.
+// It returns the Controller for chaining.
+func (c *Controller) WithOverrides(store config.OverrideStore) *Controller {
+	c.configs = config.NewOverrideProvider(c.configs, store)
+	c.overrides = store
+	return c
+}
+
 type rateLimiter interface {
-	IsAllowed(ctx context.Context, key string, limit, windowSize int) (bool, error)
+	IsAllowed(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error)
+	Refund(ctx context.Context, key string, cfg config.RLConfig) error
+	// Peek returns how much of cfg the key used, without consuming anything.
+	Peek(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error)
 }
 
-func (c *Controller) Send(ctx context.Context, id uuid.UUID, notificationType model.NotificationType, message string) error {
-	cfg, ok := c.configs.GetConfig(notificationType)
+// Gateway delivers notifications to their recipients.
+type Gateway interface {
+	// Send hands n over for delivery, it fails when n was not accepted.
+	Send(ctx context.Context, n model.Notification) error
+}
+
+// Status defines what became of a notification handed to Send.
+type Status string
+
+const (
+	// StatusSent means the notification was sent.
+	StatusSent = Status("sent")
+	// StatusDeferred means the notification was denied and queued, it is sent
+	// once its quota frees up.
+	StatusDeferred = Status("deferred")
+	// StatusDigested means the notification was denied and added to the
+	// digest of its recipient, sent once the quota frees up.
+	StatusDigested = Status("digested")
+	// StatusDuplicate means the notification was already sent within the
+	// dedup window of its type, it was neither counted nor sent again.
+	StatusDuplicate = Status("duplicate")
+)
+
+// Result defines the outcome of a Send that did not fail.
+type Result struct {
+	Status Status
+	// ScheduledAt is when a deferred notification, or the digest it was
+	// added to, is due to be sent.
+	ScheduledAt time.Time
+	// Quotas holds the quota of every rule the notification was counted
+	// against, the ones of its type first and then the global cap's, as the
+	// send left them.
+	Quotas []Quota
+}
+
+// Send sends n to its recipient unless it falls within the quiet hours of its
+// notification type, or exceeds its rate limits or the global cap.
+//
+// Quiet hours are checked first, so a send they refuse counts against no
+// limit. The error then wraps ErrQuietHours and a
+// *ratelimit.LimitExceededError retrying once they end.
+//
+// n is delivered by the Gateway of its channel and counted against the rules
+// of that channel, under keys of its own. The quota it takes is refunded when
+// the Gateway fails to accept it, the error then wraps ErrDeliveryFailed.
+//
+// Types configured with config.LimitPolicyDefer are queued instead of being
+// refused, when the Controller has a queue, see WithDeferQueue. The ones
+// configured with config.LimitPolicyDigest are added to a digest, when it has
+// a digest buffer, see WithDigests.
+//
+// Types configured with a config.DedupConfig suppress the duplicates of n sent
+// within its window, before any limit is checked, when the Controller has a
+// dedup store, see WithDedup. n is forgotten when it is not sent, deferred
+// nor digested, so it can be retried.
+//
+// The Result of a send its rate limits refuse still holds its Quotas, along
+// with the error.
+func (c *Controller) Send(ctx context.Context, n model.Notification) (Result, error) {
+	results, errs := c.SendBatch(ctx, []model.Notification{n})
+	return results[0], errs[0]
+}
+
+// finish concludes the send of n, whose type is configured by typeConfig, once
+// its checks were consumed, as described by Send: it is delivered when err
+// tells they allowed it, else deferred, digested or refused depending on the
+// limit policy of its type.
+func (c *Controller) finish(ctx context.Context, now time.Time, n model.Notification, typeConfig config.TypeConfig, checks []check, quotas []Quota, err error) (Result, error) {
+	var exceeded *ratelimit.LimitExceededError
+	if errors.As(err, &exceeded) {
+		at := now.Add(exceeded.RetryAfter)
+		switch {
+		case typeConfig.GetOnLimit() == config.LimitPolicyDefer && c.queue != nil:
+			if err := c.queue.Enqueue(ctx, n, at); err != nil {
+				return Result{}, fmt.Errorf("failed to defer notification: %w", err)
+			}
+			slog.Info("Message Deferred", "user-id", n.UserID, "notification-type", n.NotificationType, "scheduled-at", at)
+			return Result{Status: StatusDeferred, ScheduledAt: at, Quotas: quotas}, nil
+		case typeConfig.GetOnLimit() == config.LimitPolicyDigest && c.digests != nil:
+			digest := model.Digest{
+				UserID:           n.UserID,
+				NotificationType: n.NotificationType,
+				TimeZone:         n.TimeZone,
+				Channel:          n.Channel,
+				Messages:         []string{n.Message},
+				Count:            1,
+			}
+			if err := c.digests.Add(ctx, digest, at, typeConfig.Digest.GetMaxItems()); err != nil {
+				return Result{}, fmt.Errorf("failed to add notification to digest: %w", err)
+			}
+			slog.Info("Message Digested", "user-id", n.UserID, "notification-type", n.NotificationType, "scheduled-at", at)
+			return Result{Status: StatusDigested, ScheduledAt: at, Quotas: quotas}, nil
+		}
+	}
+	if err != nil {
+		return Result{Quotas: quotas}, err
+	}
+
+	if err := c.deliver(ctx, n, checks); err != nil {
+		return Result{}, err
+	}
+	return Result{Status: StatusSent, Quotas: quotas}, nil
+}
+
+// admit checks the quiet hours of n and consumes its rate limits, returning
+// the checks it consumed and their quotas, or why it cannot be sent at now, if
+// it cannot.
+func (c *Controller) admit(ctx context.Context, now time.Time, n model.Notification, typeConfig config.TypeConfig) ([]check, []Quota, error) {
+	if err := quietHours(now, n, typeConfig); err != nil {
+		return nil, nil, err
+	}
+
+	checks := c.sendChecks(now, n, typeConfig)
+	quotas, err := c.consume(ctx, now, checks)
+	if err != nil {
+		return nil, quotas, err
+	}
+	return checks, quotas, nil
+}
+
+// quietHours returns why n cannot be sent at now when it falls within the
+// quiet hours of its type, if any.
+func quietHours(now time.Time, n model.Notification, typeConfig config.TypeConfig) error {
+	quiet := typeConfig.QuietHours
+	if quiet == nil {
+		return nil
+	}
+	if retryAfter, ok := quiet.Until(now, quiet.Location(n.TimeZone)); ok {
+		return fmt.Errorf("%w: %w", ErrQuietHours,
+			ratelimit.NewLimitExceededError(retryAfter, "quiet hours, retry after "+retryAfter.String()))
+	}
+	return nil
+}
+
+// sendChecks builds the checks of a send of n at now: the rules of its type
+// over its channel, then the global cap of its recipient.
+func (c *Controller) sendChecks(now time.Time, n model.Notification, typeConfig config.TypeConfig) []check {
+	channel := countedChannel(n.Channel)
+	recipient := channel.GenKey(n.UserID.String())
+	checks := c.newChecks(now, n, n.NotificationType.GenKey(typeConfig.Group, recipient), typeConfig.ChannelRules(channel), nil)
+	return append(checks, c.newChecks(now, n, model.GenGlobalKey(recipient), c.configs.GetGlobalConfig(), ErrRecipientCapExceeded)...)
+}
+
+// countedChannel returns the channel sends over channel are counted as:
+// notifications without one are emails, whose keys have no channel segment,
+// see model.Channel.GenKey.
+func countedChannel(channel model.Channel) model.Channel {
+	if channel == "" {
+		return model.ChannelEmail
+	}
+	return channel
+}
+
+// deliver hands n over to the Gateway of its channel, refunding the checks it
+// consumed when the Gateway fails to accept it.
+func (c *Controller) deliver(ctx context.Context, n model.Notification, consumed []check) error {
+	gw, ok := c.gateways[n.Channel]
 	if !ok {
-		return ErrUnknowNotificationType
+		c.refund(ctx, consumed)
+		return ErrUnsupportedChannel
 	}
+	if err := gw.Send(ctx, n); err != nil {
+		c.refund(ctx, consumed)
+		return fmt.Errorf("%w: %w", ErrDeliveryFailed, err)
+	}
+	slog.Info("Message Sent!", "user-id", n.UserID, "notification-type", n.NotificationType, "channel", n.Channel)
+	return nil
+}
+
+// NotificationTypes returns every notification type the Controller can send,
+// as configured in its Provider.
+func (c *Controller) NotificationTypes() []model.NotificationType {
+	return c.configs.NotificationTypes()
+}
 
-	valid, err := c.rl.IsAllowed(
-		ctx,
-		notificationType.GenKey(id.String()),
-		cfg.Limit,
-		cfg.WindowSize,
+// typeConfig resolves the config of notificationType for the recipient when
+// the Provider supports it.
+func (c *Controller) typeConfig(ctx context.Context, id uuid.UUID, notificationType model.NotificationType) (config.TypeConfig, bool, error) {
+	if up, ok := c.configs.(config.UserProvider); ok {
+		return up.GetUserConfig(ctx, notificationType, id.String())
+	}
+	cfg, ok := c.configs.GetConfig(notificationType)
+	return cfg, ok, nil
+}
+
+// check is a single rule enforced on a send, along with the key it is counted
+// under and the error its denials are wrapped with, if any. configured is the
+// rule as configured, which differs from rule for calendar-aligned ones, and
+// window the span its limit is counted over.
+type check struct {
+	key        string
+	rule       config.RLConfig
+	configured config.RLConfig
+	window     time.Duration
+	reason     error
+}
+
+// quota returns the Quota of chk its rateLimiter reported as u at now.
+func (chk check) quota(now time.Time, u ratelimit.Usage) Quota {
+	return Quota{
+		Rule:      chk.configured,
+		Window:    chk.window,
+		Limit:     u.Limit,
+		Used:      u.Used,
+		Remaining: u.Remaining,
+		ResetAt:   now.Add(u.ResetAfter),
+	}
+}
+
+// newChecks builds the checks of rules counted under key for a send of n at
+// now.
+//
+// Calendar-aligned rules are enforced as fixed windows counted under a key of
+// their current period, in the recipient's time zone, expiring when it ends:
+// the window starts over at the calendar boundary and Retry-After lasts until
+// then.
+func (c *Controller) newChecks(now time.Time, n model.Notification, key string, rules config.Rules, reason error) []check {
+	checks := make([]check, len(rules))
+	for i, rule := range rules {
+		chk := check{
+			key:        rules.Key(key, i),
+			rule:       rule,
+			configured: rule,
+			window:     time.Duration(rule.WindowSize) * time.Second,
+			reason:     reason,
+		}
+		if rule.GetAlgorithm() == config.AlgorithmGCRA {
+			chk.window = time.Duration(rule.Burst) * rule.EmissionInterval()
+		}
+		if rule.Reset != "" {
+			start, end := rule.Period(now, rule.Location(n.TimeZone))
+			chk.key += ":" + strconv.FormatInt(start.Unix(), 10)
+			chk.rule.WindowSize = int(math.Ceil(end.Sub(now).Seconds()))
+			chk.window = end.Sub(start)
+		}
+		checks[i] = chk
+	}
+	return checks
+}
+
+// consume takes one request from every check or from none of them. With an
+// atomicRateLimiter, see WithAtomicLimiter, they are all checked at once and
+// only consumed when every one of them allows. Otherwise each one is checked
+// in turn, and when any of them denies or fails, the ones that allowed are
+// refunded: under contention this may deny a request that would have fit, but
+// it never lets one through that exceeds a rule. When several checks deny, the
+// returned error carries the longest Retry-After among them, wrapped with the
+// reason of the check it came from.
+//
+// The quota of every check, at now, is returned along, as the denied request
+// left it, unless a rateLimiter failed.
+func (c *Controller) consume(ctx context.Context, now time.Time, checks []check) ([]Quota, error) {
+	quotas, errs := c.consumeBatch(ctx, now, [][]check{checks})
+	return quotas[0], errs[0]
+}
+
+// tally settles the checks of a single send, given the decision and the error
+// each of them got, as described by consume: when any of them denied or
+// failed, the ones that allowed are refunded, if refund tells they were
+// consumed, and their quota given back.
+func (c *Controller) tally(ctx context.Context, now time.Time, checks []check, decisions []ratelimit.Decision, errs []error, refund bool) ([]Quota, error) {
+	var (
+		consumed []check
+		allowed  []int
+		exceeded *ratelimit.LimitExceededError
+		reason   error
+		denied   bool
+		failure  error
 	)
-	if err != nil {
-		var exceededError *ratelimit.LimitExceededError
-		if errors.As(err, &exceededError) {
-			return exceededError
+	quotas := make([]Quota, len(checks))
+	for i, chk := range checks {
+		quotas[i] = chk.quota(now, decisions[i].Usage)
+		if err := errs[i]; err != nil {
+			var exceededError *ratelimit.LimitExceededError
+			if !errors.As(err, &exceededError) {
+				if failure == nil {
+					failure = err
+				}
+				continue
+			}
+			if exceeded == nil || exceededError.RetryAfter > exceeded.RetryAfter {
+				exceeded, reason = exceededError, chk.reason
+			}
+			continue
 		}
-		return err
+		if !decisions[i].Allowed {
+			// This shouldn't happen in our current implementations since they
+			// always return an error when !valid, but it's good defensive programming
+			if !denied && exceeded == nil {
+				reason = chk.reason
+			}
+			denied = true
+			continue
+		}
+		consumed = append(consumed, chk)
+		allowed = append(allowed, i)
 	}
-	if !valid {
-		// This shouldn't happen in our current implementation since redis.go
-		// always returns an error when !valid, but it's good defensive programming
-		return ErrTooManyMessages
+
+	if failure == nil && exceeded == nil && !denied {
+		return quotas, nil
 	}
-	slog.Info("Message Sent!", "user-id", id, "notification-type", notificationType, "message", message)
-	return nil
+	if refund {
+		c.refund(ctx, consumed)
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	for _, i := range allowed {
+		quotas[i].Used--
+		quotas[i].Remaining++
+	}
+
+	var err error = ErrTooManyMessages
+	if exceeded != nil {
+		err = exceeded
+	}
+	if reason != nil {
+		return quotas, fmt.Errorf("%w: %w", reason, err)
+	}
+	return quotas, err
+}
+
+// refund gives back the requests consumed from the given checks, whose
+// algorithms all have a registered rateLimiter.
+func (c *Controller) refund(ctx context.Context, consumed []check) {
+	for _, chk := range consumed {
+		if err := c.limiters[chk.rule.GetAlgorithm()].Refund(ctx, chk.key, chk.rule); err != nil {
+			slog.Error("failed to refund rate-limit rule", "key", chk.key, "rule", chk.rule, "err", err)
+		}
+	}
+}
+
+// ListOverrides returns every override of the recipient by notification type.
+func (c *Controller) ListOverrides(ctx context.Context, id uuid.UUID) (map[model.NotificationType]config.Override, error) {
+	if c.overrides == nil {
+		return nil, ErrOverridesDisabled
+	}
+	return c.overrides.ListOverrides(ctx, id.String())
+}
+
+// SetOverride makes o take precedence over the rules of notificationType for
+// the recipient.
+func (c *Controller) SetOverride(ctx context.Context, id uuid.UUID, notificationType model.NotificationType, o config.Override) error {
+	if c.overrides == nil {
+		return ErrOverridesDisabled
+	}
+	if _, ok := c.configs.GetConfig(notificationType); !ok {
+		return ErrUnknowNotificationType
+	}
+	return c.overrides.SetOverride(ctx, id.String(), notificationType, o)
+}
+
+// DeleteOverride restores the configured rules of notificationType for the
+// recipient.
+func (c *Controller) DeleteOverride(ctx context.Context, id uuid.UUID, notificationType model.NotificationType) error {
+	if c.overrides == nil {
+		return ErrOverridesDisabled
+	}
+	return c.overrides.DeleteOverride(ctx, id.String(), notificationType)
+}
+
+// Limits returns the rate-limit config currently served, as configured: types
+// sharing a group only reference it.
+func (c *Controller) Limits() (config.Limits, error) {
+	if c.writable == nil {
+		return config.Limits{}, ErrConfigReadOnly
+	}
+	limits, _ := c.writable.Limits()
+	return limits, nil
+}
+
+// LimitsHistory returns the previous versions of the rate-limit config still
+// kept, newest first.
+func (c *Controller) LimitsHistory(ctx context.Context) ([]config.Version, error) {
+	if c.versioned == nil {
+		return nil, ErrConfigUnversioned
+	}
+	return c.versioned.History(ctx)
+}
+
+// RollbackLimits serves again a previous version of the rate-limit config,
+// returning the new version it gets. It fails with config.ErrUnknownVersion
+// when that version is not kept anymore.
+func (c *Controller) RollbackLimits(ctx context.Context, version int64) (int64, error) {
+	if c.versioned == nil {
+		return 0, ErrConfigUnversioned
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.versioned.Rollback(ctx, version)
+}
+
+// CreateTypeConfig adds a notification type to the rate-limit config.
+func (c *Controller) CreateTypeConfig(ctx context.Context, notificationType model.NotificationType, cfg config.TypeConfig) error {
+	return c.updateTypes(ctx, func(types map[model.NotificationType]config.TypeConfig) error {
+		if _, ok := types[notificationType]; ok {
+			return ErrNotificationTypeExists
+		}
+		types[notificationType] = cfg
+		return nil
+	})
+}
+
+// UpdateTypeConfig replaces the rate-limit config of a notification type.
+func (c *Controller) UpdateTypeConfig(ctx context.Context, notificationType model.NotificationType, cfg config.TypeConfig) error {
+	return c.updateTypes(ctx, func(types map[model.NotificationType]config.TypeConfig) error {
+		if _, ok := types[notificationType]; !ok {
+			return ErrUnknowNotificationType
+		}
+		types[notificationType] = cfg
+		return nil
+	})
+}
+
+// DeleteTypeConfig removes a notification type from the rate-limit config,
+// so it can no longer be sent.
+func (c *Controller) DeleteTypeConfig(ctx context.Context, notificationType model.NotificationType) error {
+	return c.updateTypes(ctx, func(types map[model.NotificationType]config.TypeConfig) error {
+		if _, ok := types[notificationType]; !ok {
+			return ErrUnknowNotificationType
+		}
+		delete(types, notificationType)
+		return nil
+	})
+}
+
+// updateTypes applies change to a copy of the configured types and writes the
+// result back, which fails with a *config.InvalidLimitsError when it is not
+// valid, and with config.ErrVersionConflict when the config was changed
+// meanwhile, e.g. by another replica.
+func (c *Controller) updateTypes(ctx context.Context, change func(map[model.NotificationType]config.TypeConfig) error) error {
+	if c.writable == nil {
+		return ErrConfigReadOnly
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limits, version := c.writable.Limits()
+	limits.Types = maps.Clone(limits.Types)
+	if limits.Types == nil {
+		limits.Types = map[model.NotificationType]config.TypeConfig{}
+	}
+	if err := change(limits.Types); err != nil {
+		return err
+	}
+	return c.writable.Update(ctx, version, limits)
 }
@@ -0,0 +1,203 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	queuememory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/queue/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/google/uuid"
+)
+
+// gatewayFunc adapts a function to a Gateway.
+type gatewayFunc func(ctx context.Context, n model.Notification) error
+
+func (f gatewayFunc) Send(ctx context.Context, n model.Notification) error {
+	return f(ctx, n)
+}
+
+// accept is a Gateway accepting every notification.
+var accept = gatewayFunc(func(context.Context, model.Notification) error { return nil })
+
+func TestSend_RefundsFailedDeliveries(t *testing.T) {
+	ctx := context.Background()
+	rateLimiter := memory.New(memory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Global: config.Rules{{Limit: 1, WindowSize: 3600}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+		},
+	})
+	down := errors.New("gateway down")
+	var delivered []model.Notification
+	gw := gatewayFunc(func(_ context.Context, n model.Notification) error {
+		if n.Message == "fails" {
+			return down
+		}
+		delivered = append(delivered, n)
+		return nil
+	})
+	ctrl := NewController(rateLimiter, provider, gw)
+
+	userID := uuid.New()
+	failing := model.Notification{UserID: userID, NotificationType: model.NotificationTypeNews, Message: "fails"}
+	if _, err := ctrl.Send(ctx, failing); !errors.Is(err, ErrDeliveryFailed) || !errors.Is(err, down) {
+		t.Fatalf("expected ErrDeliveryFailed wrapping the gateway error, got %v", err)
+	}
+
+	// Neither the type rule nor the global cap kept the failed send.
+	news := model.Notification{UserID: userID, NotificationType: model.NotificationTypeNews, Message: "news"}
+	if result, err := ctrl.Send(ctx, news); err != nil || result.Status != StatusSent {
+		t.Fatalf("expected the failed send to be refunded, got %+v, %v", result, err)
+	}
+	if len(delivered) != 1 || delivered[0] != news {
+		t.Errorf("expected the news to be delivered, got %v", delivered)
+	}
+}
+
+func TestSend_EmailsKeepTheKeysFromBeforeChannels(t *testing.T) {
+	ctx := context.Background()
+	rateLimiter := memory.New(memory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	rule := config.RLConfig{Limit: 1, WindowSize: 60}
+	provider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{rule}},
+		},
+	})
+	ctrl := NewController(rateLimiter, provider, accept).
+		WithChannel(model.ChannelEmail, accept).
+		WithChannel(model.ChannelSMS, accept)
+
+	// A send counted before there were channels.
+	userID := uuid.New()
+	if decision, err := rateLimiter.IsAllowed(ctx, model.NotificationTypeNews.GenKey("", userID.String()), rule); !decision.Allowed {
+		t.Fatalf("expected the first send to be allowed, got %v", err)
+	}
+
+	for _, channel := range []model.Channel{"", model.ChannelEmail} {
+		n := model.Notification{UserID: userID, NotificationType: model.NotificationTypeNews, Message: "news", Channel: channel}
+		var exceeded *ratelimit.LimitExceededError
+		if _, err := ctrl.Send(ctx, n); !errors.As(err, &exceeded) {
+			t.Errorf("channel %q: expected the send to count against the existing quota, got %v", channel, err)
+		}
+	}
+	sms := model.Notification{UserID: userID, NotificationType: model.NotificationTypeNews, Message: "news", Channel: model.ChannelSMS}
+	if result, err := ctrl.Send(ctx, sms); err != nil || result.Status != StatusSent {
+		t.Errorf("expected sms to have its own quota, got %+v, %v", result, err)
+	}
+}
+
+func TestSend_AtomicLimiterUnderContention(t *testing.T) {
+	ctx := context.Background()
+	rateLimiter := memory.New(memory.Options{})
+	t.Cleanup(rateLimiter.Close)
+
+	// The news type runs out well before the global cap, the status one never
+	// does: a news send the global cap denied must not count against news,
+	// nor a status one denied by news against the global cap.
+	provider := config.NewRLConfigProvider(config.Limits{
+		Global: config.Rules{{Algorithm: config.AlgorithmSlidingLog, Limit: 10, WindowSize: 3600}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews:   {Rules: config.Rules{{Limit: 5, WindowSize: 60}}},
+			model.NotificationTypeStatus: {Rules: config.Rules{{Algorithm: config.AlgorithmGCRA, Burst: 100, Rate: 1, WindowSize: 1}}},
+		},
+	})
+	ctrl := NewController(rateLimiter, provider, accept).WithAtomicLimiter(rateLimiter)
+	for _, algorithm := range config.Algorithms {
+		ctrl.WithLimiter(algorithm, rateLimiter)
+	}
+
+	userID := uuid.New()
+	types := []model.NotificationType{model.NotificationTypeNews, model.NotificationTypeStatus}
+	var (
+		sent = make(map[model.NotificationType]*atomic.Int64)
+		wg   sync.WaitGroup
+	)
+	for _, notificationType := range types {
+		sent[notificationType] = &atomic.Int64{}
+	}
+	for range 50 {
+		for _, notificationType := range types {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n := model.Notification{UserID: userID, NotificationType: notificationType, Message: "hello"}
+				if result, err := ctrl.Send(ctx, n); err == nil && result.Status == StatusSent {
+					sent[notificationType].Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if total := sent[model.NotificationTypeNews].Load() + sent[model.NotificationTypeStatus].Load(); total != 10 {
+		t.Errorf("expected exactly 10 sends, got %d", total)
+	}
+	usage, err := ctrl.Quotas(ctx, userID, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if used := usage.Global[0].Used; used != 10 {
+		t.Errorf("expected the global cap to count the 10 sends only, got %d", used)
+	}
+	for _, notificationType := range types {
+		if used, expected := usage.Types[notificationType][0].Used, sent[notificationType].Load(); int64(used) != expected {
+			t.Errorf("expected %s to count its %d sends only, got %d", notificationType, expected, used)
+		}
+	}
+}
+
+func TestDrainDue_RetriesFailedDeliveries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}, OnLimit: config.LimitPolicyDefer},
+		},
+	})
+	fail := true
+	gw := gatewayFunc(func(context.Context, model.Notification) error {
+		if fail {
+			return errors.New("gateway down")
+		}
+		return nil
+	})
+	queue := queuememory.New()
+	ctrl := NewController(rateLimiter, provider, gw).WithClock(clock).WithDeferQueue(queue)
+
+	status := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+	if err := queue.Enqueue(ctx, status, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctrl.drainDue(ctx, time.Second)
+	due, _ := queue.Due(ctx, now.Add(time.Second), 10)
+	if len(due) != 1 {
+		t.Fatalf("expected the failed delivery to be retried after a second, got %v", due)
+	}
+
+	// The failed delivery was refunded, so the retry fits in the same window.
+	fail = false
+	if err := queue.Enqueue(ctx, status, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctrl.drainDue(ctx, time.Second)
+	if due, _ := queue.Due(ctx, now.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected the retry to be delivered, got %v", due)
+	}
+}
@@ -0,0 +1,34 @@
+package notification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+type dedupStore interface {
+	// Remember keeps key for window, reporting false when it already was.
+	Remember(ctx context.Context, key string, window time.Duration) (bool, error)
+	// Forget removes key, if kept.
+	Forget(ctx context.Context, key string) error
+}
+
+// WithDedup makes the Controller remember the notifications of types
+// configured with a config.DedupConfig in s, so their duplicates are
+// suppressed within its window. It returns the Controller for chaining.
+func (c *Controller) WithDedup(s dedupStore) *Controller {
+	c.dedup = s
+	return c
+}
+
+// dedupKey identifies the content of n: its notification type, recipient and
+// message. Keys are hashed to bound their size whatever the message.
+func dedupKey(n model.Notification) string {
+	h := sha256.New()
+	h.Write([]byte(string(n.NotificationType) + "\n" + countedChannel(n.Channel).GenKey(n.UserID.String()) + "\n"))
+	h.Write([]byte(n.Message))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	dedupmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/dedup/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/google/uuid"
+)
+
+func TestSend_SuppressesDuplicates(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {
+				Rules: config.Rules{{Limit: 2, WindowSize: 60}},
+				Dedup: &config.DedupConfig{WindowSize: 600},
+			},
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 2, WindowSize: 60}}},
+		},
+	})
+	var delivered []model.Notification
+	gw := gatewayFunc(func(_ context.Context, n model.Notification) error {
+		delivered = append(delivered, n)
+		return nil
+	})
+	ctrl := NewController(rateLimiter, provider, gw).WithClock(clock).WithDedup(dedupmemory.New())
+
+	userID := uuid.New()
+	status := model.Notification{UserID: userID, NotificationType: model.NotificationTypeStatus, Message: "Your order shipped"}
+	if result, err := ctrl.Send(ctx, status); err != nil || result.Status != StatusSent {
+		t.Fatalf("expected the first status to be sent, got %+v, %v", result, err)
+	}
+	for range 3 {
+		if result, err := ctrl.Send(ctx, status); err != nil || result.Status != StatusDuplicate {
+			t.Fatalf("expected the status to be suppressed, got %+v, %v", result, err)
+		}
+	}
+	if len(delivered) != 1 {
+		t.Fatalf("expected a single delivery, got %d", len(delivered))
+	}
+
+	// The duplicates took no quota, and other messages, recipients and types
+	// are not duplicates.
+	other := status
+	other.Message = "Your order was delivered"
+	if result, err := ctrl.Send(ctx, other); err != nil || result.Status != StatusSent {
+		t.Errorf("expected another status to be sent, got %+v, %v", result, err)
+	}
+	toOther := status
+	toOther.UserID = uuid.New()
+	if result, err := ctrl.Send(ctx, toOther); err != nil || result.Status != StatusSent {
+		t.Errorf("expected the status to another recipient to be sent, got %+v, %v", result, err)
+	}
+	news := model.Notification{UserID: userID, NotificationType: model.NotificationTypeNews, Message: status.Message}
+	for range 2 {
+		if result, err := ctrl.Send(ctx, news); err != nil || result.Status != StatusSent {
+			t.Errorf("expected types without a dedup window to be sent every time, got %+v, %v", result, err)
+		}
+	}
+
+	// Denied notifications are forgotten, so they can be retried.
+	denied := status
+	denied.Message = "Your order is out for delivery"
+	var exceeded *ratelimit.LimitExceededError
+	if _, err := ctrl.Send(ctx, denied); !errors.As(err, &exceeded) {
+		t.Fatalf("expected the status to be denied, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if result, err := ctrl.Send(ctx, denied); err != nil || result.Status != StatusSent {
+		t.Errorf("expected the denied status to be sent once retried, got %+v, %v", result, err)
+	}
+
+	if result, _ := ctrl.Send(ctx, status); result.Status != StatusDuplicate {
+		t.Errorf("expected the status to still be suppressed, got %+v", result)
+	}
+}
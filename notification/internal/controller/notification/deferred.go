@@ -0,0 +1,109 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+)
+
+// deferredBatchSize is how many due notifications are taken from the queue at
+// once.
+const deferredBatchSize = 100
+
+type deferQueue interface {
+	// Enqueue defers n until at.
+	Enqueue(ctx context.Context, n model.Notification, at time.Time) error
+	// Due removes and returns up to limit notifications due at now.
+	Due(ctx context.Context, now time.Time, limit int) ([]model.Notification, error)
+}
+
+// WithDeferQueue makes the Controller queue the notifications of types
+// configured with config.LimitPolicyDefer when they are denied, instead of
+// refusing them. DrainDeferred must run to send them later. It returns the
+// Controller for chaining.
+func (c *Controller) WithDeferQueue(q deferQueue) *Controller {
+	c.queue = q
+	return c
+}
+
+// DrainDeferred sends the deferred notifications and the digests as they
+// become due, checked every interval, until ctx is done. The ones still denied
+// are deferred again until their new Retry-After, the ones whose type is no
+// longer configured are dropped.
+func (c *Controller) DrainDeferred(ctx context.Context, interval time.Duration) {
+	if c.queue == nil && c.digests == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if c.queue != nil {
+				c.drainDue(ctx, interval)
+			}
+			if c.digests != nil {
+				c.drainDigests(ctx, interval)
+			}
+		}
+	}
+}
+
+// drainDue sends every deferred notification due now, retrying the ones that
+// fail for other reasons than their limits after retryAfter.
+func (c *Controller) drainDue(ctx context.Context, retryAfter time.Duration) {
+	for {
+		due, err := c.queue.Due(ctx, c.now(), deferredBatchSize)
+		if err != nil {
+			slog.Error("failed to get deferred notifications", "err", err)
+		}
+		for _, n := range due {
+			c.sendDeferred(ctx, n, retryAfter)
+		}
+		if err != nil || len(due) < deferredBatchSize {
+			return
+		}
+	}
+}
+
+func (c *Controller) sendDeferred(ctx context.Context, n model.Notification, retryAfter time.Duration) {
+	typeConfig, ok, err := c.typeConfig(ctx, n.UserID, n.NotificationType)
+	if err == nil && !ok {
+		slog.Warn("dropping deferred notification of an unknown type", "user-id", n.UserID, "notification-type", n.NotificationType)
+		return
+	}
+	if _, ok := c.gateways[n.Channel]; !ok {
+		slog.Warn("dropping deferred notification of an unsupported channel", "user-id", n.UserID, "notification-type", n.NotificationType, "channel", n.Channel)
+		return
+	}
+
+	now := c.now()
+	var consumed []check
+	if err == nil {
+		consumed, _, err = c.admit(ctx, now, n, typeConfig)
+	}
+	if err == nil {
+		err = c.deliver(ctx, n, consumed)
+	}
+	if err == nil {
+		return
+	}
+
+	var exceeded *ratelimit.LimitExceededError
+	if errors.As(err, &exceeded) {
+		retryAfter = exceeded.RetryAfter
+	} else {
+		slog.Error("failed to send deferred notification, retrying", "user-id", n.UserID, "notification-type", n.NotificationType, "err", err)
+	}
+	if err := c.queue.Enqueue(ctx, n, now.Add(retryAfter)); err != nil {
+		slog.Error("failed to defer notification again, dropping it", "user-id", n.UserID, "notification-type", n.NotificationType, "err", err)
+	}
+}
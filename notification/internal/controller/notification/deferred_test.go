@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	queuememory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/queue/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/google/uuid"
+)
+
+func newDeferTestController(t *testing.T, now *time.Time) (*Controller, *queuememory.Queue) {
+	t.Helper()
+
+	clock := func() time.Time { return *now }
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}, OnLimit: config.LimitPolicyDefer},
+			model.NotificationTypeNews:   {Rules: config.Rules{{Limit: 1, WindowSize: 60}}},
+		},
+	})
+	queue := queuememory.New()
+	return NewController(rateLimiter, provider, accept).WithClock(clock).WithDeferQueue(queue), queue
+}
+
+func TestSend_DefersDeniedNotifications(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctrl, queue := newDeferTestController(t, &now)
+
+	status := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+	if result, err := ctrl.Send(ctx, status); err != nil || result.Status != StatusSent {
+		t.Fatalf("expected the first status update to be sent, got %+v, %v", result, err)
+	}
+	for range 2 {
+		result, err := ctrl.Send(ctx, status)
+		if err != nil || result.Status != StatusDeferred || !result.ScheduledAt.Equal(now.Add(time.Minute)) {
+			t.Fatalf("expected the status update to be deferred by a minute, got %+v, %v", result, err)
+		}
+	}
+
+	// Types without the defer policy are still refused.
+	news := model.Notification{UserID: status.UserID, NotificationType: model.NotificationTypeNews, Message: "news"}
+	ctrl.Send(ctx, news)
+	var exceeded *ratelimit.LimitExceededError
+	if _, err := ctrl.Send(ctx, news); !errors.As(err, &exceeded) {
+		t.Fatalf("expected the news to be refused, got %v", err)
+	}
+
+	// Nothing is due yet.
+	now = now.Add(30 * time.Second)
+	ctrl.drainDue(ctx, time.Second)
+
+	// Once due, the first one is sent and the second deferred again, as the
+	// quota only frees up for one.
+	now = now.Add(30 * time.Second)
+	ctrl.drainDue(ctx, time.Second)
+	if due, _ := queue.Due(ctx, now.Add(time.Minute-time.Millisecond), 10); len(due) != 0 {
+		t.Fatalf("expected a single deferred notification left, due in a minute, got %v", due)
+	}
+	if due, _ := queue.Due(ctx, now.Add(time.Minute), 10); len(due) != 1 {
+		t.Fatalf("expected a single deferred notification left, due in a minute, got %v", due)
+	}
+
+	// The quota is used by the deferred notification that was sent.
+	if result, _ := ctrl.Send(ctx, status); result.Status != StatusDeferred {
+		t.Errorf("expected the quota to be taken by the deferred notification, got %+v", result)
+	}
+}
+
+func TestSend_RefusesWithoutDeferQueue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctrl, _ := newDeferTestController(t, &now)
+	ctrl.queue = nil
+
+	status := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+	ctrl.Send(ctx, status)
+	var exceeded *ratelimit.LimitExceededError
+	if _, err := ctrl.Send(ctx, status); !errors.As(err, &exceeded) {
+		t.Errorf("expected the status update to be refused, got %v", err)
+	}
+}
+
+func TestDrainDue_DropsUnknownTypes(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctrl, queue := newDeferTestController(t, &now)
+
+	queue.Enqueue(ctx, model.Notification{UserID: uuid.New(), NotificationType: "removed-notification"}, now)
+	ctrl.drainDue(ctx, time.Second)
+
+	if due, _ := queue.Due(ctx, now.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected the notification of an unknown type to be dropped, got %v", due)
+	}
+}
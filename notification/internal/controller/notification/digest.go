@@ -0,0 +1,97 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+)
+
+type digestBuffer interface {
+	// Add merges d into the digest of its recipient, notification type and
+	// channel, keeping up to maxItems messages. A new digest is due at at, one already
+	// buffered keeps its due time.
+	Add(ctx context.Context, d model.Digest, at time.Time, maxItems int) error
+	// Due removes and returns up to limit digests due at now.
+	Due(ctx context.Context, now time.Time, limit int) ([]model.Digest, error)
+}
+
+// WithDigests makes the Controller add the notifications of types configured
+// with config.LimitPolicyDigest to the digest of their recipient when they are
+// denied, instead of refusing them. DrainDeferred must run to send the
+// digests. It returns the Controller for chaining.
+func (c *Controller) WithDigests(b digestBuffer) *Controller {
+	c.digests = b
+	return c
+}
+
+// drainDigests sends every digest due now, combined into a single notification
+// as configured by its type, retrying the ones that fail for other reasons
+// than their limits after retryAfter.
+func (c *Controller) drainDigests(ctx context.Context, retryAfter time.Duration) {
+	for {
+		due, err := c.digests.Due(ctx, c.now(), deferredBatchSize)
+		if err != nil {
+			slog.Error("failed to get due digests", "err", err)
+		}
+		for _, d := range due {
+			c.sendDigest(ctx, d, retryAfter)
+		}
+		if err != nil || len(due) < deferredBatchSize {
+			return
+		}
+	}
+}
+
+func (c *Controller) sendDigest(ctx context.Context, d model.Digest, retryAfter time.Duration) {
+	typeConfig, ok, err := c.typeConfig(ctx, d.UserID, d.NotificationType)
+	if err == nil && !ok {
+		slog.Warn("dropping digest of an unknown type", "user-id", d.UserID, "notification-type", d.NotificationType, "count", d.Count)
+		return
+	}
+	if _, ok := c.gateways[d.Channel]; !ok {
+		slog.Warn("dropping digest of an unsupported channel", "user-id", d.UserID, "notification-type", d.NotificationType, "channel", d.Channel)
+		return
+	}
+
+	var message string
+	if err == nil {
+		message, err = typeConfig.Digest.Render(d)
+		if err != nil {
+			slog.Error("failed to render digest, dropping it", "user-id", d.UserID, "notification-type", d.NotificationType, "count", d.Count, "err", err)
+			return
+		}
+	}
+
+	now := c.now()
+	n := model.Notification{
+		UserID:           d.UserID,
+		NotificationType: d.NotificationType,
+		Message:          message,
+		TimeZone:         d.TimeZone,
+		Channel:          d.Channel,
+	}
+	var consumed []check
+	if err == nil {
+		consumed, _, err = c.admit(ctx, now, n, typeConfig)
+	}
+	if err == nil {
+		err = c.deliver(ctx, n, consumed)
+	}
+	if err == nil {
+		return
+	}
+
+	var exceeded *ratelimit.LimitExceededError
+	if errors.As(err, &exceeded) {
+		retryAfter = exceeded.RetryAfter
+	} else {
+		slog.Error("failed to send digest, retrying", "user-id", d.UserID, "notification-type", d.NotificationType, "err", err)
+	}
+	if err := c.digests.Add(ctx, d, now.Add(retryAfter), typeConfig.Digest.GetMaxItems()); err != nil {
+		slog.Error("failed to buffer digest again, dropping it", "user-id", d.UserID, "notification-type", d.NotificationType, "count", d.Count, "err", err)
+	}
+}
@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	digestmemory "github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/digest/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+)
+
+func TestSend_DigestsDeniedNotifications(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {
+				Rules:   config.Rules{{Limit: 1, WindowSize: 60}},
+				OnLimit: config.LimitPolicyDigest,
+				Digest:  &config.DigestConfig{MaxItems: 2},
+			},
+		},
+	})
+	digests := digestmemory.New()
+	ctrl := NewController(rateLimiter, provider, accept).WithClock(clock).WithDigests(digests)
+
+	news := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeNews, Message: "news"}
+	if result, err := ctrl.Send(ctx, news); err != nil || result.Status != StatusSent {
+		t.Fatalf("expected the first news to be sent, got %+v, %v", result, err)
+	}
+	for range 3 {
+		result, err := ctrl.Send(ctx, news)
+		if err != nil || result.Status != StatusDigested || !result.ScheduledAt.Equal(now.Add(time.Minute)) {
+			t.Fatalf("expected the news to be digested until the window resets, got %+v, %v", result, err)
+		}
+	}
+
+	// Nothing is due until the window resets, then the digest is sent and
+	// takes the quota of the new window.
+	now = now.Add(30 * time.Second)
+	ctrl.drainDigests(ctx, time.Second)
+	if result, _ := ctrl.Send(ctx, news); !result.ScheduledAt.Equal(now.Add(30 * time.Second)) {
+		t.Fatalf("expected the news to join the pending digest, got %+v", result)
+	}
+
+	now = now.Add(30 * time.Second)
+	ctrl.drainDigests(ctx, time.Second)
+	if due, _ := digests.Due(ctx, now.Add(24*time.Hour), 10); len(due) != 0 {
+		t.Fatalf("expected the digest to be sent, got %v", due)
+	}
+	if result, _ := ctrl.Send(ctx, news); result.Status != StatusDigested || !result.ScheduledAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected the digest to take the quota of the new window, got %+v", result)
+	}
+}
+
+func TestDrainDigests_BuffersDeniedDigestsAgain(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	provider := config.NewRLConfigProvider(config.Limits{
+		Global: config.Rules{{Limit: 1, WindowSize: 3600}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 60}}, OnLimit: config.LimitPolicyDigest},
+		},
+	})
+	digests := digestmemory.New()
+	ctrl := NewController(rateLimiter, provider, accept).WithClock(clock).WithDigests(digests)
+
+	news := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeNews, Message: "news"}
+	ctrl.Send(ctx, news)
+	ctrl.Send(ctx, news)
+
+	// The global cap still denies the digest once the type window resets.
+	now = now.Add(time.Hour)
+	ctrl.Send(ctx, news)
+	ctrl.Send(ctx, news)
+	now = now.Add(time.Minute)
+	ctrl.drainDigests(ctx, time.Second)
+
+	due, _ := digests.Due(ctx, now.Add(time.Hour), 10)
+	if len(due) != 1 || due[0].Count != 2 {
+		t.Errorf("expected the denied digest to be buffered again, got %v", due)
+	}
+}
@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+)
+
+// Quota defines how much of a rule a recipient used.
+type Quota struct {
+	Rule config.RLConfig
+	// Window is the span Limit is counted over: the window of the rule, the
+	// period of a calendar-aligned one, or the time a GCRA one takes to
+	// replenish its whole burst.
+	Window    time.Duration
+	Limit     int
+	Used      int
+	Remaining int
+	// ResetAt is when the whole limit is available again.
+	ResetAt time.Time
+}
+
+// Usage defines how much of its rate limits a recipient used over a channel.
+type Usage struct {
+	// Types holds the quota of every rule of each notification type, in
+	// order. A type without any rule is unlimited.
+	Types map[model.NotificationType][]Quota
+	// Global holds the quota of every rule of the global cap.
+	Global []Quota
+}
+
+// Quotas returns how much of the rules of the given notification types, or
+// of every configured one when none is given, and of the global cap the
+// recipient used over channel. Nothing is consumed: the quotas are read as a
+// send would find them now.
+func (c *Controller) Quotas(ctx context.Context, id uuid.UUID, channel model.Channel, types ...model.NotificationType) (Usage, error) {
+	if _, ok := c.gateways[channel]; !ok {
+		return Usage{}, ErrUnsupportedChannel
+	}
+	if len(types) == 0 {
+		types = c.configs.NotificationTypes()
+	}
+
+	now := c.now()
+	channel = countedChannel(channel)
+	recipient := channel.GenKey(id.String())
+	n := model.Notification{UserID: id, Channel: channel}
+	usage := Usage{Types: make(map[model.NotificationType][]Quota, len(types))}
+	for _, notificationType := range types {
+		typeConfig, ok, err := c.typeConfig(ctx, id, notificationType)
+		if err != nil {
+			return Usage{}, err
+		}
+		if !ok {
+			return Usage{}, ErrUnknowNotificationType
+		}
+
+		n.NotificationType = notificationType
+		rules := typeConfig.ChannelRules(channel)
+		quotas, err := c.peek(ctx, now, c.newChecks(now, n, notificationType.GenKey(typeConfig.Group, recipient), rules, nil))
+		if err != nil {
+			return Usage{}, err
+		}
+		usage.Types[notificationType] = quotas
+	}
+
+	global := c.configs.GetGlobalConfig()
+	quotas, err := c.peek(ctx, now, c.newChecks(now, n, model.GenGlobalKey(recipient), global, nil))
+	if err != nil {
+		return Usage{}, err
+	}
+	usage.Global = quotas
+	return usage, nil
+}
+
+// peek reads the quota of each of the checks, at now.
+func (c *Controller) peek(ctx context.Context, now time.Time, checks []check) ([]Quota, error) {
+	quotas := make([]Quota, len(checks))
+	for i, chk := range checks {
+		rl, ok := c.limiters[chk.rule.GetAlgorithm()]
+		if !ok {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		u, err := rl.Peek(ctx, chk.key, chk.rule)
+		if err != nil {
+			return nil, err
+		}
+		quotas[i] = chk.quota(now, u)
+	}
+	return quotas, nil
+}
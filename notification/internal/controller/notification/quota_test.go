@@ -0,0 +1,149 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/ratelimiter/memory"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/google/uuid"
+)
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	status := config.Rules{
+		{Algorithm: config.AlgorithmSlidingLog, Limit: 2, WindowSize: 60},
+		{Limit: 20, Reset: config.ResetDay},
+	}
+	provider := config.NewRLConfigProvider(config.Limits{
+		Global: config.Rules{{Limit: 10, WindowSize: 3600}},
+		Types: map[model.NotificationType]config.TypeConfig{
+			model.NotificationTypeStatus: {
+				Rules:    status,
+				Channels: map[model.Channel]config.Override{model.ChannelInApp: {Unlimited: true}},
+			},
+			model.NotificationTypeNews: {Rules: config.Rules{{Limit: 1, WindowSize: 86400}}},
+		},
+	})
+	ctrl := NewController(rateLimiter, provider, accept).
+		WithClock(clock).
+		WithChannel(model.ChannelInApp, accept)
+	for _, algorithm := range config.Algorithms {
+		ctrl.WithLimiter(algorithm, rateLimiter)
+	}
+
+	userID := uuid.New()
+	for range 2 {
+		if _, err := ctrl.Send(ctx, model.Notification{UserID: userID, NotificationType: model.NotificationTypeStatus, Message: "status"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		now = now.Add(10 * time.Second)
+	}
+
+	for range 2 {
+		usage, err := ctrl.Quotas(ctx, userID, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []Quota{
+			{Rule: status[0], Window: time.Minute, Limit: 2, Used: 2, Remaining: 0, ResetAt: now.Add(50 * time.Second)},
+			{Rule: status[1], Window: 24 * time.Hour, Limit: 20, Used: 2, Remaining: 18, ResetAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		}
+		if got := usage.Types[model.NotificationTypeStatus]; len(got) != 2 || got[0] != expected[0] || got[1] != expected[1] {
+			t.Errorf("expected status quotas %+v, got %+v", expected, got)
+		}
+		if got := usage.Types[model.NotificationTypeNews]; len(got) != 1 || got[0].Used != 0 || got[0].Remaining != 1 || !got[0].ResetAt.Equal(now) {
+			t.Errorf("expected the news quota to be unused, got %+v", got)
+		}
+		if got := usage.Global; len(got) != 1 || got[0].Used != 2 || got[0].Remaining != 8 || !got[0].ResetAt.Equal(now.Add(3580*time.Second)) {
+			t.Errorf("expected the global quota to count both sends, got %+v", got)
+		}
+	}
+
+	// Only the given types are read, over the given channel.
+	usage, err := ctrl.Quotas(ctx, userID, model.ChannelInApp, model.NotificationTypeStatus)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quotas, ok := usage.Types[model.NotificationTypeStatus]; len(usage.Types) != 1 || !ok || len(quotas) != 0 {
+		t.Errorf("expected in-app status to be unlimited, got %+v", usage.Types)
+	}
+	if got := usage.Global; len(got) != 1 || got[0].Used != 0 {
+		t.Errorf("expected the in-app global quota to be unused, got %+v", got)
+	}
+
+	if _, err := ctrl.Quotas(ctx, userID, model.ChannelWebhook); !errors.Is(err, ErrUnsupportedChannel) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedChannel, err)
+	}
+	if _, err := ctrl.Quotas(ctx, userID, "", model.NotificationTypeMarketing); !errors.Is(err, ErrUnknowNotificationType) {
+		t.Errorf("expected %v, got %v", ErrUnknowNotificationType, err)
+	}
+}
+
+func TestSend_Quotas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rateLimiter := memory.New(memory.Options{Clock: clock})
+	t.Cleanup(rateLimiter.Close)
+
+	status := config.Rules{
+		{Algorithm: config.AlgorithmGCRA, Burst: 2, Rate: 1, WindowSize: 30},
+		{Limit: 20, Reset: config.ResetDay},
+	}
+	global := config.Rules{{Limit: 10, WindowSize: 3600}}
+	provider := config.NewRLConfigProvider(config.Limits{
+		Global: global,
+		Types:  map[model.NotificationType]config.TypeConfig{model.NotificationTypeStatus: {Rules: status}},
+	})
+	ctrl := NewController(rateLimiter, provider, accept).WithClock(clock)
+	for _, algorithm := range config.Algorithms {
+		ctrl.WithLimiter(algorithm, rateLimiter)
+	}
+
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status"}
+	result, err := ctrl.Send(ctx, n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Quota{
+		{Rule: status[0], Window: time.Minute, Limit: 2, Used: 1, Remaining: 1, ResetAt: now.Add(30 * time.Second)},
+		{Rule: status[1], Window: 24 * time.Hour, Limit: 20, Used: 1, Remaining: 19, ResetAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Rule: global[0], Window: time.Hour, Limit: 10, Used: 1, Remaining: 9, ResetAt: now.Add(time.Hour)},
+	}
+	if len(result.Quotas) != len(expected) || result.Quotas[0] != expected[0] || result.Quotas[1] != expected[1] || result.Quotas[2] != expected[2] {
+		t.Errorf("expected quotas %+v, got %+v", expected, result.Quotas)
+	}
+
+	if _, err := ctrl.Send(ctx, n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The denied send still reports the quotas, without the requests the
+	// other rules gave back.
+	result, err = ctrl.Send(ctx, n)
+	var exceeded *ratelimit.LimitExceededError
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("expected LimitExceededError, got %v", err)
+	}
+	expected = []Quota{
+		{Rule: status[0], Window: time.Minute, Limit: 2, Used: 2, Remaining: 0, ResetAt: now.Add(30 * time.Second)},
+		{Rule: status[1], Window: 24 * time.Hour, Limit: 20, Used: 2, Remaining: 18, ResetAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Rule: global[0], Window: time.Hour, Limit: 10, Used: 2, Remaining: 8, ResetAt: now.Add(time.Hour)},
+	}
+	if len(result.Quotas) != len(expected) || result.Quotas[0] != expected[0] || result.Quotas[1] != expected[1] || result.Quotas[2] != expected[2] {
+		t.Errorf("expected quotas %+v, got %+v", expected, result.Quotas)
+	}
+}
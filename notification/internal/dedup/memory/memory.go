@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired keys are evicted, on the next Remember.
+const sweepInterval = time.Minute
+
+// Store defines an in-process store of recently sent notifications. Keys are
+// not shared between processes nor persisted, so it is only suitable for
+// single-node deployments and tests.
+type Store struct {
+	mu        sync.Mutex
+	expiresAt map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates an empty in-memory dedup store
+func New() *Store {
+	return &Store{expiresAt: make(map[string]time.Time), now: time.Now}
+}
+
+// Remember keeps key for window, reporting false when it already was.
+func (s *Store) Remember(_ context.Context, key string, window time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, expiresAt := range s.expiresAt {
+			if !now.Before(expiresAt) {
+				delete(s.expiresAt, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expiresAt, ok := s.expiresAt[key]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+	s.expiresAt[key] = now.Add(window)
+	return true, nil
+}
+
+// Forget removes key, if kept.
+func (s *Store) Forget(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.expiresAt, key)
+	return nil
+}
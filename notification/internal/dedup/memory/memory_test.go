@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	if first, _ := store.Remember(ctx, "key", time.Minute); !first {
+		t.Fatal("expected the key to be new")
+	}
+	if first, _ := store.Remember(ctx, "key", time.Minute); first {
+		t.Fatal("expected the key to be remembered")
+	}
+	if first, _ := store.Remember(ctx, "other", time.Minute); !first {
+		t.Error("expected another key to be new")
+	}
+
+	// Expired and forgotten keys are new again.
+	now = now.Add(time.Minute)
+	if first, _ := store.Remember(ctx, "key", time.Minute); !first {
+		t.Error("expected the expired key to be new")
+	}
+	store.Forget(ctx, "key")
+	if first, _ := store.Remember(ctx, "key", time.Minute); !first {
+		t.Error("expected the forgotten key to be new")
+	}
+}
+
+func TestStore_SweepsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	store.Remember(ctx, "old", time.Second)
+	now = now.Add(sweepInterval)
+	store.Remember(ctx, "new", time.Hour)
+
+	if _, ok := store.expiresAt["old"]; ok || len(store.expiresAt) != 1 {
+		t.Errorf("expected the expired key to be evicted, got %v", store.expiresAt)
+	}
+}
@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store defines a redis-based store of recently sent notifications, shared by
+// every replica. Each key expires with its window.
+type Store struct {
+	client *redis.Client
+}
+
+// New creates a redis-based dedup store
+func New(client *redis.Client) *Store {
+	return &Store{client}
+}
+
+func dedupKey(key string) string {
+	return "notification:dedup:" + key
+}
+
+// Remember keeps key for window, reporting false when it already was.
+func (s *Store) Remember(ctx context.Context, key string, window time.Duration) (bool, error) {
+	first, err := s.client.SetNX(ctx, dedupKey(key), 1, window).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remember notification: %w", err)
+	}
+	return first, nil
+}
+
+// Forget removes key, if kept.
+func (s *Store) Forget(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, dedupKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to forget notification: %w", err)
+	}
+	return nil
+}
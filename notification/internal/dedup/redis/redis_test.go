@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+)
+
+func TestRemember(t *testing.T) {
+	tests := []struct {
+		name        string
+		set         bool
+		redisErr    error
+		expectErr   bool
+		expectFirst bool
+	}{
+		{name: "New key", set: true, expectFirst: true},
+		{name: "Remembered key", set: false},
+		{name: "Redis returns unexpected error", redisErr: errors.New("connection dropped"), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			store := New(client)
+
+			expect := mock.ExpectSetNX("notification:dedup:key", 1, time.Minute)
+			if tt.redisErr != nil {
+				expect.SetErr(tt.redisErr)
+			} else {
+				expect.SetVal(tt.set)
+			}
+
+			first, err := store.Remember(context.Background(), "key", time.Minute)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if first != tt.expectFirst {
+				t.Errorf("expected %t, got %t", tt.expectFirst, first)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestForget(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	store := New(client)
+
+	mock.ExpectDel("notification:dedup:key").SetVal(1)
+	if err := store.Forget(context.Background(), "key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+)
+
+// Buffer defines an in-memory buffer of digests, for a single node. Buffered
+// digests are lost on restart.
+type Buffer struct {
+	mu      sync.Mutex
+	digests map[digestKey]*pending
+}
+
+type digestKey struct {
+	userID           uuid.UUID
+	notificationType model.NotificationType
+	channel          model.Channel
+}
+
+type pending struct {
+	at     time.Time
+	digest model.Digest
+}
+
+// New creates an in-memory digest buffer
+func New() *Buffer {
+	return &Buffer{digests: map[digestKey]*pending{}}
+}
+
+// Add merges d into the digest of its recipient, notification type and
+// channel, keeping up to maxItems messages. A new digest is due at at, one
+// already buffered keeps its due time.
+func (b *Buffer) Add(_ context.Context, d model.Digest, at time.Time, maxItems int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := digestKey{d.UserID, d.NotificationType, d.Channel}
+	p, ok := b.digests[key]
+	if !ok {
+		p = &pending{at: at, digest: model.Digest{UserID: d.UserID, NotificationType: d.NotificationType, Channel: d.Channel}}
+		b.digests[key] = p
+	}
+
+	p.digest.TimeZone = d.TimeZone
+	p.digest.Count += d.Count
+	for _, msg := range d.Messages {
+		if len(p.digest.Messages) >= maxItems {
+			break
+		}
+		p.digest.Messages = append(p.digest.Messages, msg)
+	}
+	return nil
+}
+
+// Due removes and returns up to limit digests due at now.
+func (b *Buffer) Due(_ context.Context, now time.Time, limit int) ([]model.Digest, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var due []model.Digest
+	for key, p := range b.digests {
+		if len(due) >= limit {
+			break
+		}
+		if p.at.After(now) {
+			continue
+		}
+		due = append(due, p.digest)
+		delete(b.digests, key)
+	}
+	return due, nil
+}
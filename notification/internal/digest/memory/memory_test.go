@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+)
+
+func TestBuffer(t *testing.T) {
+	ctx := context.Background()
+	buffer := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+
+	add := func(message string, at time.Time) {
+		buffer.Add(ctx, model.Digest{
+			UserID:           userID,
+			NotificationType: model.NotificationTypeNews,
+			Messages:         []string{message},
+			Count:            1,
+		}, at, 2)
+	}
+	add("first", now.Add(time.Minute))
+	// Already buffered digests keep their due time.
+	add("second", now.Add(time.Hour))
+	add("third", now.Add(time.Hour))
+
+	if due, _ := buffer.Due(ctx, now, 10); len(due) != 0 {
+		t.Fatalf("expected nothing due yet, got %v", due)
+	}
+
+	due, err := buffer.Due(ctx, now.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("expected a single digest, got %v", due)
+	}
+	if due[0].Count != 3 || !slices.Equal(due[0].Messages, []string{"first", "second"}) {
+		t.Errorf("expected 3 notifications keeping the first 2 messages, got %+v", due[0])
+	}
+
+	// Due digests are gone, the next one starts over.
+	if due, _ := buffer.Due(ctx, now.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected the digest to be removed, got %v", due)
+	}
+	add("fourth", now.Add(2*time.Hour))
+	if due, _ := buffer.Due(ctx, now.Add(2*time.Hour), 10); len(due) != 1 || due[0].Count != 1 {
+		t.Errorf("expected a new digest, got %v", due)
+	}
+
+	// Each channel has a digest of its own.
+	add("fifth", now.Add(3*time.Hour))
+	buffer.Add(ctx, model.Digest{
+		UserID:           userID,
+		NotificationType: model.NotificationTypeNews,
+		Channel:          model.ChannelInApp,
+		Messages:         []string{"sixth"},
+		Count:            1,
+	}, now.Add(3*time.Hour), 2)
+	if due, _ := buffer.Due(ctx, now.Add(3*time.Hour), 10); len(due) != 2 {
+		t.Errorf("expected a digest per channel, got %v", due)
+	}
+}
@@ -0,0 +1,168 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// dueKey is the sorted set of buffered digests, "<userID>:<notificationType>"
+// members, suffixed with ":<channel>" when sent over one, scored by the unix
+// time in milliseconds they are due at.
+const dueKey = "notification:digest:due"
+
+// addLua merges messages into a digest and schedules it, unless it already is.
+//
+// KEYS[1] - due sorted set
+// KEYS[2] - digest hash, holding its "count" and "time_zone"
+// KEYS[3] - digest messages list
+// ARGV[1] - due sorted set member
+// ARGV[2] - due time, in unix milliseconds
+// ARGV[3] - maximum number of messages kept
+// ARGV[4] - count to add
+// ARGV[5] - time zone
+// ARGV[6..] - messages
+const addLua = `
+redis.call('HINCRBY', KEYS[2], 'count', ARGV[4])
+redis.call('HSET', KEYS[2], 'time_zone', ARGV[5])
+for i = 6, #ARGV do
+	if redis.call('LLEN', KEYS[3]) >= tonumber(ARGV[3]) then
+		break
+	end
+	redis.call('RPUSH', KEYS[3], ARGV[i])
+end
+redis.call('ZADD', KEYS[1], 'NX', ARGV[2], ARGV[1])
+return redis.status_reply('OK')
+`
+
+// popDueLua atomically removes and returns the members of the digests due, so
+// several replicas draining them never get the same one.
+//
+// KEYS[1] - due sorted set
+// ARGV[1] - now, in unix milliseconds
+// ARGV[2] - maximum number of digests to pop
+const popDueLua = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+end
+return due
+`
+
+// takeLua atomically reads and deletes a digest.
+//
+// KEYS[1] - digest hash
+// KEYS[2] - digest messages list
+//
+// Returns {count, time zone, messages...}.
+const takeLua = `
+local digest = redis.call('HMGET', KEYS[1], 'count', 'time_zone')
+local messages = redis.call('LRANGE', KEYS[2], 0, -1)
+redis.call('DEL', KEYS[1], KEYS[2])
+
+local reply = {digest[1] or '0', digest[2] or ''}
+for _, msg in ipairs(messages) do
+	table.insert(reply, msg)
+end
+return reply
+`
+
+var (
+	addScript    = redis.NewScript(addLua)
+	popDueScript = redis.NewScript(popDueLua)
+	takeScript   = redis.NewScript(takeLua)
+)
+
+// Buffer defines a redis-based buffer of digests, shared by every replica.
+type Buffer struct {
+	client *redis.Client
+}
+
+// New creates a redis-based digest buffer
+func New(client *redis.Client) *Buffer {
+	return &Buffer{client}
+}
+
+func digestKey(member string) string {
+	return "notification:digest:" + member
+}
+
+func messagesKey(member string) string {
+	return digestKey(member) + ":messages"
+}
+
+// Add merges d into the digest of its recipient, notification type and
+// channel, keeping up to maxItems messages. A new digest is due at at, one
+// already buffered keeps its due time.
+func (b *Buffer) Add(ctx context.Context, d model.Digest, at time.Time, maxItems int) error {
+	member := d.UserID.String() + ":" + string(d.NotificationType)
+	if d.Channel != "" {
+		member += ":" + string(d.Channel)
+	}
+
+	args := []any{member, at.UnixMilli(), maxItems, d.Count, d.TimeZone}
+	for _, msg := range d.Messages {
+		args = append(args, msg)
+	}
+	keys := []string{dueKey, digestKey(member), messagesKey(member)}
+	if err := addScript.Run(ctx, b.client, keys, args...).Err(); err != nil {
+		return fmt.Errorf("failed to add to digest: %w", err)
+	}
+	return nil
+}
+
+// Due removes and returns up to limit digests due at now.
+func (b *Buffer) Due(ctx context.Context, now time.Time, limit int) ([]model.Digest, error) {
+	members, err := popDueScript.Run(ctx, b.client, []string{dueKey}, now.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop due digests: %w", err)
+	}
+
+	due := make([]model.Digest, 0, len(members))
+	for _, member := range members {
+		d, err := b.take(ctx, member)
+		if err != nil {
+			return due, err
+		}
+		// Added to while its previous due time was being drained, so it was
+		// already taken then.
+		if d.Count == 0 {
+			continue
+		}
+		due = append(due, d)
+	}
+	return due, nil
+}
+
+func (b *Buffer) take(ctx context.Context, member string) (model.Digest, error) {
+	rawUserID, rest, _ := strings.Cut(member, ":")
+	notificationType, channel, _ := strings.Cut(rest, ":")
+	userID, err := uuid.Parse(rawUserID)
+	if err != nil {
+		return model.Digest{}, fmt.Errorf("invalid digest %q: %w", member, err)
+	}
+
+	reply, err := takeScript.Run(ctx, b.client, []string{digestKey(member), messagesKey(member)}).StringSlice()
+	if err != nil {
+		return model.Digest{}, fmt.Errorf("failed to take digest: %w", err)
+	}
+	count, err := strconv.Atoi(reply[0])
+	if err != nil {
+		return model.Digest{}, fmt.Errorf("invalid digest count %q: %w", reply[0], err)
+	}
+
+	return model.Digest{
+		UserID:           userID,
+		NotificationType: model.NotificationType(notificationType),
+		TimeZone:         reply[1],
+		Channel:          model.Channel(channel),
+		Messages:         reply[2:],
+		Count:            count,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+)
+
+func TestAdd(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	buffer := New(client)
+
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	member := userID.String() + ":" + string(model.NotificationTypeNews)
+
+	mock.ExpectEvalSha(addScript.Hash(), []string{dueKey, "notification:digest:" + member, "notification:digest:" + member + ":messages"},
+		member, at.UnixMilli(), 5, 2, "Europe/Lisbon", "first", "second").SetVal("OK")
+
+	err := buffer.Add(context.Background(), model.Digest{
+		UserID:           userID,
+		NotificationType: model.NotificationTypeNews,
+		TimeZone:         "Europe/Lisbon",
+		Messages:         []string{"first", "second"},
+		Count:            2,
+	}, at, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	member := userID.String() + ":" + string(model.NotificationTypeNews)
+
+	tests := []struct {
+		name          string
+		members       []any
+		popErr        error
+		take          []any
+		expectErr     bool
+		expectCount   int
+		expectChannel model.Channel
+	}{
+		{
+			name:        "Due digest",
+			members:     []any{member},
+			take:        []any{"3", "Europe/Lisbon", "first", "second"},
+			expectCount: 1,
+		},
+		{
+			name:          "Due digest of a channel",
+			members:       []any{member + ":in-app"},
+			take:          []any{"3", "Europe/Lisbon", "first", "second"},
+			expectCount:   1,
+			expectChannel: model.ChannelInApp,
+		},
+		{
+			name:    "Already taken digest",
+			members: []any{member},
+			take:    []any{"0", ""},
+		},
+		{
+			name:    "Nothing due",
+			members: []any{},
+		},
+		{
+			name:      "Invalid member",
+			members:   []any{"not-a-uuid:news-notification"},
+			expectErr: true,
+		},
+		{
+			name:      "Redis returns unexpected error",
+			popErr:    errors.New("connection dropped"),
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			buffer := New(client)
+
+			pop := mock.ExpectEvalSha(popDueScript.Hash(), []string{dueKey}, now.UnixMilli(), 10)
+			if tt.popErr != nil {
+				pop.SetErr(tt.popErr)
+			} else {
+				pop.SetVal(tt.members)
+			}
+			if tt.take != nil {
+				key := "notification:digest:" + tt.members[0].(string)
+				mock.ExpectEvalSha(takeScript.Hash(), []string{key, key + ":messages"}).SetVal(tt.take)
+			}
+
+			due, err := buffer.Due(context.Background(), now, 10)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(due) != tt.expectCount {
+				t.Fatalf("expected %d digests, got %v", tt.expectCount, due)
+			}
+			if tt.expectCount > 0 {
+				d := due[0]
+				if d.UserID != userID || d.NotificationType != model.NotificationTypeNews || d.TimeZone != "Europe/Lisbon" ||
+					d.Channel != tt.expectChannel || d.Count != 3 || !slices.Equal(d.Messages, []string{"first", "second"}) {
+					t.Errorf("unexpected digest %+v", d)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
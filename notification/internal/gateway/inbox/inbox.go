@@ -0,0 +1,90 @@
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// maxItems is how many notifications an inbox keeps, the oldest ones are
+// dropped beyond it.
+const maxItems = 100
+
+// pushLua atomically adds a notification to an inbox and drops the oldest ones
+// beyond its size.
+//
+// KEYS[1] - inbox list, newest first
+// ARGV[1] - encoded Item
+// ARGV[2] - maximum number of items kept
+const pushLua = `
+redis.call('LPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], 0, tonumber(ARGV[2]) - 1)
+return redis.status_reply('OK')
+`
+
+var pushScript = redis.NewScript(pushLua)
+
+// Item defines a notification delivered to an in-app inbox.
+type Item struct {
+	ID               string                 `json:"id"`
+	NotificationType model.NotificationType `json:"notificationType"`
+	Message          string                 `json:"message"`
+	SentAt           time.Time              `json:"sentAt"`
+}
+
+// Inbox defines a gateway delivering notifications to a redis-based in-app
+// inbox per recipient, keeping their latest 100 notifications.
+type Inbox struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// New creates a redis-based in-app inbox
+func New(client *redis.Client) *Inbox {
+	return &Inbox{client: client, now: time.Now}
+}
+
+func inboxKey(userID uuid.UUID) string {
+	return "notification:inbox:" + userID.String()
+}
+
+// Send adds n to the inbox of its recipient.
+func (i *Inbox) Send(ctx context.Context, n model.Notification) error {
+	data, err := json.Marshal(Item{
+		ID:               uuid.NewString(),
+		NotificationType: n.NotificationType,
+		Message:          n.Message,
+		SentAt:           i.now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode inbox item: %w", err)
+	}
+	if err := pushScript.Run(ctx, i.client, []string{inboxKey(n.UserID)}, data, maxItems).Err(); err != nil {
+		return fmt.Errorf("failed to add to inbox: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit notifications of the inbox of userID, the newest
+// first.
+func (i *Inbox) List(ctx context.Context, userID uuid.UUID, limit int) ([]Item, error) {
+	members, err := i.client.LRange(ctx, inboxKey(userID), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inbox: %w", err)
+	}
+
+	items := make([]Item, 0, len(members))
+	for _, member := range members {
+		var item Item
+		if err := json.Unmarshal([]byte(member), &item); err != nil {
+			return items, fmt.Errorf("failed to decode inbox item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
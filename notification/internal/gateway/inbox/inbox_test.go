@@ -0,0 +1,110 @@
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+)
+
+func TestSend(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	inbox := New(client)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	inbox.now = func() time.Time { return now }
+
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+	key := "notification:inbox:" + n.UserID.String()
+
+	mock.CustomMatch(func(expected, actual []any) error {
+		// EVALSHA sha numkeys key item maxItems
+		if actual[3] != key || actual[5] != maxItems {
+			return fmt.Errorf("unexpected EVALSHA %v", actual)
+		}
+		var item Item
+		if err := json.Unmarshal(actual[4].([]byte), &item); err != nil {
+			return err
+		}
+		if item.ID == "" || item.NotificationType != n.NotificationType || item.Message != n.Message || !item.SentAt.Equal(now) {
+			return fmt.Errorf("unexpected inbox item %+v", item)
+		}
+		return nil
+	}).ExpectEvalSha(pushScript.Hash(), []string{key}, nil, nil).SetVal("OK")
+
+	if err := inbox.Send(context.Background(), n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSend_RedisError(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	inbox := New(client)
+
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+	mock.CustomMatch(func(expected, actual []any) error { return nil }).
+		ExpectEvalSha(pushScript.Hash(), []string{"notification:inbox:" + n.UserID.String()}, nil, nil).
+		SetErr(errors.New("connection dropped"))
+
+	if err := inbox.Send(context.Background(), n); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestList(t *testing.T) {
+	userID := uuid.New()
+	key := "notification:inbox:" + userID.String()
+	item, _ := json.Marshal(Item{ID: uuid.NewString(), NotificationType: model.NotificationTypeNews, Message: "news"})
+
+	tests := []struct {
+		name        string
+		reply       []string
+		redisErr    error
+		expectErr   bool
+		expectCount int
+	}{
+		{name: "Items", reply: []string{string(item), string(item)}, expectCount: 2},
+		{name: "Empty inbox", reply: []string{}},
+		{name: "Invalid item", reply: []string{"not json"}, expectErr: true},
+		{name: "Redis returns unexpected error", redisErr: errors.New("connection dropped"), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			inbox := New(client)
+
+			expect := mock.ExpectLRange(key, 0, 19)
+			if tt.redisErr != nil {
+				expect.SetErr(tt.redisErr)
+			} else {
+				expect.SetVal(tt.reply)
+			}
+
+			items, err := inbox.List(context.Background(), userID, 20)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(items) != tt.expectCount {
+				t.Errorf("expected %d items, got %v", tt.expectCount, items)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
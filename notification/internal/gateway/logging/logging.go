@@ -0,0 +1,25 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// Gateway defines a gateway that logs notifications instead of delivering
+// them, for local development.
+type Gateway struct {
+	logger *slog.Logger
+}
+
+// New creates a logging gateway writing to logger
+func New(logger *slog.Logger) *Gateway {
+	return &Gateway{logger: logger}
+}
+
+// Send logs n, it never fails.
+func (g *Gateway) Send(ctx context.Context, n model.Notification) error {
+	g.logger.InfoContext(ctx, "Message Delivered", "user-id", n.UserID, "notification-type", n.NotificationType, "message", n.Message)
+	return nil
+}
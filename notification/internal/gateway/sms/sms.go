@@ -0,0 +1,33 @@
+package sms
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// maxLength is how many characters fit in a single SMS, longer messages are
+// cut.
+const maxLength = 160
+
+// Gateway defines a stand-in SMS gateway, logging the text messages it would
+// send until a provider is integrated.
+type Gateway struct {
+	logger *slog.Logger
+}
+
+// New creates a stand-in SMS gateway writing to logger
+func New(logger *slog.Logger) *Gateway {
+	return &Gateway{logger: logger}
+}
+
+// Send logs the text message n would be sent as, it never fails.
+func (g *Gateway) Send(ctx context.Context, n model.Notification) error {
+	text := []rune(n.Message)
+	if len(text) > maxLength {
+		text = text[:maxLength]
+	}
+	g.logger.InfoContext(ctx, "SMS Sent", "user-id", n.UserID, "notification-type", n.NotificationType, "text", string(text))
+	return nil
+}
@@ -0,0 +1,128 @@
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// defaultTimeout bounds a whole hand-off when Options.Timeout is not set.
+const defaultTimeout = 10 * time.Second
+
+// Options configures the SMTP gateway.
+type Options struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// From is the sender address of every notification.
+	From string
+	// Domain is the domain recipients get their notifications at: they are
+	// sent to <user-id>@Domain.
+	Domain string
+	// Username and Password, when set, authenticate with PLAIN auth, which
+	// net/smtp only allows over TLS or to localhost.
+	Username string
+	Password string
+	// Timeout bounds a whole hand-off, it defaults to 10s.
+	Timeout time.Duration
+}
+
+// Gateway defines a gateway that hands notifications over to an SMTP server,
+// as plain-text emails whose subject is their notification type. STARTTLS is
+// used whenever the server supports it.
+type Gateway struct {
+	opts Options
+}
+
+// New creates an SMTP gateway
+func New(opts Options) *Gateway {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Gateway{opts: opts}
+}
+
+// Send emails n to its recipient, it fails unless the server accepted it.
+func (g *Gateway) Send(ctx context.Context, n model.Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, g.opts.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", g.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(g.opts.Addr)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	if g.opts.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", g.opts.Username, g.opts.Password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	to := n.UserID.String() + "@" + g.opts.Domain
+	if err := client.Mail(g.opts.From); err != nil {
+		return fmt.Errorf("sender refused: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("recipient refused: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("message refused: %w", err)
+	}
+	if _, err := w.Write(g.message(n, to)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	// The server only accepts the message once it is closed.
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message refused: %w", err)
+	}
+	// The message was accepted, failing now would have it sent again.
+	if err := client.Quit(); err != nil {
+		slog.Warn("failed to quit smtp session after the message was accepted", "addr", g.opts.Addr, "err", err)
+	}
+	return nil
+}
+
+// message builds the email of n sent to to.
+func (g *Gateway) message(n model.Notification, to string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", g.opts.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", n.NotificationType)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(n.Message)
+	return []byte(b.String())
+}
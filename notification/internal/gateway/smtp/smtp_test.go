@@ -0,0 +1,182 @@
+package smtp
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+)
+
+// server is a minimal in-process SMTP server recording the messages it
+// accepts, refusing every recipient when rejectRcpt is set and dropping the
+// connection instead of answering QUIT when dropQuit is set.
+type server struct {
+	addr       string
+	rejectRcpt bool
+	dropQuit   bool
+
+	mu       sync.Mutex
+	messages []email
+}
+
+type email struct {
+	from, to string
+	data     string
+}
+
+func newServer(t *testing.T, rejectRcpt, dropQuit bool) *server {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &server{addr: ln.Addr().String(), rejectRcpt: rejectRcpt, dropQuit: dropQuit}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *server) serve(conn net.Conn) {
+	tc := textproto.NewConn(conn)
+	defer tc.Close()
+
+	var current email
+	tc.PrintfLine("220 localhost ready")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tc.PrintfLine("250 localhost")
+		case "MAIL":
+			current = email{from: arg}
+			tc.PrintfLine("250 OK")
+		case "RCPT":
+			if s.rejectRcpt {
+				tc.PrintfLine("550 no such user")
+				continue
+			}
+			current.to = arg
+			tc.PrintfLine("250 OK")
+		case "DATA":
+			tc.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			if !s.dropQuit {
+				tc.PrintfLine("221 bye")
+			}
+			return
+		default:
+			tc.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *server) received() []email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages
+}
+
+func TestGateway_Send(t *testing.T) {
+	s := newServer(t, false, false)
+	gw := New(Options{Addr: s.addr, From: "notifications@example.com", Domain: "users.example.com"})
+
+	n := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeNews,
+		Message:          "Hello\n.dotted line",
+	}
+	if err := gw.Send(context.Background(), n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	messages := s.received()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	got := messages[0]
+	if got.from != "FROM:<notifications@example.com>" {
+		t.Errorf("unexpected sender %q", got.from)
+	}
+	if to := "TO:<" + n.UserID.String() + "@users.example.com>"; got.to != to {
+		t.Errorf("expected recipient %q, got %q", to, got.to)
+	}
+	if !strings.Contains(got.data, "Subject: news-notification\n") {
+		t.Errorf("expected the notification type as subject, got %q", got.data)
+	}
+	if !strings.HasSuffix(got.data, "\n\nHello\n.dotted line\n") {
+		t.Errorf("expected the message as body, got %q", got.data)
+	}
+}
+
+func TestGateway_Send_QuitFailsAfterData(t *testing.T) {
+	s := newServer(t, false, true)
+	gw := New(Options{Addr: s.addr, From: "notifications@example.com", Domain: "users.example.com"})
+
+	// The server accepted the message: reporting a failure would retry it.
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeNews, Message: "Hello"}
+	if err := gw.Send(context.Background(), n); err != nil {
+		t.Fatalf("expected the accepted message to be sent, got %v", err)
+	}
+	if messages := s.received(); len(messages) != 1 {
+		t.Errorf("expected 1 message, got %d", len(messages))
+	}
+}
+
+func TestGateway_SendErrors(t *testing.T) {
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeNews, Message: "Hello"}
+
+	t.Run("recipient refused", func(t *testing.T) {
+		s := newServer(t, true, false)
+		gw := New(Options{Addr: s.addr, From: "notifications@example.com", Domain: "users.example.com"})
+
+		if err := gw.Send(context.Background(), n); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if messages := s.received(); len(messages) != 0 {
+			t.Errorf("expected no message, got %v", messages)
+		}
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		addr := ln.Addr().String()
+		ln.Close()
+
+		gw := New(Options{Addr: addr, From: "notifications@example.com", Domain: "users.example.com", Timeout: time.Second})
+		if err := gw.Send(context.Background(), n); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// SignatureHeader is the header carrying the signature of signed webhooks.
+const SignatureHeader = "X-Signature-256"
+
+// Options configures the webhook gateway.
+type Options struct {
+	// URL receives every notification, POSTed as JSON.
+	URL string
+	// Secret, when set, signs every body with HMAC-SHA256, sent in
+	// SignatureHeader as "sha256=<hex>".
+	Secret string
+	// Client sends the requests, it defaults to one timing out after 10s.
+	Client *http.Client
+}
+
+// Gateway defines a gateway POSTing notifications to an HTTP webhook.
+type Gateway struct {
+	opts Options
+}
+
+// New creates a webhook gateway
+func New(opts Options) *Gateway {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Gateway{opts: opts}
+}
+
+// Send POSTs n to the webhook, it fails unless the webhook answers with a 2xx.
+func (g *Gateway) Send(ctx context.Context, n model.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.opts.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(g.opts.Secret, body))
+	}
+
+	resp, err := g.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused.
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature of body with secret, as sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+)
+
+func TestGateway_Send(t *testing.T) {
+	n := model.Notification{
+		UserID:           uuid.New(),
+		NotificationType: model.NotificationTypeStatus,
+		Message:          "status update",
+		Channel:          model.ChannelWebhook,
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		status    int
+		expectErr bool
+	}{
+		{name: "Accepted", status: http.StatusNoContent},
+		{name: "Signed", secret: "s3cr3t", status: http.StatusOK},
+		{name: "Refused", status: http.StatusServiceUnavailable, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received model.Notification
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("unexpected request %s %v", r.Method, r.Header)
+				}
+				signature := r.Header.Get(SignatureHeader)
+				if tt.secret == "" && signature != "" {
+					t.Errorf("expected no signature, got %q", signature)
+				}
+				if tt.secret != "" && signature != Sign(tt.secret, body) {
+					t.Errorf("expected the body to be signed, got %q", signature)
+				}
+				json.Unmarshal(body, &received)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			gw := New(Options{URL: server.URL, Secret: tt.secret})
+			err := gw.Send(context.Background(), n)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if received != n {
+				t.Errorf("expected the notification to be posted, got %+v", received)
+			}
+		})
+	}
+}
+
+func TestGateway_SendUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	gw := New(Options{URL: server.URL})
+	if err := gw.Send(context.Background(), model.Notification{UserID: uuid.New()}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
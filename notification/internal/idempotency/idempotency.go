@@ -0,0 +1,36 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Record defines what is kept under an idempotency key: the fingerprint of
+// the request that claimed it and, once it was handled, its response.
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Done reports whether the request that claimed the key was handled, i.e.
+// whether the Record holds its response.
+func (r Record) Done() bool {
+	return r.Status != 0
+}
+
+// Store defines where idempotency keys are kept.
+type Store interface {
+	// Claim keeps rec under key for ttl unless another Record already is,
+	// which it then returns along with false.
+	Claim(ctx context.Context, key string, rec Record, ttl time.Duration) (Record, bool, error)
+	// Renew keeps the Record under key for ttl from now, if there still is
+	// one, so a request outliving its claim keeps it.
+	Renew(ctx context.Context, key string, ttl time.Duration) error
+	// Save replaces the Record under key, keeping it for ttl.
+	Save(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release removes the Record under key, if any.
+	Release(ctx context.Context, key string) error
+}
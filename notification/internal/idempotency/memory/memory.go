@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+)
+
+// sweepInterval is how often expired keys are evicted, on the next Claim.
+const sweepInterval = time.Minute
+
+// Store defines an in-process idempotency.Store. Keys are not shared between
+// processes nor persisted, so it is only suitable for single-node deployments
+// and tests.
+type Store struct {
+	mu        sync.Mutex
+	records   map[string]entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	expiresAt time.Time
+	record    idempotency.Record
+}
+
+// New creates an empty in-memory idempotency store
+func New() *Store {
+	return &Store{records: make(map[string]entry), now: time.Now}
+}
+
+// Claim keeps rec under key for ttl unless another Record already is, which
+// it then returns along with false.
+func (s *Store) Claim(_ context.Context, key string, rec idempotency.Record, ttl time.Duration) (idempotency.Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, e := range s.records {
+			if !now.Before(e.expiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if e, ok := s.records[key]; ok && now.Before(e.expiresAt) {
+		return e.record, false, nil
+	}
+	s.records[key] = entry{now.Add(ttl), rec}
+	return rec, true, nil
+}
+
+// Renew keeps the Record under key for ttl from now, if there still is one.
+func (s *Store) Renew(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, ok := s.records[key]; ok && now.Before(e.expiresAt) {
+		e.expiresAt = now.Add(ttl)
+		s.records[key] = e
+	}
+	return nil
+}
+
+// Save replaces the Record under key, keeping it for ttl.
+func (s *Store) Save(_ context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = entry{s.now().Add(ttl), rec}
+	return nil
+}
+
+// Release removes the Record under key, if any.
+func (s *Store) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
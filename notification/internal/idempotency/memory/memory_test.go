@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	pending := idempotency.Record{Fingerprint: "abc"}
+	if _, claimed, _ := store.Claim(ctx, "key", pending, time.Hour); !claimed {
+		t.Fatal("expected the key to be claimed")
+	}
+	if rec, claimed, _ := store.Claim(ctx, "key", pending, time.Hour); claimed || rec.Done() {
+		t.Fatalf("expected the key to be in progress, got %+v, %t", rec, claimed)
+	}
+
+	done := idempotency.Record{Fingerprint: "abc", Status: http.StatusCreated, Body: []byte(`{}`)}
+	store.Save(ctx, "key", done, time.Hour)
+	if rec, claimed, _ := store.Claim(ctx, "key", pending, time.Hour); claimed || rec.Status != http.StatusCreated {
+		t.Fatalf("expected the saved response, got %+v, %t", rec, claimed)
+	}
+
+	// Expired and released keys can be claimed again.
+	now = now.Add(time.Hour)
+	if _, claimed, _ := store.Claim(ctx, "key", pending, time.Hour); !claimed {
+		t.Error("expected the expired key to be claimed")
+	}
+	store.Release(ctx, "key")
+	if _, claimed, _ := store.Claim(ctx, "key", pending, time.Hour); !claimed {
+		t.Error("expected the released key to be claimed")
+	}
+}
+
+func TestStore_Renew(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	pending := idempotency.Record{Fingerprint: "abc"}
+	store.Claim(ctx, "key", pending, time.Minute)
+	now = now.Add(50 * time.Second)
+	store.Renew(ctx, "key", time.Minute)
+
+	now = now.Add(50 * time.Second)
+	if _, claimed, _ := store.Claim(ctx, "key", pending, time.Minute); claimed {
+		t.Error("expected the renewed key to still be claimed")
+	}
+
+	// Renewing an expired or released key does not claim it again.
+	now = now.Add(time.Minute)
+	store.Renew(ctx, "key", time.Minute)
+	if _, claimed, _ := store.Claim(ctx, "key", pending, time.Minute); !claimed {
+		t.Error("expected the expired key to be claimed")
+	}
+	store.Release(ctx, "key")
+	store.Renew(ctx, "key", time.Minute)
+	if _, ok := store.records["key"]; ok {
+		t.Errorf("expected the released key to stay released, got %+v", store.records["key"])
+	}
+}
+
+func TestStore_SweepsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	store.Claim(ctx, "old", idempotency.Record{}, time.Second)
+	now = now.Add(sweepInterval)
+	store.Claim(ctx, "new", idempotency.Record{}, time.Hour)
+
+	if _, ok := store.records["old"]; ok || len(store.records) != 1 {
+		t.Errorf("expected the expired key to be evicted, got %v", store.records)
+	}
+}
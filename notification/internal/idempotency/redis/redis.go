@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+	"github.com/redis/go-redis/v9"
+)
+
+// claimLua atomically keeps a record under a key unless one already is, so
+// concurrent duplicates never both claim it.
+//
+// KEYS[1] - idempotency key
+// ARGV[1] - encoded record
+// ARGV[2] - ttl, in milliseconds
+//
+// Returns nil when claimed, else the record already kept.
+const claimLua = `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return nil
+end
+return redis.call('GET', KEYS[1])
+`
+
+var claimScript = redis.NewScript(claimLua)
+
+// Store defines a redis-based idempotency.Store, shared by every replica. Each
+// key holds its JSON encoded idempotency.Record, expiring with it.
+type Store struct {
+	client *redis.Client
+}
+
+// New creates a redis-based idempotency store
+func New(client *redis.Client) *Store {
+	return &Store{client}
+}
+
+func idempotencyKey(key string) string {
+	return "notification:idempotency:" + key
+}
+
+// Claim keeps rec under key for ttl unless another Record already is, which
+// it then returns along with false.
+func (s *Store) Claim(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) (idempotency.Record, bool, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return idempotency.Record{}, false, fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	existing, err := claimScript.Run(ctx, s.client, []string{idempotencyKey(key)}, data, ttl.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return rec, true, nil
+	}
+	if err != nil {
+		return idempotency.Record{}, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	var kept idempotency.Record
+	if err := json.Unmarshal([]byte(existing), &kept); err != nil {
+		return idempotency.Record{}, false, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+	return kept, false, nil
+}
+
+// Renew keeps the Record under key for ttl from now, if there still is one.
+func (s *Store) Renew(ctx context.Context, key string, ttl time.Duration) error {
+	if err := s.client.PExpire(ctx, idempotencyKey(key), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to renew idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Save replaces the Record under key, keeping it for ttl.
+func (s *Store) Save(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+	if err := s.client.Set(ctx, idempotencyKey(key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotency record: %w", err)
+	}
+	return nil
+}
+
+// Release removes the Record under key, if any.
+func (s *Store) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, idempotencyKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/idempotency"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestClaim(t *testing.T) {
+	pending := idempotency.Record{Fingerprint: "abc"}
+	pendingData, _ := json.Marshal(pending)
+	done := idempotency.Record{Fingerprint: "abc", Status: http.StatusCreated, Body: []byte(`{"message":"Message Sent"}`)}
+	doneData, _ := json.Marshal(done)
+
+	tests := []struct {
+		name          string
+		reply         string
+		redisErr      error
+		expectErr     bool
+		expectClaimed bool
+		expectStatus  int
+	}{
+		{name: "Claimed", redisErr: redis.Nil, expectClaimed: true},
+		{name: "In progress", reply: string(pendingData)},
+		{name: "Done", reply: string(doneData), expectStatus: http.StatusCreated},
+		{name: "Invalid record", reply: "not json", expectErr: true},
+		{name: "Redis returns unexpected error", redisErr: errors.New("connection dropped"), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			store := New(client)
+
+			expect := mock.ExpectEvalSha(claimScript.Hash(), []string{"notification:idempotency:key"}, pendingData, int64(60000))
+			if tt.redisErr != nil {
+				expect.SetErr(tt.redisErr)
+			} else {
+				expect.SetVal(tt.reply)
+			}
+
+			rec, claimed, err := store.Claim(context.Background(), "key", pending, time.Minute)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claimed != tt.expectClaimed || rec.Fingerprint != "abc" || rec.Status != tt.expectStatus {
+				t.Errorf("unexpected record %+v, claimed %t", rec, claimed)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRenewSaveAndRelease(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	store := New(client)
+
+	done := idempotency.Record{Fingerprint: "abc", Status: http.StatusCreated}
+	data, _ := json.Marshal(done)
+	mock.ExpectPExpire("notification:idempotency:key", time.Minute).SetVal(true)
+	mock.ExpectSet("notification:idempotency:key", data, time.Minute).SetVal("OK")
+	mock.ExpectDel("notification:idempotency:key").SetVal(1)
+
+	if err := store.Renew(context.Background(), "key", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Save(context.Background(), "key", done, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Release(context.Background(), "key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// Store defines an in-process config.OverrideStore. Overrides are not shared
+// between processes nor persisted, so it is only suitable for single-node
+// deployments and tests.
+type Store struct {
+	mu        sync.RWMutex
+	overrides map[string]map[model.NotificationType]config.Override
+}
+
+// New creates an empty in-memory override store
+func New() *Store {
+	return &Store{overrides: make(map[string]map[model.NotificationType]config.Override)}
+}
+
+// GetOverride gets the override of userID for a notification type.
+func (s *Store) GetOverride(_ context.Context, userID string, t model.NotificationType) (config.Override, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.overrides[userID][t]
+	return o, ok, nil
+}
+
+// ListOverrides gets every override of userID.
+func (s *Store) ListOverrides(_ context.Context, userID string) (map[model.NotificationType]config.Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	overrides := make(map[model.NotificationType]config.Override, len(s.overrides[userID]))
+	maps.Copy(overrides, s.overrides[userID])
+	return overrides, nil
+}
+
+// SetOverride creates or replaces the override of userID for a notification
+// type.
+func (s *Store) SetOverride(_ context.Context, userID string, t model.NotificationType, o config.Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.overrides[userID] == nil {
+		s.overrides[userID] = make(map[model.NotificationType]config.Override)
+	}
+	s.overrides[userID][t] = o
+	return nil
+}
+
+// DeleteOverride removes the override of userID for a notification type, if
+// any.
+func (s *Store) DeleteOverride(_ context.Context, userID string, t model.NotificationType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.overrides[userID], t)
+	if len(s.overrides[userID]) == 0 {
+		delete(s.overrides, userID)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+
+	if _, found, _ := store.GetOverride(ctx, "user-1", model.NotificationTypeStatus); found {
+		t.Fatal("expected no override in an empty store")
+	}
+
+	status := config.Override{Rules: config.Rules{{Limit: 10, WindowSize: 60}}}
+	store.SetOverride(ctx, "user-1", model.NotificationTypeStatus, status)
+	store.SetOverride(ctx, "user-1", model.NotificationTypeNews, config.Override{Unlimited: true})
+
+	o, found, err := store.GetOverride(ctx, "user-1", model.NotificationTypeStatus)
+	if err != nil || !found || o.Rules[0].Limit != 10 {
+		t.Errorf("expected the status override, got %+v (found: %v, err: %v)", o, found, err)
+	}
+	if _, found, _ := store.GetOverride(ctx, "user-2", model.NotificationTypeStatus); found {
+		t.Error("expected overrides to be per recipient")
+	}
+
+	overrides, _ := store.ListOverrides(ctx, "user-1")
+	if len(overrides) != 2 {
+		t.Errorf("expected 2 overrides, got %v", overrides)
+	}
+
+	// The listed map is a copy.
+	delete(overrides, model.NotificationTypeNews)
+	store.DeleteOverride(ctx, "user-1", model.NotificationTypeStatus)
+	overrides, _ = store.ListOverrides(ctx, "user-1")
+	if len(overrides) != 1 || !overrides[model.NotificationTypeNews].Unlimited {
+		t.Errorf("expected only the news override to remain, got %v", overrides)
+	}
+}
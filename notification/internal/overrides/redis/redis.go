@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store defines a redis-based config.OverrideStore. Every recipient overrides
+// live in a single hash, one JSON encoded config.Override per notification
+// type, so they can be listed in a single round trip.
+type Store struct {
+	client *redis.Client
+}
+
+// New creates a redis-based override store
+func New(client *redis.Client) *Store {
+	return &Store{client}
+}
+
+func overridesKey(userID string) string {
+	return "rate_limit:overrides:" + userID
+}
+
+// GetOverride gets the override of userID for a notification type.
+func (s *Store) GetOverride(ctx context.Context, userID string, t model.NotificationType) (config.Override, bool, error) {
+	data, err := s.client.HGet(ctx, overridesKey(userID), string(t)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return config.Override{}, false, nil
+	}
+	if err != nil {
+		return config.Override{}, false, fmt.Errorf("failed to get override: %w", err)
+	}
+
+	var o config.Override
+	if err := json.Unmarshal(data, &o); err != nil {
+		return config.Override{}, false, fmt.Errorf("failed to decode override: %w", err)
+	}
+	return o, true, nil
+}
+
+// ListOverrides gets every override of userID.
+func (s *Store) ListOverrides(ctx context.Context, userID string) (map[model.NotificationType]config.Override, error) {
+	fields, err := s.client.HGetAll(ctx, overridesKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list overrides: %w", err)
+	}
+
+	overrides := make(map[model.NotificationType]config.Override, len(fields))
+	for t, data := range fields {
+		var o config.Override
+		if err := json.Unmarshal([]byte(data), &o); err != nil {
+			return nil, fmt.Errorf("failed to decode override of %s: %w", t, err)
+		}
+		overrides[model.NotificationType(t)] = o
+	}
+	return overrides, nil
+}
+
+// SetOverride creates or replaces the override of userID for a notification
+// type.
+func (s *Store) SetOverride(ctx context.Context, userID string, t model.NotificationType, o config.Override) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("failed to encode override: %w", err)
+	}
+	if err := s.client.HSet(ctx, overridesKey(userID), string(t), data).Err(); err != nil {
+		return fmt.Errorf("failed to set override: %w", err)
+	}
+	return nil
+}
+
+// DeleteOverride removes the override of userID for a notification type, if
+// any.
+func (s *Store) DeleteOverride(ctx context.Context, userID string, t model.NotificationType) error {
+	if err := s.client.HDel(ctx, overridesKey(userID), string(t)).Err(); err != nil {
+		return fmt.Errorf("failed to delete override: %w", err)
+	}
+	return nil
+}
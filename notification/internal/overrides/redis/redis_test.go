@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/go-redis/redismock/v9"
+)
+
+const userID = "968af933-64e3-4890-bd3c-50158bdadf0c"
+
+func TestGetOverride(t *testing.T) {
+	ctx := context.Background()
+	key := "rate_limit:overrides:" + userID
+
+	tests := []struct {
+		name        string
+		reply       string
+		redisNil    bool
+		redisErr    error
+		expectFound bool
+		expectErr   bool
+		expectLimit int
+	}{
+		{
+			name:        "Override exists",
+			reply:       `{"rules":[{"limit":10,"window_size":60}]}`,
+			expectFound: true,
+			expectLimit: 10,
+		},
+		{
+			name:     "No override",
+			redisNil: true,
+		},
+		{
+			name:      "Corrupted override",
+			reply:     `{"rules":`,
+			expectErr: true,
+		},
+		{
+			name:      "Redis returns unexpected error",
+			redisErr:  errors.New("connection dropped"),
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			store := New(client)
+
+			expect := mock.ExpectHGet(key, string(model.NotificationTypeStatus))
+			switch {
+			case tt.redisNil:
+				expect.RedisNil()
+			case tt.redisErr != nil:
+				expect.SetErr(tt.redisErr)
+			default:
+				expect.SetVal(tt.reply)
+			}
+
+			o, found, err := store.GetOverride(ctx, userID, model.NotificationTypeStatus)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error = %v, got %v", tt.expectErr, err)
+			}
+			if found != tt.expectFound {
+				t.Errorf("expected found = %v, got %v", tt.expectFound, found)
+			}
+			if tt.expectFound && o.Rules[0].Limit != tt.expectLimit {
+				t.Errorf("expected limit %d, got %+v", tt.expectLimit, o)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestListOverrides(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	store := New(client)
+
+	mock.ExpectHGetAll("rate_limit:overrides:" + userID).SetVal(map[string]string{
+		string(model.NotificationTypeStatus): `{"rules":[{"limit":10,"window_size":60}]}`,
+		string(model.NotificationTypeNews):   `{"unlimited":true}`,
+	})
+
+	overrides, err := store.ListOverrides(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(overrides) != 2 {
+		t.Fatalf("expected 2 overrides, got %v", overrides)
+	}
+	if !overrides[model.NotificationTypeNews].Unlimited {
+		t.Errorf("expected news override to be unlimited, got %+v", overrides[model.NotificationTypeNews])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetAndDeleteOverride(t *testing.T) {
+	ctx := context.Background()
+	key := "rate_limit:overrides:" + userID
+	client, mock := redismock.NewClientMock()
+	store := New(client)
+
+	mock.ExpectHSet(key, string(model.NotificationTypeStatus), []byte(`{"rules":[{"limit":10,"window_size":60}]}`)).SetVal(1)
+	mock.ExpectHDel(key, string(model.NotificationTypeStatus)).SetVal(1)
+	mock.ExpectHDel(key, string(model.NotificationTypeNews)).SetErr(errors.New("connection dropped"))
+
+	o := config.Override{Rules: config.Rules{{Limit: 10, WindowSize: 60}}}
+	if err := store.SetOverride(ctx, userID, model.NotificationTypeStatus, o); err != nil {
+		t.Errorf("unexpected set error: %v", err)
+	}
+	if err := store.DeleteOverride(ctx, userID, model.NotificationTypeStatus); err != nil {
+		t.Errorf("unexpected delete error: %v", err)
+	}
+	if err := store.DeleteOverride(ctx, userID, model.NotificationTypeNews); err == nil {
+		t.Error("expected delete error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
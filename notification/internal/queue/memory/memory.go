@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+// Queue defines an in-memory queue of deferred notifications, for a single
+// node. Queued notifications are lost on restart.
+type Queue struct {
+	mu      sync.Mutex
+	entries []entry // sorted by at
+}
+
+type entry struct {
+	at           time.Time
+	notification model.Notification
+}
+
+// New creates an in-memory deferred notification queue
+func New() *Queue {
+	return &Queue{}
+}
+
+// Enqueue defers n until at.
+func (q *Queue) Enqueue(_ context.Context, n model.Notification, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// After the entries due at the same time, so they keep their order.
+	i, _ := slices.BinarySearchFunc(q.entries, at, func(e entry, at time.Time) int {
+		if e.at.After(at) {
+			return 1
+		}
+		return -1
+	})
+	q.entries = slices.Insert(q.entries, i, entry{at, n})
+	return nil
+}
+
+// Due removes and returns up to limit notifications due at now, the earliest
+// first.
+func (q *Queue) Due(_ context.Context, now time.Time, limit int) ([]model.Notification, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []model.Notification
+	for len(q.entries) > 0 && len(due) < limit && !q.entries[0].at.After(now) {
+		due = append(due, q.entries[0].notification)
+		q.entries = q.entries[1:]
+	}
+	return due, nil
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	queue := New()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	notification := func(message string) model.Notification {
+		return model.Notification{NotificationType: model.NotificationTypeStatus, Message: message}
+	}
+	queue.Enqueue(ctx, notification("third"), now.Add(2*time.Minute))
+	queue.Enqueue(ctx, notification("first"), now.Add(time.Minute))
+	queue.Enqueue(ctx, notification("second"), now.Add(time.Minute))
+	queue.Enqueue(ctx, notification("fourth"), now.Add(time.Hour))
+
+	if due, _ := queue.Due(ctx, now, 10); len(due) != 0 {
+		t.Fatalf("expected nothing due yet, got %v", due)
+	}
+
+	due, err := queue.Due(ctx, now.Add(2*time.Minute), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(due) != 2 || due[0].Message != "first" || due[1].Message != "second" {
+		t.Errorf("expected the first 2 due notifications in order, got %v", due)
+	}
+
+	due, _ = queue.Due(ctx, now.Add(2*time.Minute), 10)
+	if len(due) != 1 || due[0].Message != "third" {
+		t.Errorf("expected the remaining due notification, got %v", due)
+	}
+
+	// Popped notifications are gone.
+	due, _ = queue.Due(ctx, now.Add(24*time.Hour), 10)
+	if len(due) != 1 || due[0].Message != "fourth" {
+		t.Errorf("expected only the last notification to remain, got %v", due)
+	}
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// queueKey is the sorted set of deferred notifications, scored by the unix
+// time in milliseconds they are due at.
+const queueKey = "notification:deferred"
+
+// popDueLua atomically removes and returns the notifications due, so several
+// replicas draining the queue never get the same one.
+//
+// KEYS[1] - queue sorted set
+// ARGV[1] - now, in unix milliseconds
+// ARGV[2] - maximum number of notifications to pop
+const popDueLua = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+end
+return due
+`
+
+var popDueScript = redis.NewScript(popDueLua)
+
+// Queue defines a redis-based queue of deferred notifications, shared by
+// every replica.
+type Queue struct {
+	client *redis.Client
+}
+
+// New creates a redis-based deferred notification queue
+func New(client *redis.Client) *Queue {
+	return &Queue{client}
+}
+
+// entry is a queued notification. Its ID keeps identical notifications apart
+// in the sorted set.
+type entry struct {
+	ID           string             `json:"id"`
+	Notification model.Notification `json:"notification"`
+}
+
+// Enqueue defers n until at.
+func (q *Queue) Enqueue(ctx context.Context, n model.Notification, at time.Time) error {
+	data, err := json.Marshal(entry{uuid.NewString(), n})
+	if err != nil {
+		return fmt.Errorf("failed to encode deferred notification: %w", err)
+	}
+	if err := q.client.ZAdd(ctx, queueKey, redis.Z{Score: float64(at.UnixMilli()), Member: data}).Err(); err != nil {
+		return fmt.Errorf("failed to defer notification: %w", err)
+	}
+	return nil
+}
+
+// Due removes and returns up to limit notifications due at now, the earliest
+// first.
+func (q *Queue) Due(ctx context.Context, now time.Time, limit int) ([]model.Notification, error) {
+	members, err := popDueScript.Run(ctx, q.client, []string{queueKey}, now.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop deferred notifications: %w", err)
+	}
+
+	due := make([]model.Notification, 0, len(members))
+	for _, member := range members {
+		var e entry
+		if err := json.Unmarshal([]byte(member), &e); err != nil {
+			return due, fmt.Errorf("failed to decode deferred notification: %w", err)
+		}
+		due = append(due, e.Notification)
+	}
+	return due, nil
+}
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestEnqueue(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	queue := New(client)
+
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+
+	mock.CustomMatch(func(expected, actual []any) error {
+		// ZADD key score member
+		if actual[1] != queueKey || actual[2] != float64(at.UnixMilli()) {
+			return fmt.Errorf("unexpected ZADD %v", actual)
+		}
+		var e entry
+		if err := json.Unmarshal(actual[3].([]byte), &e); err != nil {
+			return err
+		}
+		if e.ID == "" || e.Notification != n {
+			return fmt.Errorf("unexpected queued entry %+v", e)
+		}
+		return nil
+	}).ExpectZAdd(queueKey, redis.Z{}).SetVal(1)
+
+	if err := queue.Enqueue(context.Background(), n, at); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	n := model.Notification{UserID: uuid.New(), NotificationType: model.NotificationTypeStatus, Message: "status update"}
+	member, _ := json.Marshal(entry{uuid.NewString(), n})
+
+	tests := []struct {
+		name        string
+		reply       []any
+		redisErr    error
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:        "Due notifications",
+			reply:       []any{string(member), string(member)},
+			expectCount: 2,
+		},
+		{
+			name:  "Nothing due",
+			reply: []any{},
+		},
+		{
+			name:      "Corrupted notification",
+			reply:     []any{`{"id":`},
+			expectErr: true,
+		},
+		{
+			name:      "Redis returns unexpected error",
+			redisErr:  errors.New("connection dropped"),
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			queue := New(client)
+
+			expect := mock.ExpectEvalSha(popDueScript.Hash(), []string{queueKey}, now.UnixMilli(), 10)
+			if tt.redisErr != nil {
+				expect.SetErr(tt.redisErr)
+			} else {
+				expect.SetVal(tt.reply)
+			}
+
+			due, err := queue.Due(context.Background(), now, 10)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(due) != tt.expectCount {
+				t.Fatalf("expected %d notifications, got %d", tt.expectCount, len(due))
+			}
+			for _, got := range due {
+				if got != n {
+					t.Errorf("expected %+v, got %+v", n, got)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+)
+
+const (
+	defaultShards          = 32
+	defaultCleanupInterval = time.Minute
+)
+
+// Options defines the tunables of an in-memory RateLimiter. Zero values fall
+// back to sensible defaults.
+type Options struct {
+	// Shards is the number of independently locked maps keys are spread over.
+	Shards int
+	// CleanupInterval is how often idle keys are evicted in the background.
+	CleanupInterval time.Duration
+	// Clock returns the current time, defaults to time.Now.
+	Clock func() time.Time
+}
+
+// RateLimiter defines an in-process rate-limiter implementing every
+// config.Algorithm. State is not shared between processes, so it is only
+// suitable for single-node deployments and tests.
+type RateLimiter struct {
+	shards []*shard
+	now    func() time.Time
+	stop   chan struct{}
+	once   sync.Once
+}
+
+type shard struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// entry holds the state of a single key for whichever algorithm owns it.
+type entry struct {
+	expiresAt time.Time
+
+	// fixed_window
+	count int
+	// sliding_log
+	log []time.Time
+	// sliding_window_counter
+	bucket     int64
+	curr, prev int
+	// gcra
+	tat time.Time
+}
+
+// New creates an in-memory rate-limiter and starts its background eviction of
+// idle keys. Close must be called to stop it.
+func New(opts Options) *RateLimiter {
+	if opts.Shards <= 0 {
+		opts.Shards = defaultShards
+	}
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = defaultCleanupInterval
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	rl := &RateLimiter{
+		shards: make([]*shard, opts.Shards),
+		now:    opts.Clock,
+		stop:   make(chan struct{}),
+	}
+	for i := range rl.shards {
+		rl.shards[i] = &shard{entries: make(map[string]*entry)}
+	}
+
+	go rl.cleanup(opts.CleanupInterval)
+	return rl
+}
+
+// Close stops the background eviction of idle keys.
+func (rl *RateLimiter) Close() {
+	rl.once.Do(func() { close(rl.stop) })
+}
+
+// IsAllowed checks and consumes one request from the key using cfg's
+// algorithm, returning the Usage left. When the limit is reached it returns a
+// ratelimit.LimitExceededError carrying the time until a request is accepted.
+func (rl *RateLimiter) IsAllowed(_ context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error) {
+	algorithm := cfg.GetAlgorithm()
+	if !slices.Contains(config.Algorithms, algorithm) {
+		return ratelimit.Decision{}, fmt.Errorf("unsupported rate-limiting algorithm %q", algorithm)
+	}
+	key = string(algorithm) + ":" + key
+
+	s := rl.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := rl.now()
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = &entry{}
+		s.entries[key] = e
+	}
+
+	return e.take(now, cfg)
+}
+
+// IsAllowedAll checks the rules of each request, keys[i][j] against
+// cfgs[i][j]. A request is only counted when every one of its rules allows
+// it, atomically: it then consumes one from all of them, else from none.
+// Requests are counted in order.
+//
+// It returns the Decision and the error of each rule. The rules that allowed a
+// denied request report the Usage it would have left.
+func (rl *RateLimiter) IsAllowedAll(_ context.Context, keys [][]string, cfgs [][]config.RLConfig) ([][]ratelimit.Decision, [][]error) {
+	decisions := make([][]ratelimit.Decision, len(keys))
+	errs := make([][]error, len(keys))
+	for i := range keys {
+		decisions[i], errs[i] = rl.isAllowedAll(keys[i], cfgs[i])
+	}
+	return decisions, errs
+}
+
+// isAllowedAll is IsAllowedAll for a single request. Every shard its keys
+// live in is locked while it is counted, in order so concurrent requests
+// cannot deadlock, and its rules are checked against copies of their entries,
+// only stored once all of them allowed.
+func (rl *RateLimiter) isAllowedAll(keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error) {
+	decisions := make([]ratelimit.Decision, len(keys))
+	errs := make([]error, len(keys))
+
+	prefixed := make([]string, len(keys))
+	var indexes []int
+	for i, key := range keys {
+		algorithm := cfgs[i].GetAlgorithm()
+		if !slices.Contains(config.Algorithms, algorithm) {
+			for j := range errs {
+				errs[j] = fmt.Errorf("unsupported rate-limiting algorithm %q", algorithm)
+			}
+			return decisions, errs
+		}
+		prefixed[i] = string(algorithm) + ":" + key
+		indexes = append(indexes, rl.shardIndex(prefixed[i]))
+	}
+	slices.Sort(indexes)
+	for _, i := range slices.Compact(indexes) {
+		rl.shards[i].mu.Lock()
+		defer rl.shards[i].mu.Unlock()
+	}
+
+	now := rl.now()
+	taken := make([]*entry, len(keys))
+	allowed := true
+	for i, key := range prefixed {
+		e := &entry{}
+		if stored, ok := rl.shardFor(key).entries[key]; ok && now.Before(stored.expiresAt) {
+			clone := *stored
+			clone.log = slices.Clone(stored.log)
+			e = &clone
+		}
+		decisions[i], errs[i] = e.take(now, cfgs[i])
+		allowed = allowed && decisions[i].Allowed
+		taken[i] = e
+	}
+	if allowed {
+		for i, key := range prefixed {
+			rl.shardFor(key).entries[key] = taken[i]
+		}
+	}
+	return decisions, errs
+}
+
+// take checks and consumes one request from the entry using cfg's algorithm,
+// which must be supported, as described by IsAllowed.
+func (e *entry) take(now time.Time, cfg config.RLConfig) (ratelimit.Decision, error) {
+	var retryAfter time.Duration
+	switch cfg.GetAlgorithm() {
+	case config.AlgorithmFixedWindow:
+		retryAfter = e.fixedWindow(now, cfg)
+	case config.AlgorithmSlidingLog:
+		retryAfter = e.slidingLog(now, cfg)
+	case config.AlgorithmSlidingCounter:
+		retryAfter = e.slidingCounter(now, cfg)
+	case config.AlgorithmGCRA:
+		retryAfter = e.gcra(now, cfg)
+	}
+
+	if retryAfter > 0 {
+		return ratelimit.Deny(limitOf(cfg), retryAfter), ratelimit.NewLimitExceededError(retryAfter, "rate limit exceeded")
+	}
+	return ratelimit.Allow(e.usage(now, cfg)), nil
+}
+
+// Refund gives back a request previously consumed by IsAllowed for key.
+func (rl *RateLimiter) Refund(_ context.Context, key string, cfg config.RLConfig) error {
+	algorithm := cfg.GetAlgorithm()
+	key = string(algorithm) + ":" + key
+
+	s := rl.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !rl.now().Before(e.expiresAt) {
+		return nil
+	}
+
+	switch algorithm {
+	case config.AlgorithmFixedWindow:
+		e.count = max(e.count-1, 0)
+	case config.AlgorithmSlidingLog:
+		if len(e.log) > 0 {
+			e.log = e.log[:len(e.log)-1]
+		}
+	case config.AlgorithmSlidingCounter:
+		e.curr = max(e.curr-1, 0)
+	case config.AlgorithmGCRA:
+		e.tat = e.tat.Add(-cfg.EmissionInterval())
+		e.expiresAt = e.tat
+	default:
+		return fmt.Errorf("unsupported rate-limiting algorithm %q", algorithm)
+	}
+	return nil
+}
+
+// Peek returns how much of cfg the key used, without consuming anything.
+func (rl *RateLimiter) Peek(_ context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+	algorithm := cfg.GetAlgorithm()
+	if !slices.Contains(config.Algorithms, algorithm) {
+		return ratelimit.Usage{}, fmt.Errorf("unsupported rate-limiting algorithm %q", algorithm)
+	}
+	key = string(algorithm) + ":" + key
+
+	s := rl.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := rl.now()
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = &entry{}
+	}
+	return e.usage(now, cfg), nil
+}
+
+// limitOf returns how many requests cfg allows at once.
+func limitOf(cfg config.RLConfig) int {
+	if cfg.GetAlgorithm() == config.AlgorithmGCRA {
+		return cfg.Burst
+	}
+	return cfg.Limit
+}
+
+// usage reads how much of cfg the entry used at now, whose algorithm must be
+// supported.
+func (e *entry) usage(now time.Time, cfg config.RLConfig) ratelimit.Usage {
+	switch cfg.GetAlgorithm() {
+	case config.AlgorithmSlidingLog:
+		return e.peekSlidingLog(now, cfg)
+	case config.AlgorithmSlidingCounter:
+		return e.peekSlidingCounter(now, cfg)
+	case config.AlgorithmGCRA:
+		return e.peekGCRA(now, cfg)
+	}
+
+	var resetAfter time.Duration
+	if e.count > 0 {
+		resetAfter = e.expiresAt.Sub(now)
+	}
+	return ratelimit.NewUsage(cfg.Limit, e.count, resetAfter)
+}
+
+// fixedWindow counts requests in a window starting at the first one.
+func (e *entry) fixedWindow(now time.Time, cfg config.RLConfig) time.Duration {
+	if e.expiresAt.IsZero() {
+		e.expiresAt = now.Add(time.Duration(cfg.WindowSize) * time.Second)
+	}
+	if e.count >= cfg.Limit {
+		return e.expiresAt.Sub(now)
+	}
+	e.count++
+	return 0
+}
+
+// slidingLog keeps the time of every accepted request still in the window.
+func (e *entry) slidingLog(now time.Time, cfg config.RLConfig) time.Duration {
+	window := time.Duration(cfg.WindowSize) * time.Second
+
+	kept := e.log[:0]
+	for _, at := range e.log {
+		if at.After(now.Add(-window)) {
+			kept = append(kept, at)
+		}
+	}
+	e.log = kept
+
+	if len(e.log) >= cfg.Limit {
+		return e.log[len(e.log)-cfg.Limit].Add(window).Sub(now)
+	}
+	e.log = append(e.log, now)
+	e.expiresAt = now.Add(window)
+	return 0
+}
+
+// peekSlidingLog counts the requests still in the window, which is fully
+// available again once the latest one leaves it.
+func (e *entry) peekSlidingLog(now time.Time, cfg config.RLConfig) ratelimit.Usage {
+	window := time.Duration(cfg.WindowSize) * time.Second
+
+	var (
+		used   int
+		latest time.Time
+	)
+	for _, at := range e.log {
+		if at.After(now.Add(-window)) {
+			used++
+			latest = at
+		}
+	}
+
+	var resetAfter time.Duration
+	if used > 0 {
+		resetAfter = latest.Add(window).Sub(now)
+	}
+	return ratelimit.NewUsage(cfg.Limit, used, resetAfter)
+}
+
+// slidingCounter weights the previous fixed window by its overlap with the
+// sliding window, see the redis implementation for the reasoning.
+func (e *entry) slidingCounter(now time.Time, cfg config.RLConfig) time.Duration {
+	window := time.Duration(cfg.WindowSize) * time.Second
+	bucket := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() - bucket*int64(window))
+
+	curr, prev := e.curr, e.prev
+	if e.bucket != bucket {
+		if e.bucket == bucket-1 {
+			prev = curr
+		} else {
+			prev = 0
+		}
+		curr = 0
+	}
+
+	w := float64(window)
+	limit := cfg.Limit
+	estimate := float64(prev)*(w-float64(elapsed))/w + float64(curr)
+	if estimate+1 > float64(limit) {
+		if curr+1 <= limit {
+			return time.Duration(math.Ceil(w - float64(limit-curr-1)*w/float64(prev) - float64(elapsed)))
+		}
+		retry := window - elapsed
+		if decay := w - float64(limit-1)*w/float64(curr); decay > 0 {
+			retry += time.Duration(math.Ceil(decay))
+		}
+		return retry
+	}
+
+	e.bucket, e.curr, e.prev = bucket, curr+1, prev
+	e.expiresAt = now.Add(2 * window)
+	return 0
+}
+
+// peekSlidingCounter estimates the requests in the sliding window as
+// slidingCounter does. Nothing counts anymore once the current fixed window
+// is the previous one and has fully decayed.
+func (e *entry) peekSlidingCounter(now time.Time, cfg config.RLConfig) ratelimit.Usage {
+	window := time.Duration(cfg.WindowSize) * time.Second
+	bucket := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() - bucket*int64(window))
+
+	curr, prev := e.curr, e.prev
+	if e.bucket != bucket {
+		if e.bucket == bucket-1 {
+			prev = curr
+		} else {
+			prev = 0
+		}
+		curr = 0
+	}
+
+	var resetAfter time.Duration
+	switch {
+	case curr > 0:
+		resetAfter = 2*window - elapsed
+	case prev > 0:
+		resetAfter = window - elapsed
+	}
+	w := float64(window)
+	estimate := float64(prev)*(w-float64(elapsed))/w + float64(curr)
+	return ratelimit.NewUsage(cfg.Limit, int(estimate), resetAfter)
+}
+
+// gcra tracks the theoretical arrival time of the next request.
+func (e *entry) gcra(now time.Time, cfg config.RLConfig) time.Duration {
+	interval := cfg.EmissionInterval()
+
+	tat := e.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-time.Duration(cfg.Burst) * interval)
+	if allowAt.After(now) {
+		return allowAt.Sub(now)
+	}
+
+	e.tat = newTat
+	e.expiresAt = newTat
+	return 0
+}
+
+// peekGCRA counts the cells of the burst not replenished yet, the whole burst
+// is available again at the theoretical arrival time.
+func (e *entry) peekGCRA(now time.Time, cfg config.RLConfig) ratelimit.Usage {
+	interval := cfg.EmissionInterval()
+
+	var resetAfter time.Duration
+	if e.tat.After(now) {
+		resetAfter = e.tat.Sub(now)
+	}
+	used := int((resetAfter + interval - 1) / interval)
+	return ratelimit.NewUsage(cfg.Burst, used, resetAfter)
+}
+
+func (rl *RateLimiter) shardFor(key string) *shard {
+	return rl.shards[rl.shardIndex(key)]
+}
+
+func (rl *RateLimiter) shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(rl.shards)))
+}
+
+func (rl *RateLimiter) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case <-ticker.C:
+			rl.evictExpired()
+		}
+	}
+}
+
+// evictExpired drops every key whose state no longer affects any decision.
+func (rl *RateLimiter) evictExpired() {
+	now := rl.now()
+	for _, s := range rl.shards {
+		s.mu.Lock()
+		for key, e := range s.entries {
+			if !now.Before(e.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
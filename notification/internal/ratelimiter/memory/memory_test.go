@@ -0,0 +1,681 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(t *testing.T) (*RateLimiter, *fakeClock) {
+	clock := newFakeClock()
+	rl := New(Options{Clock: clock.Now})
+	t.Cleanup(rl.Close)
+	return rl, clock
+}
+
+// step is a single request made after advancing the clock.
+type step struct {
+	advance     time.Duration
+	expectAllow bool
+	expectRetry time.Duration
+}
+
+func runSteps(t *testing.T, rl *RateLimiter, clock *fakeClock, cfg config.RLConfig, steps []step) {
+	t.Helper()
+	key := model.NotificationTypeStatus.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		decision, err := rl.IsAllowed(context.Background(), key, cfg)
+
+		if decision.Allowed != s.expectAllow {
+			t.Fatalf("step %d: expected allowed = %v, got %v (err: %v)", i, s.expectAllow, decision.Allowed, err)
+		}
+		if s.expectAllow {
+			if err != nil {
+				t.Fatalf("step %d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+
+		var rateLimitErr *ratelimit.LimitExceededError
+		if !errors.As(err, &rateLimitErr) {
+			t.Fatalf("step %d: expected LimitExceededError, got %T: %v", i, err, err)
+		}
+		if rateLimitErr.RetryAfter != s.expectRetry {
+			t.Errorf("step %d: expected RetryAfter %v, got %v", i, s.expectRetry, rateLimitErr.RetryAfter)
+		}
+	}
+}
+
+func TestIsAllowed_FixedWindow(t *testing.T) {
+	rl, clock := newTestLimiter(t)
+	cfg := config.RLConfig{Limit: 2, WindowSize: 60}
+
+	runSteps(t, rl, clock, cfg, []step{
+		{expectAllow: true},
+		{advance: 10 * time.Second, expectAllow: true},
+		{advance: 20 * time.Second, expectRetry: 30 * time.Second},
+		{advance: 30 * time.Second, expectAllow: true},
+		{expectAllow: true},
+		{expectRetry: 60 * time.Second},
+	})
+}
+
+func TestIsAllowed_SlidingLog(t *testing.T) {
+	rl, clock := newTestLimiter(t)
+	cfg := config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 2, WindowSize: 60}
+
+	runSteps(t, rl, clock, cfg, []step{
+		{expectAllow: true},
+		{advance: 30 * time.Second, expectAllow: true},
+		{advance: 15 * time.Second, expectRetry: 15 * time.Second},
+		// The first request leaves the window, the second one still counts.
+		{advance: 15 * time.Second, expectAllow: true},
+		{expectRetry: 30 * time.Second},
+		{advance: 30 * time.Second, expectAllow: true},
+	})
+}
+
+func TestIsAllowed_SlidingCounter(t *testing.T) {
+	rl, clock := newTestLimiter(t)
+	cfg := config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: 2, WindowSize: 60}
+
+	runSteps(t, rl, clock, cfg, []step{
+		{expectAllow: true},
+		{advance: 30 * time.Second, expectAllow: true},
+		// The current window is full, so wait for the next one and for the
+		// previous window's weight to drop to 1/2: 15s + 30s.
+		{advance: 15 * time.Second, expectRetry: 45 * time.Second},
+		{advance: 30 * time.Second, expectRetry: 15 * time.Second},
+		{advance: 15 * time.Second, expectAllow: true},
+		{expectRetry: 30 * time.Second},
+	})
+}
+
+// maxInAnyWindow returns the largest number of accepted times that fall within
+// any sliding window of the given size.
+func maxInAnyWindow(accepted []time.Duration, window time.Duration) int {
+	best, start := 0, 0
+	for end := range accepted {
+		for accepted[end]-accepted[start] >= window {
+			start++
+		}
+		best = max(best, end-start+1)
+	}
+	return best
+}
+
+// maxInAnyBucket returns the largest number of accepted times that fall within
+// a single fixed window of the given size.
+func maxInAnyBucket(accepted []time.Duration, window time.Duration) int {
+	counts := make(map[time.Duration]int)
+	best := 0
+	for _, at := range accepted {
+		counts[at/window]++
+		best = max(best, counts[at/window])
+	}
+	return best
+}
+
+func TestIsAllowed_SlidingCounterErrorBounds(t *testing.T) {
+	const (
+		limit   = 10
+		window  = time.Minute
+		windows = 200
+	)
+	counterCfg := config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: limit, WindowSize: 60}
+	logCfg := config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: limit, WindowSize: 60}
+
+	patterns := []struct {
+		name string
+		// maxInWindow bounds how many requests the counter lets through in
+		// any sliding window for this traffic shape.
+		maxInWindow int
+		// maxAcceptedDiff bounds the relative difference in accepted requests
+		// between the counter and the exact sliding log.
+		maxAcceptedDiff float64
+		// worstCase tells the traffic reaches the documented worst case, so
+		// maxInWindow must be reached and not only bounded.
+		worstCase bool
+		arrivals  func() []time.Duration
+	}{
+		{
+			name:            "steady traffic at three times the limit",
+			maxInWindow:     limit,
+			maxAcceptedDiff: 0.1,
+			arrivals: func() []time.Duration {
+				var out []time.Duration
+				step := window / (3 * limit)
+				for at := time.Duration(0); at < windows*window; at += step {
+					out = append(out, at)
+				}
+				return out
+			},
+		},
+		{
+			name:            "random traffic at twice the limit",
+			maxInWindow:     limit + limit*3/10,
+			maxAcceptedDiff: 0.05,
+			arrivals: func() []time.Duration {
+				var out []time.Duration
+				rng := rand.New(rand.NewPCG(42, 7))
+				mean := float64(window) / (2 * limit)
+				for at := time.Duration(0); at < windows*window; at += time.Duration(rng.ExpFloat64()*mean) + 1 {
+					out = append(out, at)
+				}
+				return out
+			},
+		},
+		{
+			// Worst case: a burst lands right before a boundary and steady
+			// traffic follows, so the counter assumes the burst was spread
+			// evenly and under-weights it while it is still inside the window.
+			// The log only lets the bursts through, while the counter also lets
+			// most of the steady traffic after them.
+			name:            "bursts right before a boundary followed by steady traffic",
+			maxInWindow:     2*limit - 1,
+			maxAcceptedDiff: 0.81,
+			worstCase:       true,
+			arrivals: func() []time.Duration {
+				var out []time.Duration
+				step := window / (3 * limit)
+				for w := time.Duration(0); w < windows; w += 2 {
+					for i := range time.Duration(3 * limit) {
+						out = append(out, (w+1)*window-3*limit*time.Millisecond+i*time.Millisecond)
+					}
+					for at := (w + 1) * window; at < (w+2)*window; at += step {
+						out = append(out, at)
+					}
+				}
+				return out
+			},
+		},
+	}
+
+	for _, p := range patterns {
+		t.Run(p.name, func(t *testing.T) {
+			rl, clock := newTestLimiter(t)
+			key := model.NotificationTypeMarketing.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+
+			var counterAccepted, logAccepted []time.Duration
+			var elapsed time.Duration
+			for _, at := range p.arrivals() {
+				clock.Advance(at - elapsed)
+				elapsed = at
+
+				if decision, _ := rl.IsAllowed(context.Background(), key, counterCfg); decision.Allowed {
+					counterAccepted = append(counterAccepted, at)
+				}
+				if decision, _ := rl.IsAllowed(context.Background(), key, logCfg); decision.Allowed {
+					logAccepted = append(logAccepted, at)
+				}
+			}
+
+			if got := maxInAnyWindow(logAccepted, window); got > limit {
+				t.Fatalf("sliding log let %d requests through in one window, limit is %d", got, limit)
+			}
+
+			// Whatever the traffic, a fixed window never goes over the limit,
+			// so no sliding window, spanning two of them, reaches twice it.
+			if got := maxInAnyBucket(counterAccepted, window); got > limit {
+				t.Errorf("counter let %d requests through in one fixed window, limit is %d", got, limit)
+			}
+			worst := maxInAnyWindow(counterAccepted, window)
+			if worst >= 2*limit {
+				t.Errorf("counter let %d requests through in one window, hard bound is %d", worst, 2*limit-1)
+			}
+			if worst > p.maxInWindow {
+				t.Errorf("counter let %d requests through in one window, expected at most %d", worst, p.maxInWindow)
+			}
+			if p.worstCase && worst != p.maxInWindow {
+				t.Errorf("counter let %d requests through in one window, expected the worst case of %d", worst, p.maxInWindow)
+			}
+
+			diff := math.Abs(float64(len(counterAccepted)-len(logAccepted))) / float64(len(logAccepted))
+			if diff > p.maxAcceptedDiff {
+				t.Errorf("counter accepted %d requests, sliding log %d (%.1f%% apart), expected at most %.0f%%",
+					len(counterAccepted), len(logAccepted), diff*100, p.maxAcceptedDiff*100)
+			}
+
+			t.Logf("worst window: %d/%d, accepted: counter=%d log=%d (%.1f%% apart)",
+				worst, limit, len(counterAccepted), len(logAccepted), diff*100)
+		})
+	}
+}
+
+func TestIsAllowed_SlidingCounterRetryAfterIsExact(t *testing.T) {
+	const window = time.Minute
+
+	for _, limit := range []int{1, 2, 5, 10} {
+		rl, clock := newTestLimiter(t)
+		cfg := config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: limit, WindowSize: 60}
+		key := model.NotificationTypeMarketing.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+		rng := rand.New(rand.NewPCG(uint64(limit), 1))
+
+		for range 500 {
+			clock.Advance(time.Duration(rng.Int64N(int64(window) / int64(limit))))
+			_, err := rl.IsAllowed(context.Background(), key, cfg)
+			var rateLimitErr *ratelimit.LimitExceededError
+			if !errors.As(err, &rateLimitErr) {
+				continue
+			}
+			retry := rateLimitErr.RetryAfter
+			if retry <= 0 {
+				t.Fatalf("limit %d: expected positive retry-after, got %v", limit, retry)
+			}
+
+			// A denied request leaves the state untouched, so probing just
+			// before and at the retry-after tells whether it is exact.
+			clock.Advance(retry - time.Millisecond)
+			if decision, _ := rl.IsAllowed(context.Background(), key, cfg); decision.Allowed {
+				t.Errorf("limit %d: request was allowed %v before retry-after %v", limit, time.Millisecond, retry)
+			}
+			clock.Advance(time.Millisecond)
+			if decision, _ := rl.IsAllowed(context.Background(), key, cfg); !decision.Allowed {
+				t.Errorf("limit %d: request was denied after waiting retry-after %v", limit, retry)
+			}
+		}
+	}
+}
+
+func TestIsAllowed_SlidingCounterWeightsThePreviousWindow(t *testing.T) {
+	const (
+		limit  = 10
+		window = time.Minute
+	)
+	cfg := config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: limit, WindowSize: 60}
+	key := model.NotificationTypeMarketing.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+
+	// After a full window, the previous one still weighs
+	// limit * (window - elapsed) / window once elapsed of the next one went by,
+	// which leaves floor(limit * elapsed / window) requests.
+	for _, elapsed := range []time.Duration{3 * time.Second, 9 * time.Second, 15 * time.Second, 27 * time.Second, 33 * time.Second, 51 * time.Second, 59 * time.Second} {
+		rl, clock := newTestLimiter(t)
+		for range limit {
+			if decision, err := rl.IsAllowed(context.Background(), key, cfg); !decision.Allowed {
+				t.Fatalf("expected the first window to be allowed, got %v", err)
+			}
+		}
+
+		clock.Advance(window + elapsed)
+		allowed := 0
+		for {
+			if decision, _ := rl.IsAllowed(context.Background(), key, cfg); !decision.Allowed {
+				break
+			}
+			allowed++
+		}
+		if expected := int(limit * elapsed / window); allowed != expected {
+			t.Errorf("%v into the next window: expected %d requests allowed, got %d", elapsed, expected, allowed)
+		}
+	}
+}
+
+func TestIsAllowed_GCRA(t *testing.T) {
+	rl, clock := newTestLimiter(t)
+	// A burst of 3, then one every 30 seconds.
+	cfg := config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 3, Rate: 1, WindowSize: 30}
+
+	runSteps(t, rl, clock, cfg, []step{
+		{expectAllow: true},
+		{expectAllow: true},
+		{expectAllow: true},
+		{expectRetry: 30 * time.Second},
+		{advance: 10 * time.Second, expectRetry: 20 * time.Second},
+		{advance: 20 * time.Second, expectAllow: true},
+		{expectRetry: 30 * time.Second},
+		// Idle long enough to refill the whole burst.
+		{advance: 5 * time.Minute, expectAllow: true},
+		{expectAllow: true},
+		{expectAllow: true},
+		{expectRetry: 30 * time.Second},
+	})
+}
+
+func TestRefund(t *testing.T) {
+	for _, cfg := range []config.RLConfig{
+		{Limit: 2, WindowSize: 60},
+		{Algorithm: config.AlgorithmSlidingLog, Limit: 2, WindowSize: 60},
+		{Algorithm: config.AlgorithmSlidingCounter, Limit: 2, WindowSize: 60},
+		{Algorithm: config.AlgorithmGCRA, Burst: 2, Rate: 1, WindowSize: 30},
+	} {
+		t.Run(string(cfg.GetAlgorithm()), func(t *testing.T) {
+			rl, _ := newTestLimiter(t)
+			ctx := context.Background()
+
+			for range 2 {
+				if decision, err := rl.IsAllowed(ctx, "key", cfg); !decision.Allowed {
+					t.Fatalf("expected request to be allowed, got %v", err)
+				}
+			}
+			if decision, _ := rl.IsAllowed(ctx, "key", cfg); decision.Allowed {
+				t.Fatal("expected request over the limit to be denied")
+			}
+
+			if err := rl.Refund(ctx, "key", cfg); err != nil {
+				t.Fatalf("unexpected refund error: %v", err)
+			}
+			if decision, err := rl.IsAllowed(ctx, "key", cfg); !decision.Allowed {
+				t.Errorf("expected refunded request to be available again, got %v", err)
+			}
+			if decision, _ := rl.IsAllowed(ctx, "key", cfg); decision.Allowed {
+				t.Error("expected a single refund to free a single request")
+			}
+
+			// Refunding a key that was never used is a no-op.
+			if err := rl.Refund(ctx, "unused", cfg); err != nil {
+				t.Errorf("unexpected refund error for unused key: %v", err)
+			}
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	tests := []struct {
+		cfg         config.RLConfig
+		expectUsed  int
+		expectReset time.Duration
+	}{
+		// Two requests, at 0s and 10s, peeked at 20s.
+		{cfg: config.RLConfig{Limit: 3, WindowSize: 60}, expectUsed: 2, expectReset: 40 * time.Second},
+		{cfg: config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 3, WindowSize: 60}, expectUsed: 2, expectReset: 50 * time.Second},
+		{cfg: config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: 3, WindowSize: 60}, expectUsed: 2, expectReset: 100 * time.Second},
+		{cfg: config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 3, Rate: 1, WindowSize: 30}, expectUsed: 2, expectReset: 40 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.cfg.GetAlgorithm()), func(t *testing.T) {
+			rl, clock := newTestLimiter(t)
+			ctx := context.Background()
+
+			if usage, err := rl.Peek(ctx, "key", tt.cfg); err != nil || usage != ratelimit.NewUsage(3, 0, 0) {
+				t.Fatalf("expected an unused key to be fully available, got %+v, %v", usage, err)
+			}
+
+			rl.IsAllowed(ctx, "key", tt.cfg)
+			clock.Advance(10 * time.Second)
+			rl.IsAllowed(ctx, "key", tt.cfg)
+			clock.Advance(10 * time.Second)
+
+			for range 2 {
+				usage, err := rl.Peek(ctx, "key", tt.cfg)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				expected := ratelimit.NewUsage(3, tt.expectUsed, tt.expectReset)
+				if usage != expected {
+					t.Errorf("expected %+v, got %+v", expected, usage)
+				}
+			}
+
+			// Peeking consumed nothing.
+			if decision, err := rl.IsAllowed(ctx, "key", tt.cfg); !decision.Allowed {
+				t.Errorf("expected the last request to be allowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsAllowed_Decision(t *testing.T) {
+	tests := []struct {
+		cfg         config.RLConfig
+		expectReset time.Duration
+		expectRetry time.Duration
+	}{
+		{cfg: config.RLConfig{Limit: 1, WindowSize: 60}, expectReset: 60 * time.Second, expectRetry: 60 * time.Second},
+		{cfg: config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 1, WindowSize: 60}, expectReset: 60 * time.Second, expectRetry: 60 * time.Second},
+		{cfg: config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: 1, WindowSize: 60}, expectReset: 120 * time.Second, expectRetry: 120 * time.Second},
+		{cfg: config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 1, Rate: 1, WindowSize: 30}, expectReset: 30 * time.Second, expectRetry: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.cfg.GetAlgorithm()), func(t *testing.T) {
+			rl, _ := newTestLimiter(t)
+			ctx := context.Background()
+
+			decision, err := rl.IsAllowed(ctx, "key", tt.cfg)
+			if expected := ratelimit.Allow(ratelimit.NewUsage(1, 1, tt.expectReset)); err != nil || decision != expected {
+				t.Errorf("expected %+v, got %+v, %v", expected, decision, err)
+			}
+			decision, _ = rl.IsAllowed(ctx, "key", tt.cfg)
+			if expected := ratelimit.Deny(1, tt.expectRetry); decision != expected {
+				t.Errorf("expected %+v, got %+v", expected, decision)
+			}
+		})
+	}
+}
+
+func TestIsAllowed_KeysAreIsolated(t *testing.T) {
+	rl, _ := newTestLimiter(t)
+	ctx := context.Background()
+	cfg := config.RLConfig{Limit: 1, WindowSize: 60}
+
+	keys := []string{
+		model.NotificationTypeNews.GenKey("", "user-1"),
+		model.NotificationTypeNews.GenKey("", "user-2"),
+		model.NotificationTypeStatus.GenKey("", "user-1"),
+	}
+	for _, key := range keys {
+		if decision, err := rl.IsAllowed(ctx, key, cfg); !decision.Allowed {
+			t.Errorf("expected first request for %q to be allowed, got %v", key, err)
+		}
+	}
+
+	// Same key, different algorithm, does not share state.
+	sliding := config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 1, WindowSize: 60}
+	if decision, err := rl.IsAllowed(ctx, keys[0], sliding); !decision.Allowed {
+		t.Errorf("expected first sliding-log request to be allowed, got %v", err)
+	}
+}
+
+func TestIsAllowed_UnsupportedAlgorithm(t *testing.T) {
+	rl, _ := newTestLimiter(t)
+
+	decision, err := rl.IsAllowed(context.Background(), "key", config.RLConfig{Algorithm: "leaky_bucket", Limit: 1, WindowSize: 1})
+	if decision.Allowed || err == nil {
+		t.Fatalf("expected an error for an unsupported algorithm, got allowed = %v, err = %v", decision.Allowed, err)
+	}
+	var rateLimitErr *ratelimit.LimitExceededError
+	if errors.As(err, &rateLimitErr) {
+		t.Errorf("expected a plain error, got LimitExceededError")
+	}
+}
+
+func TestIsAllowedAll(t *testing.T) {
+	global := config.RLConfig{Limit: 1, WindowSize: 60}
+	for _, cfg := range []config.RLConfig{
+		{Limit: 2, WindowSize: 60},
+		{Algorithm: config.AlgorithmSlidingLog, Limit: 2, WindowSize: 60},
+		{Algorithm: config.AlgorithmSlidingCounter, Limit: 2, WindowSize: 60},
+		{Algorithm: config.AlgorithmGCRA, Burst: 2, Rate: 1, WindowSize: 30},
+	} {
+		t.Run(string(cfg.GetAlgorithm()), func(t *testing.T) {
+			rl, _ := newTestLimiter(t)
+			ctx := context.Background()
+			keys := [][]string{{"type", "global"}, {"type", "global"}}
+			cfgs := [][]config.RLConfig{{cfg, global}, {cfg, global}}
+
+			decisions, errs := rl.IsAllowedAll(ctx, keys, cfgs)
+
+			if errs[0][0] != nil || errs[0][1] != nil || !decisions[0][0].Allowed || !decisions[0][1].Allowed {
+				t.Fatalf("expected the first request to be allowed by both rules, got %+v, %v", decisions[0], errs[0])
+			}
+			// The type rule allowed the second request, as if it consumed it.
+			if !decisions[1][0].Allowed || decisions[1][0].Usage.Used != 2 {
+				t.Errorf("expected the type rule to allow the second request, got %+v, %v", decisions[1][0], errs[1][0])
+			}
+			var rateLimitErr *ratelimit.LimitExceededError
+			if decisions[1][1].Allowed || !errors.As(errs[1][1], &rateLimitErr) {
+				t.Errorf("expected the global rule to deny the second request, got %+v, %v", decisions[1][1], errs[1][1])
+			}
+
+			// The denied request consumed nothing.
+			if usage, err := rl.Peek(ctx, "type", cfg); err != nil || usage.Used != 1 {
+				t.Errorf("expected the type rule to count the first request only, got %+v, %v", usage, err)
+			}
+		})
+	}
+}
+
+func TestIsAllowedAll_UnsupportedAlgorithm(t *testing.T) {
+	rl, _ := newTestLimiter(t)
+	ctx := context.Background()
+	cfg := config.RLConfig{Limit: 1, WindowSize: 60}
+
+	_, errs := rl.IsAllowedAll(ctx, [][]string{{"type", "global"}}, [][]config.RLConfig{{cfg, {Algorithm: "leaky_bucket", Limit: 1, WindowSize: 1}}})
+	for i, err := range errs[0] {
+		if err == nil {
+			t.Errorf("expected rule %d to fail, got no error", i)
+		}
+	}
+	if usage, _ := rl.Peek(ctx, "type", cfg); usage.Used != 0 {
+		t.Errorf("expected nothing to be consumed, got %+v", usage)
+	}
+}
+
+func TestEvictExpired(t *testing.T) {
+	rl, clock := newTestLimiter(t)
+	ctx := context.Background()
+
+	rl.IsAllowed(ctx, "short", config.RLConfig{Limit: 1, WindowSize: 10})
+	rl.IsAllowed(ctx, "long", config.RLConfig{Limit: 1, WindowSize: 3600})
+
+	clock.Advance(time.Minute)
+	rl.evictExpired()
+
+	if n := countKeys(rl); n != 1 {
+		t.Fatalf("expected only the long-lived key to remain, got %d keys", n)
+	}
+
+	// The surviving key still enforces its limit.
+	if decision, _ := rl.IsAllowed(ctx, "long", config.RLConfig{Limit: 1, WindowSize: 3600}); decision.Allowed {
+		t.Error("expected long-lived key to still be limited")
+	}
+}
+
+func TestBackgroundCleanup(t *testing.T) {
+	clock := newFakeClock()
+	rl := New(Options{Clock: clock.Now, CleanupInterval: 5 * time.Millisecond})
+	defer rl.Close()
+
+	rl.IsAllowed(context.Background(), "idle", config.RLConfig{Limit: 1, WindowSize: 1})
+	clock.Advance(2 * time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for countKeys(rl) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected idle key to be evicted in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestIsAllowed_ConcurrentRequestsNeverExceedLimit(t *testing.T) {
+	rl, _ := newTestLimiter(t)
+
+	const goroutines = 500
+	for _, cfg := range []config.RLConfig{
+		{Limit: 50, WindowSize: 60},
+		{Algorithm: config.AlgorithmSlidingLog, Limit: 50, WindowSize: 60},
+		{Algorithm: config.AlgorithmSlidingCounter, Limit: 50, WindowSize: 60},
+		{Algorithm: config.AlgorithmGCRA, Burst: 50, Rate: 1, WindowSize: 60},
+	} {
+		t.Run(string(cfg.GetAlgorithm()), func(t *testing.T) {
+			var (
+				allowed atomic.Int64
+				wg      sync.WaitGroup
+			)
+			for range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if decision, _ := rl.IsAllowed(context.Background(), "hot-key", cfg); decision.Allowed {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := allowed.Load(); got != 50 {
+				t.Errorf("expected exactly 50 allowed requests, got %d", got)
+			}
+		})
+	}
+}
+
+func TestIsAllowedAll_ConcurrentRequestsNeverExceedAnyRule(t *testing.T) {
+	rl, _ := newTestLimiter(t)
+
+	// Two types of 10 each share a global cap of 10: requests a type rule
+	// allowed but the global one denied must not count against the type.
+	global := config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 10, WindowSize: 60}
+	typed := config.RLConfig{Limit: 10, WindowSize: 60}
+
+	const goroutines = 200
+	var (
+		allowed [2]atomic.Int64
+		wg      sync.WaitGroup
+	)
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys := [][]string{{"type-" + string(rune('a'+i%2)), "global"}}
+			decisions, _ := rl.IsAllowedAll(context.Background(), keys, [][]config.RLConfig{{typed, global}})
+			if decisions[0][0].Allowed && decisions[0][1].Allowed {
+				allowed[i%2].Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed[0].Load() + allowed[1].Load(); got != 10 {
+		t.Errorf("expected exactly 10 allowed requests, got %d", got)
+	}
+	for i, key := range []string{"type-a", "type-b"} {
+		if usage, _ := rl.Peek(context.Background(), key, typed); int64(usage.Used) != allowed[i].Load() {
+			t.Errorf("expected %s to count its %d allowed requests only, got %d", key, allowed[i].Load(), usage.Used)
+		}
+	}
+}
+
+func countKeys(rl *RateLimiter) int {
+	n := 0
+	for _, s := range rl.shards {
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
@@ -0,0 +1,160 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraLua implements the generic cell rate algorithm. The only state kept per
+// key is the theoretical arrival time (TAT) of the next request: each accepted
+// request pushes it one emission interval further, and a request is accepted
+// while the TAT is at most burst intervals ahead of now.
+//
+// KEYS[1] - TAT key
+// ARGV[1] - burst
+// ARGV[2] - emission interval in milliseconds
+//
+// Returns {allowed (0|1), remaining burst, retry-after/time to full burst in milliseconds}.
+const gcraLua = `
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local newTat = tat + interval
+local allowAt = newTat - burst * interval
+if allowAt > now then
+	return {0, 0, allowAt - now}
+end
+
+redis.call('SET', KEYS[1], newTat, 'PX', newTat - now)
+return {1, math.floor((now - allowAt) / interval), newTat - now}
+`
+
+var gcraScript = redis.NewScript(gcraLua)
+
+// gcraRefundLua moves the TAT back by one emission interval, never before now.
+//
+// KEYS[1] - TAT key
+// ARGV[1] - emission interval in milliseconds
+const gcraRefundLua = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or '0') - tonumber(ARGV[1])
+if tat <= now then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+redis.call('SET', KEYS[1], tat, 'PX', tat - now)
+return tat - now
+`
+
+var gcraRefundScript = redis.NewScript(gcraRefundLua)
+
+// gcraPeekLua counts the cells of the burst not replenished yet from the TAT,
+// without consuming one.
+//
+// KEYS[1] - TAT key
+// ARGV[1] - emission interval in milliseconds
+//
+// Returns {cells used, time to full burst in milliseconds}.
+const gcraPeekLua = `
+local interval = tonumber(ARGV[1])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat <= now then
+	return {0, 0}
+end
+return {math.ceil((tat - now) / interval), tat - now}
+`
+
+var gcraPeekScript = redis.NewScript(gcraPeekLua)
+
+// GCRARateLimiter defines a redis-based generic cell rate algorithm
+// rate-limiter, supporting bursts followed by a steady refill rate.
+type GCRARateLimiter struct {
+	client *redis.Client
+}
+
+// NewGCRA creates a redis-based GCRA rate-limiter
+func NewGCRA(client *redis.Client) *GCRARateLimiter {
+	return &GCRARateLimiter{client}
+}
+
+// IsAllowed atomically checks and consumes one cell from the bucket identified
+// by key, allowing cfg.Burst requests at once and replenishing cfg.Rate of them
+// every cfg.WindowSize seconds, and returns the Usage left. When the bucket is
+// empty it returns a ratelimit.LimitExceededError carrying the time until the
+// next cell frees up.
+func (rl *GCRARateLimiter) IsAllowed(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error) {
+	rediskey := "rate_limit:gcra:" + key
+	interval := cfg.EmissionInterval().Milliseconds()
+	res, err := gcraScript.Run(ctx, rl.client, []string{rediskey}, cfg.Burst, interval).Int64Slice()
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("failed to run gcra script: %w", err)
+	}
+	return decideGCRA(res, cfg.Burst)
+}
+
+// IsAllowedBatch is IsAllowed for each of keys, against the rule of the same
+// index, in a single round trip. The requests are counted in order.
+func (rl *GCRARateLimiter) IsAllowedBatch(ctx context.Context, keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error) {
+	rediskeys := make([][]string, len(keys))
+	args := make([][]any, len(keys))
+	for i, key := range keys {
+		rediskeys[i] = []string{"rate_limit:gcra:" + key}
+		args[i] = []any{cfgs[i].Burst, cfgs[i].EmissionInterval().Milliseconds()}
+	}
+
+	replies, errs := runBatch(ctx, rl.client, gcraScript, rediskeys, args)
+	decisions := make([]ratelimit.Decision, len(keys))
+	for i, res := range replies {
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to run gcra script: %w", errs[i])
+			continue
+		}
+		decisions[i], errs[i] = decideGCRA(res, cfgs[i].Burst)
+	}
+	return decisions, errs
+}
+
+// decideGCRA is decide for the replies of gcraScript, which count the cells
+// of burst remaining instead of the used ones.
+func decideGCRA(res []int64, burst int) (ratelimit.Decision, error) {
+	if len(res) == 3 {
+		res = []int64{res[0], int64(burst) - res[1], res[2]}
+	}
+	return decide("gcra", res, burst)
+}
+
+// Refund gives back a cell previously consumed by IsAllowed for key.
+func (rl *GCRARateLimiter) Refund(ctx context.Context, key string, cfg config.RLConfig) error {
+	rediskey := "rate_limit:gcra:" + key
+	interval := cfg.EmissionInterval().Milliseconds()
+	if err := gcraRefundScript.Run(ctx, rl.client, []string{rediskey}, interval).Err(); err != nil {
+		return fmt.Errorf("failed to refund gcra cell: %w", err)
+	}
+	return nil
+}
+
+// Peek returns how many cells of the bucket identified by key are not
+// replenished yet, without consuming one. The whole burst is available again
+// once they all are.
+func (rl *GCRARateLimiter) Peek(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+	rediskey := "rate_limit:gcra:" + key
+	return peek(ctx, rl.client, gcraPeekScript, []string{rediskey}, cfg.Burst, cfg.EmissionInterval().Milliseconds())
+}
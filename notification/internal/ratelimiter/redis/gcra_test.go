@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/go-redis/redismock/v9"
+)
+
+func TestGCRAIsAllowed_Table(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		reply           []any
+		scriptErr       error
+		noScript        bool
+		expectAllow     bool
+		expectErr       bool
+		expectRateLimit bool
+		expectRetry     time.Duration
+		expectUsage     ratelimit.Usage
+	}{
+		{
+			name:        "Full bucket",
+			reply:       []any{int64(1), int64(4), int64(30000)},
+			expectAllow: true,
+			expectUsage: ratelimit.NewUsage(5, 1, 30*time.Second),
+		},
+		{
+			name:        "Last cell of the burst",
+			reply:       []any{int64(1), int64(0), int64(150000)},
+			expectAllow: true,
+			expectUsage: ratelimit.NewUsage(5, 5, 150*time.Second),
+		},
+		{
+			name:            "Empty bucket - retry when next cell frees up",
+			reply:           []any{int64(0), int64(0), int64(12500)},
+			expectRateLimit: true,
+			expectRetry:     12500 * time.Millisecond,
+		},
+		{
+			name:        "Script not cached - falls back to EVAL",
+			reply:       []any{int64(1), int64(4), int64(30000)},
+			noScript:    true,
+			expectAllow: true,
+			expectUsage: ratelimit.NewUsage(5, 1, 30*time.Second),
+		},
+		{
+			name:      "Unexpected script reply",
+			reply:     []any{int64(1), int64(4)},
+			expectErr: true,
+		},
+		{
+			name:      "Redis returns unexpected error",
+			scriptErr: errors.New("connection dropped"),
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			limiter := NewGCRA(client)
+
+			key := model.NotificationTypeStatus.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+			redisKey := "rate_limit:gcra:" + key
+			// A burst of 5, then one every 30 seconds.
+			cfg := config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 5, Rate: 1, WindowSize: 30}
+			interval := int64(30000)
+
+			evalSha := mock.ExpectEvalSha(gcraScript.Hash(), []string{redisKey}, cfg.Burst, interval)
+			switch {
+			case tt.scriptErr != nil:
+				evalSha.SetErr(tt.scriptErr)
+			case tt.noScript:
+				evalSha.SetErr(noScriptError{})
+				mock.ExpectEval(gcraLua, []string{redisKey}, cfg.Burst, interval).SetVal(tt.reply)
+			default:
+				evalSha.SetVal(tt.reply)
+			}
+
+			decision, err := limiter.IsAllowed(ctx, key, cfg)
+
+			if tt.expectErr && err == nil {
+				t.Errorf("expected error, got none")
+			}
+			if !tt.expectErr && err != nil && !tt.expectRateLimit {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if decision.Allowed != tt.expectAllow {
+				t.Errorf("expected allowed = %v, got %v", tt.expectAllow, decision.Allowed)
+			}
+			if tt.expectAllow && decision.Usage != tt.expectUsage {
+				t.Errorf("expected usage %+v, got %+v", tt.expectUsage, decision.Usage)
+			}
+
+			if tt.expectRateLimit {
+				var rateLimitErr *ratelimit.LimitExceededError
+				if !errors.As(err, &rateLimitErr) {
+					t.Errorf("expected LimitExceededError, got %T: %v", err, err)
+				} else if rateLimitErr.RetryAfter != tt.expectRetry {
+					t.Errorf("expected RetryAfter %v, got %v", tt.expectRetry, rateLimitErr.RetryAfter)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet redis expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestEmissionInterval(t *testing.T) {
+	tests := []struct {
+		cfg      config.RLConfig
+		expected time.Duration
+	}{
+		{config.RLConfig{Rate: 1, WindowSize: 30}, 30 * time.Second},
+		{config.RLConfig{Rate: 2, WindowSize: 60}, 30 * time.Second},
+		{config.RLConfig{Rate: 3, WindowSize: 1}, 333333333 * time.Nanosecond},
+	}
+
+	for _, tt := range tests {
+		if got := tt.cfg.EmissionInterval(); got != tt.expected {
+			t.Errorf("EmissionInterval(%+v) = %v, expected %v", tt.cfg, got, tt.expected)
+		}
+	}
+}
@@ -2,15 +2,77 @@ package redis
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
 	"github.com/redis/go-redis/v9"
 )
 
+// fixedWindowLua checks and increments a fixed-window counter in a single
+// round trip, so concurrent callers can never both observe a free slot.
+//
+// KEYS[1] - counter key
+// ARGV[1] - limit
+// ARGV[2] - window size in seconds
+//
+// Returns {allowed (0|1), current count, remaining ttl in milliseconds}.
+const fixedWindowLua = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2]) * 1000
+
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current >= limit then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl < 0 then
+		redis.call('PEXPIRE', KEYS[1], window)
+		ttl = window
+	end
+	return {0, current, ttl}
+end
+
+current = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], window)
+	ttl = window
+end
+return {1, current, ttl}
+`
+
+var fixedWindowScript = redis.NewScript(fixedWindowLua)
+
+// fixedWindowRefundLua gives back one slot of a fixed-window counter, never
+// going below zero.
+//
+// KEYS[1] - counter key
+const fixedWindowRefundLua = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`
+
+var fixedWindowRefundScript = redis.NewScript(fixedWindowRefundLua)
+
+// fixedWindowPeekLua reads a fixed-window counter without consuming it.
+//
+// KEYS[1] - counter key
+//
+// Returns {current count, remaining ttl in milliseconds}.
+const fixedWindowPeekLua = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	ttl = 0
+end
+return {current, ttl}
+`
+
+var fixedWindowPeekScript = redis.NewScript(fixedWindowPeekLua)
+
 // RateLimiter defines a redis-based rate-limiter
 type RateLimiter struct {
 	client *redis.Client
@@ -21,42 +83,128 @@ func New(client *redis.Client) *RateLimiter {
 	return &RateLimiter{client}
 }
 
-func (rl *RateLimiter) IsAllowed(ctx context.Context, key string, limit, windowSize int) (bool, error) {
+// IsAllowed atomically checks and consumes one slot of the fixed window
+// identified by key, returning the Usage left. When the limit is reached it
+// returns a ratelimit.LimitExceededError carrying the time left until the
+// window resets.
+func (rl *RateLimiter) IsAllowed(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error) {
 	rediskey := "rate_limit:" + key
-	val, err := rl.client.Get(ctx, rediskey).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return false, err
+	res, err := fixedWindowScript.Run(ctx, rl.client, []string{rediskey}, cfg.Limit, cfg.WindowSize).Int64Slice()
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("failed to run rate-limiter script: %w", err)
+	}
+	return decide("rate-limiter", res, cfg.Limit)
+}
+
+// IsAllowedBatch is IsAllowed for each of keys, against the rule of the same
+// index, in a single round trip. The requests are counted in order.
+func (rl *RateLimiter) IsAllowedBatch(ctx context.Context, keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error) {
+	rediskeys := make([][]string, len(keys))
+	args := make([][]any, len(keys))
+	for i, key := range keys {
+		rediskeys[i] = []string{"rate_limit:" + key}
+		args[i] = []any{cfgs[i].Limit, cfgs[i].WindowSize}
 	}
 
-	currentCount := 0
-	if err == nil {
-		currentCount, err = strconv.Atoi(val)
-		if err != nil {
-			return false, fmt.Errorf("failed to convert value to int: %w", err)
+	replies, errs := runBatch(ctx, rl.client, fixedWindowScript, rediskeys, args)
+	decisions := make([]ratelimit.Decision, len(keys))
+	for i, res := range replies {
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to run rate-limiter script: %w", errs[i])
+			continue
 		}
+		decisions[i], errs[i] = decide("rate-limiter", res, cfgs[i].Limit)
+	}
+	return decisions, errs
+}
+
+// Refund gives back a slot previously consumed by IsAllowed for key.
+func (rl *RateLimiter) Refund(ctx context.Context, key string, _ config.RLConfig) error {
+	rediskey := "rate_limit:" + key
+	if err := fixedWindowRefundScript.Run(ctx, rl.client, []string{rediskey}).Err(); err != nil {
+		return fmt.Errorf("failed to refund rate-limiter counter: %w", err)
+	}
+	return nil
+}
+
+// Peek returns how much of the fixed window identified by key was used,
+// without consuming it. The window is fully available again once it resets.
+func (rl *RateLimiter) Peek(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+	rediskey := "rate_limit:" + key
+	return peek(ctx, rl.client, fixedWindowPeekScript, []string{rediskey}, cfg.Limit)
+}
+
+// decide returns the Decision of limit described by res, the reply of the
+// IsAllowed script called name: {allowed (0|1), used, retry-after/time until
+// reset in milliseconds}.
+func decide(name string, res []int64, limit int) (ratelimit.Decision, error) {
+	if len(res) != 3 {
+		return ratelimit.Decision{}, fmt.Errorf("unexpected %s script reply: %v", name, res)
 	}
 
-	if currentCount >= limit {
-		// Get TTL to calculate retry-after
-		ttl, err := rl.client.TTL(ctx, rediskey).Result()
-		if err != nil {
-			// Fallback to window size if TTL fails
-			ttl = time.Duration(windowSize) * time.Second
+	if res[0] == 0 {
+		retryAfter := time.Duration(res[2]) * time.Millisecond
+		return ratelimit.Deny(limit, retryAfter), ratelimit.NewLimitExceededError(retryAfter, "rate limit exceeded")
+	}
+
+	return ratelimit.Allow(ratelimit.NewUsage(limit, int(res[1]), time.Duration(res[2])*time.Millisecond)), nil
+}
+
+// runBatch runs script once for each of keys, the keys of a single run, with
+// the args of the same index, in a single pipeline, returning the reply or the
+// error of each run. The ones Redis refuses because it does not have script
+// cached are run again once it is loaded.
+func runBatch(ctx context.Context, client *redis.Client, script *redis.Script, keys [][]string, args [][]any) ([][]int64, []error) {
+	replies := make([][]int64, len(keys))
+	errs := make([]error, len(keys))
+	run := func(indexes []int) {
+		cmds := make([]*redis.Cmd, len(indexes))
+		// Every command reports its own error.
+		_, _ = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for j, i := range indexes {
+				cmds[j] = script.EvalSha(ctx, pipe, keys[i], args[i]...)
+			}
+			return nil
+		})
+		for j, i := range indexes {
+			replies[i], errs[i] = cmds[j].Int64Slice()
 		}
+	}
 
-		return false, ratelimit.NewLimitExceededError(
-			ttl,
-			"rate limit exceeded",
-		)
+	all := make([]int, len(keys))
+	for i := range all {
+		all[i] = i
 	}
+	run(all)
 
-	p := rl.client.TxPipeline()
-	p.Incr(ctx, rediskey)
-	p.ExpireNX(ctx, rediskey, time.Duration(windowSize)*time.Second)
-	_, err = p.Exec(ctx)
-	if err != nil {
-		return false, fmt.Errorf("failed to atomic increment rate-limiter counter: %w", err)
+	var missing []int
+	for i, err := range errs {
+		if redis.HasErrorPrefix(err, "NOSCRIPT") {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return replies, errs
+	}
+	if err := script.Load(ctx, client).Err(); err != nil {
+		for _, i := range missing {
+			errs[i] = err
+		}
+		return replies, errs
 	}
+	run(missing)
+	return replies, errs
+}
 
-	return true, nil
+// peek runs a script replying {used, time until reset in milliseconds} and
+// returns the Usage of limit it describes.
+func peek(ctx context.Context, client *redis.Client, script *redis.Script, keys []string, limit int, args ...any) (ratelimit.Usage, error) {
+	res, err := script.Run(ctx, client, keys, args...).Int64Slice()
+	if err != nil {
+		return ratelimit.Usage{}, fmt.Errorf("failed to run peek script: %w", err)
+	}
+	if len(res) != 2 {
+		return ratelimit.Usage{}, fmt.Errorf("unexpected peek script reply: %v", res)
+	}
+	return ratelimit.NewUsage(limit, int(res[0]), time.Duration(res[1])*time.Millisecond), nil
 }
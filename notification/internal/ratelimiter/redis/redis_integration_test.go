@@ -0,0 +1,336 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func setupRedisContainer(t *testing.T) *redis.Client {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "redis:7-alpine",
+		ExposedPorts: []string{"6379/tcp"},
+		WaitingFor:   wait.ForLog("Ready to accept connections"),
+	}
+
+	redisContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start Redis container: %v", err)
+	}
+
+	host, err := redisContainer.Host(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get container host: %v", err)
+	}
+
+	port, err := redisContainer.MappedPort(ctx, "6379")
+	if err != nil {
+		t.Fatalf("Failed to get container port: %v", err)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", host, port.Port()),
+		PoolSize: 64,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("Failed to connect to Redis: %v", err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		redisContainer.Terminate(ctx)
+	})
+
+	return client
+}
+
+func TestIntegrationIsAllowed_ConcurrentRequestsNeverExceedLimit(t *testing.T) {
+	client := setupRedisContainer(t)
+	limiter := New(client)
+
+	const (
+		goroutines = 500
+		windowSize = 60
+	)
+
+	for _, limit := range []int{1, 3, 50} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			key := model.NotificationTypeNews.GenKey("", uuid.NewString())
+
+			var (
+				allowed atomic.Int64
+				denied  atomic.Int64
+				wg      sync.WaitGroup
+				start   = make(chan struct{})
+			)
+
+			for range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+
+					decision, err := limiter.IsAllowed(context.Background(), key, config.RLConfig{Limit: limit, WindowSize: windowSize})
+					var rateLimitErr *ratelimit.LimitExceededError
+					switch {
+					case decision.Allowed:
+						allowed.Add(1)
+					case errors.As(err, &rateLimitErr):
+						denied.Add(1)
+					default:
+						t.Errorf("unexpected error: %v", err)
+					}
+				}()
+			}
+
+			close(start)
+			wg.Wait()
+
+			if got := allowed.Load(); got != int64(limit) {
+				t.Errorf("expected exactly %d allowed requests, got %d", limit, got)
+			}
+			if got := denied.Load(); got != int64(goroutines-limit) {
+				t.Errorf("expected %d denied requests, got %d", goroutines-limit, got)
+			}
+
+			count, err := client.Get(context.Background(), "rate_limit:"+key).Int()
+			if err != nil {
+				t.Fatalf("failed to read counter: %v", err)
+			}
+			if count != limit {
+				t.Errorf("expected stored counter %d, got %d", limit, count)
+			}
+		})
+	}
+}
+
+func TestIntegrationSlidingLog_NoBurstAcrossWindowBoundary(t *testing.T) {
+	client := setupRedisContainer(t)
+	limiter := NewSlidingLog(client)
+	ctx := context.Background()
+
+	key := model.NotificationTypeStatus.GenKey("", uuid.NewString())
+	limit, windowSize := 2, 2
+
+	for i := range limit {
+		if decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize}); !decision.Allowed {
+			t.Fatalf("request %d: expected to be allowed, got %v", i+1, err)
+		}
+	}
+
+	// Half a window later both entries are still in the log, so the next request
+	// must wait until the oldest one is a full window old.
+	time.Sleep(time.Second)
+
+	decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize})
+	if decision.Allowed {
+		t.Fatal("expected request inside the sliding window to be denied")
+	}
+	var rateLimitErr *ratelimit.LimitExceededError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("expected LimitExceededError, got %T: %v", err, err)
+	}
+	if rateLimitErr.RetryAfter <= 0 || rateLimitErr.RetryAfter > time.Second {
+		t.Errorf("expected RetryAfter in (0, 1s], got %v", rateLimitErr.RetryAfter)
+	}
+
+	time.Sleep(rateLimitErr.RetryAfter + 50*time.Millisecond)
+
+	if decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize}); !decision.Allowed {
+		t.Fatalf("expected request after the oldest entry expired to be allowed, got %v", err)
+	}
+}
+
+func TestIntegrationSlidingCounter_DeniesOverLimit(t *testing.T) {
+	client := setupRedisContainer(t)
+	limiter := NewSlidingCounter(client)
+	ctx := context.Background()
+
+	key := model.NotificationTypeMarketing.GenKey("", uuid.NewString())
+	limit, windowSize := 3, 3600
+
+	for i := range limit {
+		if decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize}); !decision.Allowed {
+			t.Fatalf("request %d: expected to be allowed, got %v", i+1, err)
+		}
+	}
+
+	decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize})
+	if decision.Allowed {
+		t.Fatal("expected request over the limit to be denied")
+	}
+	var rateLimitErr *ratelimit.LimitExceededError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("expected LimitExceededError, got %T: %v", err, err)
+	}
+	if upper := 2 * time.Duration(windowSize) * time.Second; rateLimitErr.RetryAfter <= 0 || rateLimitErr.RetryAfter > upper {
+		t.Errorf("expected RetryAfter in (0, %v], got %v", upper, rateLimitErr.RetryAfter)
+	}
+}
+
+func TestIntegrationSlidingCounter_WeightsThePreviousWindow(t *testing.T) {
+	client := setupRedisContainer(t)
+	limiter := NewSlidingCounter(client)
+	ctx := context.Background()
+
+	key := model.NotificationTypeMarketing.GenKey("", uuid.NewString())
+	cfg := config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: 10, WindowSize: 2}
+	window := 2 * time.Second
+
+	// elapsed returns how far into its fixed window the clock of Redis is.
+	elapsed := func() time.Duration {
+		now, err := client.Time(ctx).Result()
+		if err != nil {
+			t.Fatalf("failed to read the redis clock: %v", err)
+		}
+		return time.Duration(now.UnixNano() % int64(window))
+	}
+
+	// Fill a whole window right after it starts.
+	time.Sleep(window - elapsed() + 10*time.Millisecond)
+	for i := range cfg.Limit {
+		if decision, err := limiter.IsAllowed(ctx, key, cfg); !decision.Allowed {
+			t.Fatalf("request %d: expected to be allowed, got %v", i+1, err)
+		}
+	}
+	if decision, _ := limiter.IsAllowed(ctx, key, cfg); decision.Allowed {
+		t.Fatal("expected request over the limit to be denied")
+	}
+
+	// Halfway through the next window, the full one still weighs
+	// limit * (window - elapsed) / window, which leaves
+	// floor(limit * elapsed / window) requests.
+	time.Sleep(window - elapsed() + window/2)
+	from := elapsed()
+	allowed := 0
+	for {
+		if decision, _ := limiter.IsAllowed(ctx, key, cfg); !decision.Allowed {
+			break
+		}
+		allowed++
+	}
+	to := elapsed()
+
+	least := int(time.Duration(cfg.Limit) * from / window)
+	most := int(time.Duration(cfg.Limit) * to / window)
+	if allowed < least || allowed > most {
+		t.Errorf("expected %d to %d requests allowed %v to %v into the next window, got %d", least, most, from, to, allowed)
+	}
+}
+
+func TestIntegrationGCRA_BurstThenSteadyRate(t *testing.T) {
+	client := setupRedisContainer(t)
+	limiter := NewGCRA(client)
+	ctx := context.Background()
+
+	key := model.NotificationTypeStatus.GenKey("", uuid.NewString())
+	// A burst of 3, then one every second.
+	cfg := config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 3, Rate: 1, WindowSize: 1}
+
+	for i := range cfg.Burst {
+		if decision, err := limiter.IsAllowed(ctx, key, cfg); !decision.Allowed {
+			t.Fatalf("request %d: expected burst to be allowed, got %v", i+1, err)
+		}
+	}
+
+	decision, err := limiter.IsAllowed(ctx, key, cfg)
+	if decision.Allowed {
+		t.Fatal("expected request after the burst to be denied")
+	}
+	var rateLimitErr *ratelimit.LimitExceededError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("expected LimitExceededError, got %T: %v", err, err)
+	}
+	if rateLimitErr.RetryAfter <= 0 || rateLimitErr.RetryAfter > time.Second {
+		t.Errorf("expected RetryAfter in (0, 1s], got %v", rateLimitErr.RetryAfter)
+	}
+
+	time.Sleep(rateLimitErr.RetryAfter + 50*time.Millisecond)
+
+	if decision, err := limiter.IsAllowed(ctx, key, cfg); !decision.Allowed {
+		t.Fatalf("expected one request per interval after the burst, got %v", err)
+	}
+	if decision, _ := limiter.IsAllowed(ctx, key, cfg); decision.Allowed {
+		t.Fatal("expected only a single replenished cell")
+	}
+}
+
+func TestIntegrationRules_DeniedSendConsumesNoRule(t *testing.T) {
+	client := setupRedisContainer(t)
+	limiter := NewRules(client)
+	ctx := context.Background()
+
+	recipient := uuid.NewString()
+	global := model.GenGlobalKey(recipient)
+	globalCfg := config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 10, WindowSize: 60}
+	rules := map[string]config.RLConfig{
+		model.NotificationTypeStatus.GenKey("", recipient): {Limit: 5, WindowSize: 60},
+		model.NotificationTypeNews.GenKey("", recipient):   {Algorithm: config.AlgorithmGCRA, Burst: 100, Rate: 1, WindowSize: 1},
+	}
+
+	const sendsPerType = 100
+	var (
+		allowed = make(map[string]*atomic.Int64)
+		wg      sync.WaitGroup
+		start   = make(chan struct{})
+	)
+	for key := range rules {
+		allowed[key] = &atomic.Int64{}
+	}
+	for range sendsPerType {
+		for key, cfg := range rules {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				decisions, errs := limiter.IsAllowedAll(ctx, [][]string{{key, global}}, [][]config.RLConfig{{cfg, globalCfg}})
+				for _, err := range errs[0] {
+					var rateLimitErr *ratelimit.LimitExceededError
+					if err != nil && !errors.As(err, &rateLimitErr) {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}
+				if decisions[0][0].Allowed && decisions[0][1].Allowed {
+					allowed[key].Add(1)
+				}
+			}()
+		}
+	}
+	close(start)
+	wg.Wait()
+
+	var total int64
+	for _, n := range allowed {
+		total += n.Load()
+	}
+	if total != int64(globalCfg.Limit) {
+		t.Errorf("expected exactly %d allowed sends, got %d", globalCfg.Limit, total)
+	}
+	if used, _ := client.ZCard(ctx, "rate_limit:sliding_log:"+global).Result(); used != int64(globalCfg.Limit) {
+		t.Errorf("expected the global cap to count %d sends, got %d", globalCfg.Limit, used)
+	}
+	status := model.NotificationTypeStatus.GenKey("", recipient)
+	if used, _ := client.Get(ctx, "rate_limit:"+status).Int64(); used != allowed[status].Load() {
+		t.Errorf("expected the status rule to count its %d allowed sends only, got %d", allowed[status].Load(), used)
+	}
+}
@@ -6,63 +6,70 @@ import (
 	"testing"
 	"time"
 
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
 	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
 	"github.com/go-redis/redismock/v9"
 	"github.com/redis/go-redis/v9"
 )
 
+// noScriptError mimics the error returned by redis when EVALSHA is called for
+// a script that is not loaded in the script cache.
+type noScriptError struct{}
+
+func (noScriptError) Error() string { return "NOSCRIPT No matching script. Please use EVAL." }
+
+func (noScriptError) RedisError() {}
+
 func TestIsAllowed_Table(t *testing.T) {
 	ctx := context.Background()
 
 	tests := []struct {
 		name            string
-		redisVal        string
-		redisErr        error
-		ttlDuration     time.Duration
-		ttlErr          error
-		expectIncr      bool
+		reply           []any
+		scriptErr       error
+		noScript        bool
 		expectAllow     bool
 		expectErr       bool
 		expectRateLimit bool
+		expectRetry     time.Duration
+		expectUsage     ratelimit.Usage
 	}{
 		{
 			name:        "First request - key does not exist",
-			redisErr:    redis.Nil,
-			expectIncr:  true,
+			reply:       []any{int64(1), int64(1), int64(60000)},
 			expectAllow: true,
+			expectUsage: ratelimit.NewUsage(3, 1, time.Minute),
 		},
 		{
 			name:        "Key exists and below limit",
-			redisVal:    "2",
-			expectIncr:  true,
+			reply:       []any{int64(1), int64(3), int64(30000)},
 			expectAllow: true,
+			expectUsage: ratelimit.NewUsage(3, 3, 30*time.Second),
 		},
 		{
 			name:            "Key exists and at limit - with TTL",
-			redisVal:        "3",
-			ttlDuration:     45 * time.Second,
-			expectIncr:      false,
+			reply:           []any{int64(0), int64(3), int64(45000)},
 			expectAllow:     false,
 			expectRateLimit: true,
+			expectRetry:     45 * time.Second,
 		},
 		{
-			name:            "Key exists and at limit - TTL error fallback",
-			redisVal:        "3",
-			ttlErr:          errors.New("ttl failed"),
-			expectIncr:      false,
-			expectAllow:     false,
-			expectRateLimit: true,
+			name:        "Script not cached - falls back to EVAL",
+			reply:       []any{int64(1), int64(1), int64(60000)},
+			noScript:    true,
+			expectAllow: true,
+			expectUsage: ratelimit.NewUsage(3, 1, time.Minute),
 		},
 		{
-			name:        "Invalid redis value",
-			redisVal:    "not-a-number",
+			name:        "Unexpected script reply",
+			reply:       []any{int64(1)},
 			expectErr:   true,
 			expectAllow: false,
 		},
 		{
-			name:        "Redis GET returns unexpected error",
-			redisErr:    errors.New("connection dropped"),
+			name:        "Redis returns unexpected error",
+			scriptErr:   errors.New("connection dropped"),
 			expectErr:   true,
 			expectAllow: false,
 		},
@@ -74,37 +81,22 @@ func TestIsAllowed_Table(t *testing.T) {
 			limiter := New(client)
 
 			id := "968af933-64e3-4890-bd3c-50158bdadf0c"
-			key := model.NotificationTypeStatus.GenKey(id)
+			key := model.NotificationTypeStatus.GenKey("", id)
 			redisKey := "rate_limit:" + key
-			windowSize := 60
-
-			if tt.redisErr != nil {
-				if errors.Is(tt.redisErr, redis.Nil) {
-					mock.ExpectGet(redisKey).RedisNil()
-				} else {
-					mock.ExpectGet(redisKey).SetErr(tt.redisErr)
-				}
-			} else {
-				mock.ExpectGet(redisKey).SetVal(tt.redisVal)
-			}
+			limit, windowSize := 3, 60
 
-			// If rate limited, expect TTL call
-			if tt.expectRateLimit {
-				if tt.ttlErr != nil {
-					mock.ExpectTTL(redisKey).SetErr(tt.ttlErr)
-				} else {
-					mock.ExpectTTL(redisKey).SetVal(tt.ttlDuration)
-				}
+			evalSha := mock.ExpectEvalSha(fixedWindowScript.Hash(), []string{redisKey}, limit, windowSize)
+			switch {
+			case tt.scriptErr != nil:
+				evalSha.SetErr(tt.scriptErr)
+			case tt.noScript:
+				evalSha.SetErr(noScriptError{})
+				mock.ExpectEval(fixedWindowLua, []string{redisKey}, limit, windowSize).SetVal(tt.reply)
+			default:
+				evalSha.SetVal(tt.reply)
 			}
 
-			if tt.expectIncr {
-				mock.ExpectTxPipeline()
-				mock.ExpectIncr(redisKey).SetVal(1)
-				mock.ExpectExpireNX(redisKey, time.Duration(windowSize)*time.Second).SetVal(true)
-				mock.ExpectTxPipelineExec()
-			}
-
-			allowed, err := limiter.IsAllowed(ctx, key, 3, windowSize)
+			decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize})
 
 			if tt.expectErr && err == nil {
 				t.Errorf("expected error, got none")
@@ -112,8 +104,11 @@ func TestIsAllowed_Table(t *testing.T) {
 			if !tt.expectErr && err != nil && !tt.expectRateLimit {
 				t.Errorf("unexpected error: %v", err)
 			}
-			if allowed != tt.expectAllow {
-				t.Errorf("expected allowed = %v, got %v", tt.expectAllow, allowed)
+			if decision.Allowed != tt.expectAllow {
+				t.Errorf("expected allowed = %v, got %v", tt.expectAllow, decision.Allowed)
+			}
+			if tt.expectAllow && decision.Usage != tt.expectUsage {
+				t.Errorf("expected usage %+v, got %+v", tt.expectUsage, decision.Usage)
 			}
 
 			// Check rate limit error specifics
@@ -121,15 +116,8 @@ func TestIsAllowed_Table(t *testing.T) {
 				var rateLimitErr *ratelimit.LimitExceededError
 				if !errors.As(err, &rateLimitErr) {
 					t.Errorf("expected LimitExceededError, got %T: %v", err, err)
-				} else {
-					expectedRetryAfter := tt.ttlDuration
-					if tt.ttlErr != nil {
-						expectedRetryAfter = time.Duration(windowSize) * time.Second
-					}
-
-					if rateLimitErr.RetryAfter != expectedRetryAfter {
-						t.Errorf("expected RetryAfter %v, got %v", expectedRetryAfter, rateLimitErr.RetryAfter)
-					}
+				} else if rateLimitErr.RetryAfter != tt.expectRetry {
+					t.Errorf("expected RetryAfter %v, got %v", tt.expectRetry, rateLimitErr.RetryAfter)
 				}
 			}
 
@@ -146,16 +134,16 @@ func TestIsAllowed_RetryAfterCalculation(t *testing.T) {
 	limiter := New(client)
 
 	id := "test-user"
-	key := model.NotificationTypeNews.GenKey(id)
+	key := model.NotificationTypeNews.GenKey("", id)
 	redisKey := "rate_limit:" + key
 
 	// Mock rate limit exceeded scenario
-	mock.ExpectGet(redisKey).SetVal("5") // Above limit of 3
-	mock.ExpectTTL(redisKey).SetVal(30 * time.Second)
+	mock.ExpectEvalSha(fixedWindowScript.Hash(), []string{redisKey}, 3, 60).
+		SetVal([]any{int64(0), int64(5), int64(30000)})
 
-	allowed, err := limiter.IsAllowed(ctx, key, 3, 60)
+	decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: 3, WindowSize: 60})
 
-	if allowed {
+	if decision.Allowed {
 		t.Error("expected request to be denied")
 	}
 
@@ -172,3 +160,229 @@ func TestIsAllowed_RetryAfterCalculation(t *testing.T) {
 		t.Errorf("unmet redis expectations: %v", err)
 	}
 }
+
+func TestIsAllowedBatch(t *testing.T) {
+	ctx := context.Background()
+	client, mock := redismock.NewClientMock()
+	limiter := New(client)
+
+	keys := []string{
+		model.NotificationTypeStatus.GenKey("", "user-1"),
+		model.NotificationTypeStatus.GenKey("", "user-2"),
+	}
+	mock.ExpectEvalSha(fixedWindowScript.Hash(), []string{"rate_limit:" + keys[0]}, 3, 60).
+		SetVal([]any{int64(1), int64(2), int64(30000)})
+	mock.ExpectEvalSha(fixedWindowScript.Hash(), []string{"rate_limit:" + keys[1]}, 1, 60).
+		SetVal([]any{int64(0), int64(1), int64(45000)})
+
+	decisions, errs := limiter.IsAllowedBatch(ctx, keys, []config.RLConfig{{Limit: 3, WindowSize: 60}, {Limit: 1, WindowSize: 60}})
+
+	if errs[0] != nil || decisions[0] != ratelimit.Allow(ratelimit.NewUsage(3, 2, 30*time.Second)) {
+		t.Errorf("expected the first key to be allowed, got %+v, %v", decisions[0], errs[0])
+	}
+	var rateLimitErr *ratelimit.LimitExceededError
+	if !errors.As(errs[1], &rateLimitErr) || rateLimitErr.RetryAfter != 45*time.Second {
+		t.Errorf("expected LimitExceededError retrying after 45s, got %v", errs[1])
+	}
+	if decisions[1].Allowed {
+		t.Error("expected the second key to be denied")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet redis expectations: %v", err)
+	}
+}
+
+func TestIsAllowedBatch_LoadsMissingScript(t *testing.T) {
+	ctx := context.Background()
+	client, mock := redismock.NewClientMock()
+	limiter := New(client)
+
+	key := model.NotificationTypeStatus.GenKey("", "user-1")
+	mock.ExpectEvalSha(fixedWindowScript.Hash(), []string{"rate_limit:" + key}, 3, 60).SetErr(noScriptError{})
+	mock.ExpectScriptLoad(fixedWindowLua).SetVal(fixedWindowScript.Hash())
+	mock.ExpectEvalSha(fixedWindowScript.Hash(), []string{"rate_limit:" + key}, 3, 60).
+		SetVal([]any{int64(1), int64(1), int64(60000)})
+
+	decisions, errs := limiter.IsAllowedBatch(ctx, []string{key}, []config.RLConfig{{Limit: 3, WindowSize: 60}})
+
+	if errs[0] != nil || !decisions[0].Allowed {
+		t.Errorf("expected the key to be allowed once the script is loaded, got %+v, %v", decisions[0], errs[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet redis expectations: %v", err)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+	key := model.NotificationTypeStatus.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+	gcraCfg := config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 3, Rate: 1, WindowSize: 30}
+
+	tests := []struct {
+		name   string
+		expect func(mock redismock.ClientMock, err error)
+		refund func(client *redis.Client) error
+	}{
+		{
+			name: "fixed window",
+			expect: func(mock redismock.ClientMock, err error) {
+				cmd := mock.ExpectEvalSha(fixedWindowRefundScript.Hash(), []string{"rate_limit:" + key})
+				if err != nil {
+					cmd.SetErr(err)
+					return
+				}
+				cmd.SetVal(int64(0))
+			},
+			refund: func(client *redis.Client) error {
+				return New(client).Refund(ctx, key, config.RLConfig{Limit: 1, WindowSize: 60})
+			},
+		},
+		{
+			name: "sliding log",
+			expect: func(mock redismock.ClientMock, err error) {
+				cmd := mock.ExpectZPopMax("rate_limit:sliding_log:" + key)
+				if err != nil {
+					cmd.SetErr(err)
+					return
+				}
+				cmd.SetVal([]redis.Z{{Score: 1, Member: "1.0-0"}})
+			},
+			refund: func(client *redis.Client) error {
+				return NewSlidingLog(client).Refund(ctx, key, config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 1, WindowSize: 60})
+			},
+		},
+		{
+			name: "sliding window counter",
+			expect: func(mock redismock.ClientMock, err error) {
+				cmd := mock.ExpectEvalSha(slidingCounterRefundScript.Hash(), []string{"rate_limit:sliding_counter:" + key})
+				if err != nil {
+					cmd.SetErr(err)
+					return
+				}
+				cmd.SetVal(int64(0))
+			},
+			refund: func(client *redis.Client) error {
+				return NewSlidingCounter(client).Refund(ctx, key, config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: 1, WindowSize: 60})
+			},
+		},
+		{
+			name: "gcra",
+			expect: func(mock redismock.ClientMock, err error) {
+				cmd := mock.ExpectEvalSha(gcraRefundScript.Hash(), []string{"rate_limit:gcra:" + key}, int64(30000))
+				if err != nil {
+					cmd.SetErr(err)
+					return
+				}
+				cmd.SetVal(int64(0))
+			},
+			refund: func(client *redis.Client) error {
+				return NewGCRA(client).Refund(ctx, key, gcraCfg)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			tt.expect(mock, nil)
+			if err := tt.refund(client); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+
+		t.Run(tt.name+" - redis error", func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			tt.expect(mock, errors.New("connection dropped"))
+			if err := tt.refund(client); err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	ctx := context.Background()
+	key := model.NotificationTypeStatus.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+
+	tests := []struct {
+		name   string
+		peek   func(client *redis.Client) (ratelimit.Usage, error)
+		expect func(mock redismock.ClientMock) *redismock.ExpectedCmd
+	}{
+		{
+			name: "fixed window",
+			peek: func(client *redis.Client) (ratelimit.Usage, error) {
+				return New(client).Peek(ctx, key, config.RLConfig{Limit: 3, WindowSize: 60})
+			},
+			expect: func(mock redismock.ClientMock) *redismock.ExpectedCmd {
+				return mock.ExpectEvalSha(fixedWindowPeekScript.Hash(), []string{"rate_limit:" + key})
+			},
+		},
+		{
+			name: "sliding log",
+			peek: func(client *redis.Client) (ratelimit.Usage, error) {
+				return NewSlidingLog(client).Peek(ctx, key, config.RLConfig{Algorithm: config.AlgorithmSlidingLog, Limit: 3, WindowSize: 60})
+			},
+			expect: func(mock redismock.ClientMock) *redismock.ExpectedCmd {
+				return mock.ExpectEvalSha(slidingLogPeekScript.Hash(), []string{"rate_limit:sliding_log:" + key}, 60)
+			},
+		},
+		{
+			name: "sliding window counter",
+			peek: func(client *redis.Client) (ratelimit.Usage, error) {
+				return NewSlidingCounter(client).Peek(ctx, key, config.RLConfig{Algorithm: config.AlgorithmSlidingCounter, Limit: 3, WindowSize: 60})
+			},
+			expect: func(mock redismock.ClientMock) *redismock.ExpectedCmd {
+				return mock.ExpectEvalSha(slidingCounterPeekScript.Hash(), []string{"rate_limit:sliding_counter:" + key}, 60)
+			},
+		},
+		{
+			name: "gcra",
+			peek: func(client *redis.Client) (ratelimit.Usage, error) {
+				return NewGCRA(client).Peek(ctx, key, config.RLConfig{Algorithm: config.AlgorithmGCRA, Burst: 3, Rate: 1, WindowSize: 30})
+			},
+			expect: func(mock redismock.ClientMock) *redismock.ExpectedCmd {
+				return mock.ExpectEvalSha(gcraPeekScript.Hash(), []string{"rate_limit:gcra:" + key}, int64(30000))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			tt.expect(mock).SetVal([]any{int64(2), int64(40000)})
+
+			usage, err := tt.peek(client)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := ratelimit.Usage{Limit: 3, Used: 2, Remaining: 1, ResetAfter: 40 * time.Second}
+			if usage != expected {
+				t.Errorf("expected %+v, got %+v", expected, usage)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+
+		t.Run(tt.name+" - unexpected reply", func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			tt.expect(mock).SetVal([]any{int64(2)})
+			if _, err := tt.peek(client); err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+
+		t.Run(tt.name+" - redis error", func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			tt.expect(mock).SetErr(errors.New("connection dropped"))
+			if _, err := tt.peek(client); err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// rulesLua checks many rules, of any algorithm, and consumes one request from
+// all of them only when every one allows it. Each rule is first checked
+// without being written, as the script of its algorithm would, and the writes
+// are only made once all of them passed, so a denied request counts against
+// none of them and no other caller ever sees some of them consumed.
+//
+// KEYS[i]          - key of the i-th rule, the one its algorithm's rateLimiter uses
+// ARGV[3 * i - 2]  - algorithm of the i-th rule
+// ARGV[3 * i - 1]  - limit, or burst for gcra
+// ARGV[3 * i]      - window size in seconds, or emission interval in milliseconds for gcra
+//
+// Returns the reply of the script of each rule's algorithm, flattened:
+// {allowed (0|1), used, retry-after/time until reset in milliseconds} for
+// each rule, gcra replying the remaining burst instead of the used one. The
+// rules that allowed reply as if they were consumed, even when another one
+// denied.
+const rulesLua = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local checks = {}
+
+checks.fixed_window = function(key, limit, window)
+	window = window * 1000
+	local current = tonumber(redis.call('GET', key) or '0')
+	local ttl = redis.call('PTTL', key)
+	if current >= limit then
+		if ttl < 0 then
+			redis.call('PEXPIRE', key, window)
+			ttl = window
+		end
+		return {0, current, ttl}
+	end
+	if ttl < 0 then
+		ttl = window
+	end
+	return {1, current + 1, ttl}, function()
+		redis.call('INCR', key)
+		if redis.call('PTTL', key) < 0 then
+			redis.call('PEXPIRE', key, window)
+		end
+	end
+end
+
+checks.sliding_log = function(key, limit, window)
+	window = window * 1000
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	if count >= limit then
+		local retry = window
+		local freeing = redis.call('ZRANGE', key, count - limit, count - limit, 'WITHSCORES')
+		if #freeing > 0 then
+			retry = tonumber(freeing[2]) + window - now
+		end
+		return {0, count, retry}
+	end
+	return {1, count + 1, window}, function()
+		redis.call('ZADD', key, now, t[1] .. '.' .. t[2] .. '-' .. count)
+		redis.call('PEXPIRE', key, window)
+	end
+end
+
+checks.sliding_window_counter = function(key, limit, window)
+	window = window * 1000
+	local bucket = math.floor(now / window)
+	local elapsed = now - bucket * window
+	local state = redis.call('HMGET', key, 'bucket', 'curr', 'prev')
+	local stored = tonumber(state[1])
+	local curr = tonumber(state[2]) or 0
+	local prev = tonumber(state[3]) or 0
+	if stored ~= bucket then
+		if stored == bucket - 1 then
+			prev = curr
+		else
+			prev = 0
+		end
+		curr = 0
+	end
+	local estimate = prev * (window - elapsed) / window + curr
+	if estimate + 1 > limit then
+		local retry
+		if curr + 1 <= limit then
+			retry = math.ceil(window - (limit - curr - 1) * window / prev - elapsed)
+		else
+			retry = window - elapsed
+			local decay = window - (limit - 1) * window / curr
+			if decay > 0 then
+				retry = retry + math.ceil(decay)
+			end
+		end
+		return {0, math.floor(estimate), retry}
+	end
+	return {1, math.floor(estimate + 1), window * 2 - elapsed}, function()
+		redis.call('HSET', key, 'bucket', bucket, 'curr', curr + 1, 'prev', prev)
+		redis.call('PEXPIRE', key, window * 2)
+	end
+end
+
+checks.gcra = function(key, burst, interval)
+	local tat = tonumber(redis.call('GET', key) or now)
+	if tat < now then
+		tat = now
+	end
+	local newTat = tat + interval
+	local allowAt = newTat - burst * interval
+	if allowAt > now then
+		return {0, 0, allowAt - now}
+	end
+	return {1, math.floor((now - allowAt) / interval), newTat - now}, function()
+		redis.call('SET', key, newTat, 'PX', newTat - now)
+	end
+end
+
+local replies = {}
+local commits = {}
+local allowed = true
+for i, key in ipairs(KEYS) do
+	local base = (i - 1) * 3
+	local reply, commit = checks[ARGV[base + 1]](key, tonumber(ARGV[base + 2]), tonumber(ARGV[base + 3]))
+	if reply[1] == 0 then
+		allowed = false
+	end
+	commits[#commits + 1] = commit
+	replies[base + 1], replies[base + 2], replies[base + 3] = reply[1], reply[2], reply[3]
+end
+if allowed then
+	for _, commit in ipairs(commits) do
+		commit()
+	end
+end
+return replies
+`
+
+var rulesScript = redis.NewScript(rulesLua)
+
+// keyPrefixes holds the prefix of the keys the rateLimiter of each algorithm
+// counts under, so the ones RulesRateLimiter consumes can be refunded and
+// peeked by them.
+var keyPrefixes = map[config.Algorithm]string{
+	config.AlgorithmFixedWindow:    "rate_limit:",
+	config.AlgorithmSlidingLog:     "rate_limit:sliding_log:",
+	config.AlgorithmSlidingCounter: "rate_limit:sliding_counter:",
+	config.AlgorithmGCRA:           "rate_limit:gcra:",
+}
+
+// RulesRateLimiter defines a redis-based rate-limiter consuming many rules, of
+// any algorithm, from all of them or from none at once. It counts under the
+// same keys as the rate-limiter of each algorithm, which refund and peek what
+// it consumed.
+type RulesRateLimiter struct {
+	client *redis.Client
+}
+
+// NewRules creates a redis-based rate-limiter consuming many rules at once.
+func NewRules(client *redis.Client) *RulesRateLimiter {
+	return &RulesRateLimiter{client}
+}
+
+// IsAllowedAll checks the rules of each request, keys[i][j] against
+// cfgs[i][j], in a single round trip. A request is only counted when every one
+// of its rules allows it, atomically: it then consumes one from all of them,
+// else from none. Requests are counted in order.
+//
+// It returns the Decision and the error of each rule. The rules that allowed a
+// denied request report the Usage it would have left.
+func (rl *RulesRateLimiter) IsAllowedAll(ctx context.Context, keys [][]string, cfgs [][]config.RLConfig) ([][]ratelimit.Decision, [][]error) {
+	decisions := make([][]ratelimit.Decision, len(keys))
+	errs := make([][]error, len(keys))
+
+	var (
+		runs      []int
+		rediskeys [][]string
+		args      [][]any
+	)
+	for i := range keys {
+		decisions[i] = make([]ratelimit.Decision, len(keys[i]))
+		errs[i] = make([]error, len(keys[i]))
+		if len(keys[i]) == 0 {
+			continue
+		}
+
+		ks, as, err := rulesArgs(keys[i], cfgs[i])
+		if err != nil {
+			for j := range errs[i] {
+				errs[i][j] = err
+			}
+			continue
+		}
+		runs = append(runs, i)
+		rediskeys = append(rediskeys, ks)
+		args = append(args, as)
+	}
+
+	if len(runs) == 0 {
+		return decisions, errs
+	}
+	replies, runErrs := runBatch(ctx, rl.client, rulesScript, rediskeys, args)
+	for r, i := range runs {
+		err := runErrs[r]
+		if err == nil && len(replies[r]) != 3*len(keys[i]) {
+			err = fmt.Errorf("unexpected rules script reply: %v", replies[r])
+		}
+		if err != nil {
+			for j := range errs[i] {
+				errs[i][j] = fmt.Errorf("failed to run rules script: %w", err)
+			}
+			continue
+		}
+
+		for j, cfg := range cfgs[i] {
+			res := replies[r][3*j : 3*j+3]
+			if cfg.GetAlgorithm() == config.AlgorithmGCRA {
+				decisions[i][j], errs[i][j] = decideGCRA(res, cfg.Burst)
+			} else {
+				decisions[i][j], errs[i][j] = decide("rules", res, cfg.Limit)
+			}
+		}
+	}
+	return decisions, errs
+}
+
+// rulesArgs returns the keys and the arguments of rulesScript checking each
+// of keys against the rule of the same index.
+func rulesArgs(keys []string, cfgs []config.RLConfig) ([]string, []any, error) {
+	rediskeys := make([]string, len(keys))
+	args := make([]any, 0, 3*len(keys))
+	for i, key := range keys {
+		cfg := cfgs[i]
+		algorithm := cfg.GetAlgorithm()
+		prefix, ok := keyPrefixes[algorithm]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported rate-limiting algorithm %q", algorithm)
+		}
+		rediskeys[i] = prefix + key
+		if algorithm == config.AlgorithmGCRA {
+			args = append(args, string(algorithm), cfg.Burst, cfg.EmissionInterval().Milliseconds())
+		} else {
+			args = append(args, string(algorithm), cfg.Limit, cfg.WindowSize)
+		}
+	}
+	return rediskeys, args, nil
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/go-redis/redismock/v9"
+)
+
+func TestRulesIsAllowedAll(t *testing.T) {
+	ctx := context.Background()
+	client, mock := redismock.NewClientMock()
+	limiter := NewRules(client)
+
+	typeKey := model.NotificationTypeStatus.GenKey("", "user-1")
+	globalKey := model.GenGlobalKey("user-1")
+	rules := []config.RLConfig{
+		{Algorithm: config.AlgorithmGCRA, Burst: 5, Rate: 1, WindowSize: 30},
+		{Algorithm: config.AlgorithmSlidingLog, Limit: 3, WindowSize: 60},
+	}
+	rediskeys := []string{"rate_limit:gcra:" + typeKey, "rate_limit:sliding_log:" + globalKey}
+	args := []any{"gcra", 5, int64(30000), "sliding_log", 3, 60}
+
+	// Both rules allow the first send, the global cap denies the second one.
+	mock.ExpectEvalSha(rulesScript.Hash(), rediskeys, args...).
+		SetVal([]any{int64(1), int64(4), int64(30000), int64(1), int64(3), int64(60000)})
+	mock.ExpectEvalSha(rulesScript.Hash(), rediskeys, args...).
+		SetVal([]any{int64(1), int64(3), int64(60000), int64(0), int64(3), int64(15000)})
+
+	keys := [][]string{{typeKey, globalKey}, {typeKey, globalKey}}
+	decisions, errs := limiter.IsAllowedAll(ctx, keys, [][]config.RLConfig{rules, rules})
+
+	if errs[0][0] != nil || decisions[0][0] != ratelimit.Allow(ratelimit.NewUsage(5, 1, 30*time.Second)) {
+		t.Errorf("expected the type rule to allow the first send, got %+v, %v", decisions[0][0], errs[0][0])
+	}
+	if errs[0][1] != nil || decisions[0][1] != ratelimit.Allow(ratelimit.NewUsage(3, 3, time.Minute)) {
+		t.Errorf("expected the global rule to allow the first send, got %+v, %v", decisions[0][1], errs[0][1])
+	}
+	if errs[1][0] != nil || !decisions[1][0].Allowed {
+		t.Errorf("expected the type rule to allow the second send, got %+v, %v", decisions[1][0], errs[1][0])
+	}
+	var rateLimitErr *ratelimit.LimitExceededError
+	if !errors.As(errs[1][1], &rateLimitErr) || rateLimitErr.RetryAfter != 15*time.Second {
+		t.Errorf("expected LimitExceededError retrying after 15s, got %v", errs[1][1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet redis expectations: %v", err)
+	}
+}
+
+func TestRulesIsAllowedAll_Errors(t *testing.T) {
+	ctx := context.Background()
+	client, mock := redismock.NewClientMock()
+	limiter := NewRules(client)
+
+	key := model.NotificationTypeStatus.GenKey("", "user-1")
+	rule := config.RLConfig{Limit: 3, WindowSize: 60}
+	mock.ExpectEvalSha(rulesScript.Hash(), []string{"rate_limit:" + key, "rate_limit:" + key}, "fixed_window", 3, 60, "fixed_window", 3, 60).
+		SetVal([]any{int64(1), int64(1), int64(60000)})
+
+	keys := [][]string{{key, key}, {key}}
+	cfgs := [][]config.RLConfig{{rule, rule}, {{Algorithm: "leaky_bucket", Limit: 1, WindowSize: 1}}}
+	_, errs := limiter.IsAllowedAll(ctx, keys, cfgs)
+
+	for i, send := range []string{"a reply of the wrong length", "an unsupported algorithm"} {
+		for j, err := range errs[i] {
+			var rateLimitErr *ratelimit.LimitExceededError
+			if err == nil || errors.As(err, &rateLimitErr) {
+				t.Errorf("expected rule %d to fail on %s, got %v", j, send, err)
+			}
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet redis expectations: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingCounterLua approximates a sliding window with two fixed-window
+// counters: the previous window's count is weighted by how much of it still
+// overlaps the sliding window. Both counters live in a single hash so each
+// key costs a constant amount of memory regardless of the limit.
+//
+// As the previous window's requests are assumed to be spread evenly over it,
+// no more than limit are let through in a fixed window but up to 2 * limit - 1
+// in a sliding one, when a full window lands right before its end and requests
+// keep coming after it.
+//
+// KEYS[1] - hash key holding {bucket, curr, prev}
+// ARGV[1] - limit
+// ARGV[2] - window size in seconds
+//
+// Returns {allowed (0|1), estimated count, retry-after/time until nothing counts in milliseconds}.
+const slidingCounterLua = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2]) * 1000
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local bucket = math.floor(now / window)
+local elapsed = now - bucket * window
+
+local state = redis.call('HMGET', KEYS[1], 'bucket', 'curr', 'prev')
+local stored = tonumber(state[1])
+local curr = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if stored ~= bucket then
+	if stored == bucket - 1 then
+		prev = curr
+	else
+		prev = 0
+	end
+	curr = 0
+end
+
+local estimate = prev * (window - elapsed) / window + curr
+if estimate + 1 > limit then
+	local retry
+	if curr + 1 <= limit then
+		-- wait for the previous window's weight to decay enough
+		retry = math.ceil(window - (limit - curr - 1) * window / prev - elapsed)
+	else
+		-- the current window alone is full, wait for the next one
+		retry = window - elapsed
+		local decay = window - (limit - 1) * window / curr
+		if decay > 0 then
+			retry = retry + math.ceil(decay)
+		end
+	end
+	return {0, math.floor(estimate), retry}
+end
+
+curr = curr + 1
+redis.call('HSET', KEYS[1], 'bucket', bucket, 'curr', curr, 'prev', prev)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {1, math.floor(estimate + 1), window * 2 - elapsed}
+`
+
+var slidingCounterScript = redis.NewScript(slidingCounterLua)
+
+// slidingCounterRefundLua gives back one request of the most recent window,
+// never going below zero.
+//
+// KEYS[1] - hash key holding {bucket, curr, prev}
+const slidingCounterRefundLua = `
+local curr = tonumber(redis.call('HGET', KEYS[1], 'curr') or '0')
+if curr > 0 then
+	return redis.call('HINCRBY', KEYS[1], 'curr', -1)
+end
+return 0
+`
+
+var slidingCounterRefundScript = redis.NewScript(slidingCounterRefundLua)
+
+// slidingCounterPeekLua estimates the weighted count of the sliding window as
+// slidingCounterLua does, without counting a request. Nothing counts anymore
+// once the current fixed window is the previous one and has fully decayed.
+//
+// KEYS[1] - hash key holding {bucket, curr, prev}
+// ARGV[1] - window size in seconds
+//
+// Returns {estimated count, time until nothing counts in milliseconds}.
+const slidingCounterPeekLua = `
+local window = tonumber(ARGV[1]) * 1000
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local bucket = math.floor(now / window)
+local elapsed = now - bucket * window
+
+local state = redis.call('HMGET', KEYS[1], 'bucket', 'curr', 'prev')
+local stored = tonumber(state[1])
+local curr = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if stored ~= bucket then
+	if stored == bucket - 1 then
+		prev = curr
+	else
+		prev = 0
+	end
+	curr = 0
+end
+
+local reset = 0
+if curr > 0 then
+	reset = 2 * window - elapsed
+elseif prev > 0 then
+	reset = window - elapsed
+end
+return {math.floor(prev * (window - elapsed) / window + curr), reset}
+`
+
+var slidingCounterPeekScript = redis.NewScript(slidingCounterPeekLua)
+
+// SlidingCounterRateLimiter defines a redis-based sliding-window-counter
+// rate-limiter. It trades the exactness of SlidingLogRateLimiter for constant
+// memory per key, assuming requests in the previous window were evenly spread.
+type SlidingCounterRateLimiter struct {
+	client *redis.Client
+}
+
+// NewSlidingCounter creates a redis-based sliding-window-counter rate-limiter
+func NewSlidingCounter(client *redis.Client) *SlidingCounterRateLimiter {
+	return &SlidingCounterRateLimiter{client}
+}
+
+// IsAllowed atomically checks and counts a request against the weighted
+// sliding window identified by key, returning the Usage left. When the limit
+// is reached it returns a ratelimit.LimitExceededError carrying the estimated
+// time until the weighted count drops enough to accept another request.
+func (rl *SlidingCounterRateLimiter) IsAllowed(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error) {
+	rediskey := "rate_limit:sliding_counter:" + key
+	res, err := slidingCounterScript.Run(ctx, rl.client, []string{rediskey}, cfg.Limit, cfg.WindowSize).Int64Slice()
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("failed to run sliding-counter script: %w", err)
+	}
+	return decide("sliding-counter", res, cfg.Limit)
+}
+
+// IsAllowedBatch is IsAllowed for each of keys, against the rule of the same
+// index, in a single round trip. The requests are counted in order.
+func (rl *SlidingCounterRateLimiter) IsAllowedBatch(ctx context.Context, keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error) {
+	rediskeys := make([][]string, len(keys))
+	args := make([][]any, len(keys))
+	for i, key := range keys {
+		rediskeys[i] = []string{"rate_limit:sliding_counter:" + key}
+		args[i] = []any{cfgs[i].Limit, cfgs[i].WindowSize}
+	}
+
+	replies, errs := runBatch(ctx, rl.client, slidingCounterScript, rediskeys, args)
+	decisions := make([]ratelimit.Decision, len(keys))
+	for i, res := range replies {
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to run sliding-counter script: %w", errs[i])
+			continue
+		}
+		decisions[i], errs[i] = decide("sliding-counter", res, cfgs[i].Limit)
+	}
+	return decisions, errs
+}
+
+// Refund gives back a request previously counted by IsAllowed for key.
+func (rl *SlidingCounterRateLimiter) Refund(ctx context.Context, key string, _ config.RLConfig) error {
+	rediskey := "rate_limit:sliding_counter:" + key
+	if err := slidingCounterRefundScript.Run(ctx, rl.client, []string{rediskey}).Err(); err != nil {
+		return fmt.Errorf("failed to refund sliding-counter: %w", err)
+	}
+	return nil
+}
+
+// Peek returns the weighted count of the sliding window identified by key,
+// without counting a request.
+func (rl *SlidingCounterRateLimiter) Peek(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+	rediskey := "rate_limit:sliding_counter:" + key
+	return peek(ctx, rl.client, slidingCounterPeekScript, []string{rediskey}, cfg.Limit, cfg.WindowSize)
+}
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingLogLua keeps one sorted-set entry per accepted request, scored by its
+// timestamp, and only accepts a new one when fewer than limit entries are
+// younger than the window. The server clock is used so every replica shares
+// the same notion of "now".
+//
+// KEYS[1] - sorted set key
+// ARGV[1] - limit
+// ARGV[2] - window size in seconds
+//
+// Returns {allowed (0|1), entries in the window, retry-after/window in milliseconds}.
+const slidingLogLua = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2]) * 1000
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+if count >= limit then
+	local retry = window
+	local freeing = redis.call('ZRANGE', KEYS[1], count - limit, count - limit, 'WITHSCORES')
+	if #freeing > 0 then
+		retry = tonumber(freeing[2]) + window - now
+	end
+	return {0, count, retry}
+end
+
+redis.call('ZADD', KEYS[1], now, t[1] .. '.' .. t[2] .. '-' .. count)
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, count + 1, window}
+`
+
+var slidingLogScript = redis.NewScript(slidingLogLua)
+
+// slidingLogPeekLua counts the entries still in the window without removing
+// the older ones.
+//
+// KEYS[1] - sorted set key
+// ARGV[1] - window size in seconds
+//
+// Returns {entries in the window, time until the latest one leaves it in milliseconds}.
+const slidingLogPeekLua = `
+local window = tonumber(ARGV[1]) * 1000
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local count = redis.call('ZCOUNT', KEYS[1], '(' .. (now - window), '+inf')
+if count == 0 then
+	return {0, 0}
+end
+local latest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+return {count, tonumber(latest[2]) + window - now}
+`
+
+var slidingLogPeekScript = redis.NewScript(slidingLogPeekLua)
+
+// SlidingLogRateLimiter defines a redis-based sliding-window-log rate-limiter.
+// It is exact, at the cost of one sorted-set entry per accepted request.
+type SlidingLogRateLimiter struct {
+	client *redis.Client
+}
+
+// NewSlidingLog creates a redis-based sliding-window-log rate-limiter
+func NewSlidingLog(client *redis.Client) *SlidingLogRateLimiter {
+	return &SlidingLogRateLimiter{client}
+}
+
+// IsAllowed atomically checks and records a request in the sliding window
+// identified by key, returning the Usage left. When the limit is reached it
+// returns a ratelimit.LimitExceededError carrying the time until the oldest
+// request that blocks this one leaves the window.
+func (rl *SlidingLogRateLimiter) IsAllowed(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Decision, error) {
+	rediskey := "rate_limit:sliding_log:" + key
+	res, err := slidingLogScript.Run(ctx, rl.client, []string{rediskey}, cfg.Limit, cfg.WindowSize).Int64Slice()
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("failed to run sliding-log script: %w", err)
+	}
+	return decide("sliding-log", res, cfg.Limit)
+}
+
+// IsAllowedBatch is IsAllowed for each of keys, against the rule of the same
+// index, in a single round trip. The requests are counted in order.
+func (rl *SlidingLogRateLimiter) IsAllowedBatch(ctx context.Context, keys []string, cfgs []config.RLConfig) ([]ratelimit.Decision, []error) {
+	rediskeys := make([][]string, len(keys))
+	args := make([][]any, len(keys))
+	for i, key := range keys {
+		rediskeys[i] = []string{"rate_limit:sliding_log:" + key}
+		args[i] = []any{cfgs[i].Limit, cfgs[i].WindowSize}
+	}
+
+	replies, errs := runBatch(ctx, rl.client, slidingLogScript, rediskeys, args)
+	decisions := make([]ratelimit.Decision, len(keys))
+	for i, res := range replies {
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to run sliding-log script: %w", errs[i])
+			continue
+		}
+		decisions[i], errs[i] = decide("sliding-log", res, cfgs[i].Limit)
+	}
+	return decisions, errs
+}
+
+// Refund removes the most recent request recorded by IsAllowed for key.
+func (rl *SlidingLogRateLimiter) Refund(ctx context.Context, key string, _ config.RLConfig) error {
+	rediskey := "rate_limit:sliding_log:" + key
+	if err := rl.client.ZPopMax(ctx, rediskey).Err(); err != nil {
+		return fmt.Errorf("failed to refund sliding-log entry: %w", err)
+	}
+	return nil
+}
+
+// Peek returns how many requests are recorded in the sliding window identified
+// by key, without recording one. The window is fully available again once the
+// latest of them leaves it.
+func (rl *SlidingLogRateLimiter) Peek(ctx context.Context, key string, cfg config.RLConfig) (ratelimit.Usage, error) {
+	rediskey := "rate_limit:sliding_log:" + key
+	return peek(ctx, rl.client, slidingLogPeekScript, []string{rediskey}, cfg.Limit, cfg.WindowSize)
+}
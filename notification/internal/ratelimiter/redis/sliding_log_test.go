@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/internal/config"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/model"
+	"github.com/LohanGuedes/modak-rate-limit-challenge/notification/pkg/ratelimit"
+	"github.com/go-redis/redismock/v9"
+)
+
+func TestSlidingLogIsAllowed_Table(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		reply           []any
+		scriptErr       error
+		noScript        bool
+		expectAllow     bool
+		expectErr       bool
+		expectRateLimit bool
+		expectRetry     time.Duration
+	}{
+		{
+			name:        "Empty window",
+			reply:       []any{int64(1), int64(1), int64(60000)},
+			expectAllow: true,
+		},
+		{
+			name:        "Window below limit",
+			reply:       []any{int64(1), int64(2), int64(60000)},
+			expectAllow: true,
+		},
+		{
+			name:            "Window full - retry when oldest entry leaves",
+			reply:           []any{int64(0), int64(2), int64(1500)},
+			expectRateLimit: true,
+			expectRetry:     1500 * time.Millisecond,
+		},
+		{
+			name:        "Script not cached - falls back to EVAL",
+			reply:       []any{int64(1), int64(1), int64(60000)},
+			noScript:    true,
+			expectAllow: true,
+		},
+		{
+			name:      "Unexpected script reply",
+			reply:     []any{int64(0), int64(2)},
+			expectErr: true,
+		},
+		{
+			name:      "Redis returns unexpected error",
+			scriptErr: errors.New("connection dropped"),
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := redismock.NewClientMock()
+			limiter := NewSlidingLog(client)
+
+			key := model.NotificationTypeStatus.GenKey("", "968af933-64e3-4890-bd3c-50158bdadf0c")
+			redisKey := "rate_limit:sliding_log:" + key
+			limit, windowSize := 2, 60
+
+			evalSha := mock.ExpectEvalSha(slidingLogScript.Hash(), []string{redisKey}, limit, windowSize)
+			switch {
+			case tt.scriptErr != nil:
+				evalSha.SetErr(tt.scriptErr)
+			case tt.noScript:
+				evalSha.SetErr(noScriptError{})
+				mock.ExpectEval(slidingLogLua, []string{redisKey}, limit, windowSize).SetVal(tt.reply)
+			default:
+				evalSha.SetVal(tt.reply)
+			}
+
+			decision, err := limiter.IsAllowed(ctx, key, config.RLConfig{Limit: limit, WindowSize: windowSize})
+
+			if tt.expectErr && err == nil {
+				t.Errorf("expected error, got none")
+			}
+			if !tt.expectErr && err != nil && !tt.expectRateLimit {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if decision.Allowed != tt.expectAllow {
+				t.Errorf("expected allowed = %v, got %v", tt.expectAllow, decision.Allowed)
+			}
+
+			if tt.expectRateLimit {
+				var rateLimitErr *ratelimit.LimitExceededError
+				if !errors.As(err, &rateLimitErr) {
+					t.Errorf("expected LimitExceededError, got %T: %v", err, err)
+				} else if rateLimitErr.RetryAfter != tt.expectRetry {
+					t.Errorf("expected RetryAfter %v, got %v", tt.expectRetry, rateLimitErr.RetryAfter)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet redis expectations: %v", err)
+			}
+		})
+	}
+}
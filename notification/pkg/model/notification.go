@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"time"
 
 	"github.com/LohanGuedes/modak-rate-limit-challenge/pkg/validator"
 	"github.com/google/uuid"
@@ -12,23 +13,112 @@ import (
 // RecordType defines a record type. Together with RecordID identifies unique records across all types.
 type NotificationType string
 
-// Generates a key for a notification, usually used with a rate-limiter
-func (n NotificationType) GenKey(s string) string {
+// Generates a key for a notification, usually used with a rate-limiter. Types
+// sharing the quota of a group get the group key instead of their own, an
+// empty group means the type has its own quota
+func (n NotificationType) GenKey(group, s string) string {
+	if group != "" {
+		return "group:" + group + ":" + s
+	}
 	return string(n) + ":" + s
 }
 
-// Existing record types. This is mappped by a json named limits.json
+// Generates the key shared by every notification type sent to the same
+// recipient, usually used with a rate-limiter enforcing a global cap
+func GenGlobalKey(s string) string {
+	return "global:" + s
+}
+
+// Builtin notification types, accepted when no TypeRegistry is set in the
+// validation context. The types actually served are the ones configured in
+// limits.json
 const (
 	NotificationTypeNews      = NotificationType("news-notification")
 	NotificationTypeStatus    = NotificationType("status-notification")
 	NotificationTypeMarketing = NotificationType("marketing-notification")
 )
 
+// BuiltinNotificationTypes lists the builtin notification types.
+var BuiltinNotificationTypes = []NotificationType{
+	NotificationTypeNews,
+	NotificationTypeStatus,
+	NotificationTypeMarketing,
+}
+
+// Channel defines how a notification is delivered to its recipient. An empty
+// Channel means the default gateway.
+type Channel string
+
+// Supported delivery channels.
+const (
+	ChannelEmail   = Channel("email")
+	ChannelWebhook = Channel("webhook")
+	ChannelSMS     = Channel("sms")
+	ChannelInApp   = Channel("in-app")
+)
+
+// Channels lists every supported delivery channel.
+var Channels = []Channel{ChannelEmail, ChannelWebhook, ChannelSMS, ChannelInApp}
+
+// Generates the key of a recipient on a channel, so each channel is counted
+// separately. The default channel, email, keeps s untouched so it is still
+// counted under the keys used before there were channels
+func (c Channel) GenKey(s string) string {
+	if c == "" || c == ChannelEmail {
+		return s
+	}
+	return string(c) + ":" + s
+}
+
+// TypeRegistry defines where the accepted notification types come from,
+// usually the active rate-limit configuration.
+type TypeRegistry interface {
+	NotificationTypes() []NotificationType
+}
+
+type typeRegistryKey struct{}
+
+// WithTypeRegistry returns a copy of ctx carrying the TypeRegistry used by
+// Notification.Valid.
+func WithTypeRegistry(ctx context.Context, r TypeRegistry) context.Context {
+	return context.WithValue(ctx, typeRegistryKey{}, r)
+}
+
+// NotificationTypes returns the notification types accepted within ctx: the
+// ones of its TypeRegistry, or BuiltinNotificationTypes when there is none.
+func NotificationTypes(ctx context.Context) []NotificationType {
+	if r, ok := ctx.Value(typeRegistryKey{}).(TypeRegistry); ok {
+		return r.NotificationTypes()
+	}
+	return BuiltinNotificationTypes
+}
+
 // Notification defines an individual rating created by a user for some record.
 type Notification struct {
 	NotificationType NotificationType `json:"notificationType"`
 	UserID           uuid.UUID        `json:"userId"`
 	Message          string           `json:"message"`
+	// TimeZone is the recipient's IANA time zone, e.g. "Europe/Lisbon". When
+	// set, calendar-aligned rate limits reset at its boundaries.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Channel is how the notification is delivered, each one with its own
+	// limits.
+	Channel Channel `json:"channel,omitempty"`
+}
+
+// Digest defines the notifications of a type a recipient was denied, buffered
+// to be sent combined into a single one.
+type Digest struct {
+	UserID           uuid.UUID        `json:"userId"`
+	NotificationType NotificationType `json:"notificationType"`
+	TimeZone         string           `json:"timeZone,omitempty"`
+	Channel          Channel          `json:"channel,omitempty"`
+	// Messages holds the first buffered messages, up to the configured
+	// maximum.
+	Messages []string `json:"messages"`
+	// Count is how many notifications were buffered, including the ones whose
+	// message was not kept.
+	Count int `json:"count"`
 }
 
 // NOTE: add checks as needed, this is just an example of how I usually create
@@ -37,7 +127,7 @@ type Notification struct {
 func (n Notification) Valid(ctx context.Context) validator.Evaluator {
 	var eval validator.Evaluator
 
-	validNotificationTypes := []NotificationType{NotificationTypeNews, NotificationTypeStatus, NotificationTypeMarketing}
+	validNotificationTypes := NotificationTypes(ctx)
 
 	// Field: "message"
 	eval.CheckField(validator.NotBlank(n.Message), "message", "this field cannot be blank")
@@ -54,5 +144,20 @@ func (n Notification) Valid(ctx context.Context) validator.Evaluator {
 		fmt.Sprintf("Must be a valid notificationType: %v", validNotificationTypes),
 	)
 
+	// Field: TimeZone
+	if n.TimeZone != "" {
+		_, err := time.LoadLocation(n.TimeZone)
+		eval.CheckField(err == nil, "timeZone", "must be an IANA time zone, e.g. Europe/Lisbon")
+	}
+
+	// Field: Channel
+	if n.Channel != "" {
+		eval.CheckField(
+			slices.Contains(Channels, n.Channel),
+			"channel",
+			fmt.Sprintf("Must be a valid channel: %v", Channels),
+		)
+	}
+
 	return eval
 }
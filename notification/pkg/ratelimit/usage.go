@@ -0,0 +1,44 @@
+package ratelimit
+
+import "time"
+
+// Usage represents how much of a rate limit was used, as read without
+// consuming it.
+type Usage struct {
+	Limit     int
+	Used      int
+	Remaining int
+	// ResetAfter is the time until the whole limit is available again, zero
+	// when nothing is used.
+	ResetAfter time.Duration
+}
+
+// NewUsage creates a Usage of limit with used requests, never remaining less
+// than zero.
+func NewUsage(limit, used int, resetAfter time.Duration) Usage {
+	return Usage{
+		Limit:      limit,
+		Used:       used,
+		Remaining:  max(limit-used, 0),
+		ResetAfter: resetAfter,
+	}
+}
+
+// Decision represents whether a request was allowed by a rate limit, along
+// with the Usage of the limit once it was decided, the request included. A
+// denied request reports the limit used up until its retry-after.
+type Decision struct {
+	Allowed bool
+	Usage
+}
+
+// Allow creates the Decision allowing a request, leaving usage.
+func Allow(usage Usage) Decision {
+	return Decision{Allowed: true, Usage: usage}
+}
+
+// Deny creates the Decision denying a request to limit, which accepts another
+// one after retryAfter.
+func Deny(limit int, retryAfter time.Duration) Decision {
+	return Decision{Usage: NewUsage(limit, limit, retryAfter)}
+}